@@ -0,0 +1,59 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+package cmd
+
+import (
+	"eolh/pkg/signatures/bundle"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var bundleName string
+var bundleVersion string
+var bundleOutput string
+var bundleKey string
+
+func init() {
+	bundleCmd.Flags().StringVar(&bundleName, "name", "", "Name of the bundle")
+	bundleCmd.Flags().StringVar(&bundleVersion, "version", "", "Version of the bundle")
+	bundleCmd.Flags().StringVarP(&bundleOutput, "output", "o", "signatures.tar.gz", "Path of the bundle")
+	bundleCmd.Flags().StringVar(&bundleKey, "key", "", "PEM encoded PKCS #8 Ed25519 or ECDSA private key signing the bundle")
+	rootCmd.AddCommand(bundleCmd)
+}
+
+var bundleCmd = &cobra.Command{
+	Use:   "bundle <dir>",
+	Short: "Create a signed bundle of the Rego and Sigma signatures found in a directory",
+	Long: `Create a tar.gz bundle of the Rego and Sigma signatures found in a directory, along with a manifest of their
+digests. When a private key is given, the bundle is signed and its signature is written next to it with the ` + bundle.SignatureSuffix + `
+suffix. Bundles may also be signed with 'cosign sign-blob'.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if bundleName == "" || bundleVersion == "" {
+			return fmt.Errorf("--name and --version are required")
+		}
+		archive, err := bundle.Create(args[0], bundleName, bundleVersion, ".rego", ".yml", ".yaml")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(bundleOutput, archive, 0644); err != nil {
+			return err
+		}
+		if bundleKey == "" {
+			return nil
+		}
+		key, err := bundle.LoadPrivateKey(bundleKey)
+		if err != nil {
+			return err
+		}
+		signature, err := bundle.Sign(archive, key)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(bundleOutput+bundle.SignatureSuffix, signature, 0644)
+	},
+}
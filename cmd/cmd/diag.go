@@ -0,0 +1,39 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+package cmd
+
+import (
+	eolhcmd "eolh/pkg/cmd"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var diagAddr string
+var diagOutput string
+
+func init() {
+	diagCmd.Flags().StringVar(&diagAddr, "addr", "127.0.0.1:3367", "pprof address of the running eolh, see --pprof-listen-addr")
+	diagCmd.Flags().StringVarP(&diagOutput, "output", "o", "", "Write the dump to a file instead of stdout")
+	rootCmd.AddCommand(diagCmd)
+}
+
+var diagCmd = &cobra.Command{
+	Use:   "diag",
+	Short: "Dump the goroutines, pipeline channels and containers of a running eolh",
+	Long:  "Dump the goroutine stacks, the occupancy of the pipeline channels and the container map of an eolh running with --pprof",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if diagOutput == "" {
+			return eolhcmd.Diag(cmd.OutOrStdout(), diagAddr)
+		}
+		f, err := os.Create(diagOutput)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return eolhcmd.Diag(f, diagAddr)
+	},
+}
@@ -0,0 +1,72 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+package cmd
+
+import (
+	eolhcmd "eolh/pkg/cmd"
+	"eolh/pkg/cmd/flags"
+	"eolh/pkg/signatures"
+	"eolh/pkg/signatures/regosig"
+
+	"github.com/open-policy-agent/opa/compile"
+	"github.com/spf13/cobra"
+)
+
+var listFormat string
+var listSignaturesDirs []string
+
+func init() {
+	listCmd.PersistentFlags().StringVarP(&listFormat, "format", "f", "table", "Output format: table or json")
+	listSignaturesCmd.Flags().StringArrayVar(&listSignaturesDirs, "signatures-dir", nil, "Search a directory for Rego and Sigma signatures")
+	listCmd.AddCommand(listSignaturesCmd, listEventsCmd, listProvidersCmd)
+	rootCmd.AddCommand(listCmd)
+}
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the signatures, events and providers known to eolh",
+}
+
+var listSignaturesCmd = &cobra.Command{
+	Use:   "signatures",
+	Short: "List the loaded signatures",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dirs := listSignaturesDirs
+		if len(dirs) == 0 {
+			dirs = signatures.DefaultDirs()
+		}
+		sigs, err := signatures.Find(signatures.Config{
+			Dirs: dirs,
+			Rego: regosig.Options{Target: compile.TargetRego},
+		})
+		if err != nil {
+			return err
+		}
+		infos, err := eolhcmd.Signatures(sigs)
+		if err != nil {
+			return err
+		}
+		return eolhcmd.PrintList(cmd.OutOrStdout(), listFormat, infos)
+	},
+}
+
+var listEventsCmd = &cobra.Command{
+	Use:   "events",
+	Short: "List the events decoded from ETW",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return eolhcmd.PrintList(cmd.OutOrStdout(), listFormat, eolhcmd.Events())
+	},
+}
+
+var listProvidersCmd = &cobra.Command{
+	Use:   "providers",
+	Short: "List the default and optional ETW providers",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return eolhcmd.PrintList(cmd.OutOrStdout(), listFormat, flags.ProviderDefinitions)
+	},
+}
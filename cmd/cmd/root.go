@@ -10,11 +10,14 @@ package cmd
 import (
 	"context"
 	cmdcobra "eolh/pkg/cmd/cobra"
+	"eolh/pkg/enrich"
+	"eolh/pkg/etw"
 	"eolh/pkg/logger"
 	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -58,7 +61,10 @@ var rootCmd = &cobra.Command{
 		}
 		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 		defer stop()
-		runner.Run(ctx)
+		if err := runner.Run(ctx); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
 	},
 	SilenceUsage:  true,
 	SilenceErrors: true,
@@ -104,7 +110,7 @@ func initCmd() error {
 		"add",
 		"a",
 		nil,
-		"\t\t\t\tEnable Additional ETW Providers",
+		"[dns|registry|powershell|<provider>]\tEnable Additional ETW Providers",
 	)
 	err = viper.BindPFlag("add", rootCmd.Flags().Lookup("add"))
 	if err != nil {
@@ -117,7 +123,259 @@ func initCmd() error {
 		"[process|file|network]\t\tDisable Default ETW Provides",
 	)
 
-	err = viper.BindPFlag("remove", rootCmd.Flags().Lookup("output"))
+	err = viper.BindPFlag("remove", rootCmd.Flags().Lookup("remove"))
+	if err != nil {
+		return err
+	}
+	rootCmd.Flags().StringArray(
+		"rego",
+		nil,
+		"[partial-eval|aio|runtime-target=rego|wasm]\tControl the evaluation of Rego signatures",
+	)
+	err = viper.BindPFlag("rego", rootCmd.Flags().Lookup("rego"))
+	if err != nil {
+		return err
+	}
+	rootCmd.Flags().StringArray(
+		"signatures",
+		nil,
+		"<id|name|tag>\t\t\tLoad only the matching signatures",
+	)
+	err = viper.BindPFlag("signatures", rootCmd.Flags().Lookup("signatures"))
+	if err != nil {
+		return err
+	}
+	rootCmd.Flags().StringArray(
+		"exclude-signatures",
+		nil,
+		"<id|name|tag>\t\t\tDo not load the matching signatures",
+	)
+	err = viper.BindPFlag("exclude-signatures", rootCmd.Flags().Lookup("exclude-signatures"))
+	if err != nil {
+		return err
+	}
+	rootCmd.Flags().StringArray(
+		"signatures-dir",
+		nil,
+		"<dir>\t\t\t\tSearch a directory for Rego and Sigma signatures",
+	)
+	err = viper.BindPFlag("signatures-dir", rootCmd.Flags().Lookup("signatures-dir"))
+	if err != nil {
+		return err
+	}
+	rootCmd.Flags().StringArray(
+		"signatures-bundle",
+		nil,
+		"<file.tar.gz>\t\t\tLoad a signed signature bundle, its signature is read from <file.tar.gz>.sig",
+	)
+	err = viper.BindPFlag("signatures-bundle", rootCmd.Flags().Lookup("signatures-bundle"))
+	if err != nil {
+		return err
+	}
+	rootCmd.Flags().String(
+		"signatures-bundle-key",
+		"",
+		"<file.pem>\t\t\tPublic key verifying the signature bundles",
+	)
+	err = viper.BindPFlag("signatures-bundle-key", rootCmd.Flags().Lookup("signatures-bundle-key"))
+	if err != nil {
+		return err
+	}
+	rootCmd.Flags().StringArray(
+		"signatures-plugin",
+		nil,
+		"<npipe://...|tcp://...>\t\tLoad the signatures served by a plugin",
+	)
+	err = viper.BindPFlag("signatures-plugin", rootCmd.Flags().Lookup("signatures-plugin"))
+	if err != nil {
+		return err
+	}
+	rootCmd.Flags().String(
+		"signatures-plugin-tls-ca",
+		"",
+		"<file>\t\t\t\tPEM certificate authorities of the tcp:// plugins, required but on loopback",
+	)
+	err = viper.BindPFlag("signatures-plugin-tls-ca", rootCmd.Flags().Lookup("signatures-plugin-tls-ca"))
+	if err != nil {
+		return err
+	}
+	rootCmd.Flags().String(
+		"signatures-plugin-tls-cert",
+		"",
+		"<file>\t\t\t\tPEM client certificate presented to the tcp:// plugins",
+	)
+	err = viper.BindPFlag("signatures-plugin-tls-cert", rootCmd.Flags().Lookup("signatures-plugin-tls-cert"))
+	if err != nil {
+		return err
+	}
+	rootCmd.Flags().String(
+		"signatures-plugin-tls-key",
+		"",
+		"<file>\t\t\t\tPEM key of the client certificate of the plugins",
+	)
+	err = viper.BindPFlag("signatures-plugin-tls-key", rootCmd.Flags().Lookup("signatures-plugin-tls-key"))
+	if err != nil {
+		return err
+	}
+	rootCmd.Flags().Bool(
+		"strict-signatures",
+		false,
+		"\t\t\t\tFail on signatures which can't be loaded",
+	)
+	err = viper.BindPFlag("strict-signatures", rootCmd.Flags().Lookup("strict-signatures"))
+	if err != nil {
+		return err
+	}
+	rootCmd.Flags().Bool(
+		"require-signed-signatures",
+		false,
+		"\t\t\tOnly load the built-in and the bundled signatures, rejecting --signatures-dir and --signatures-plugin",
+	)
+	err = viper.BindPFlag("require-signed-signatures", rootCmd.Flags().Lookup("require-signed-signatures"))
+	if err != nil {
+		return err
+	}
+	rootCmd.Flags().String(
+		"grpc-listen-addr",
+		"",
+		"<tcp://host:port|npipe://./pipe/name>\tServe the gRPC API streaming events and findings, named pipes are restricted to administrators",
+	)
+	err = viper.BindPFlag("grpc-listen-addr", rootCmd.Flags().Lookup("grpc-listen-addr"))
+	if err != nil {
+		return err
+	}
+	rootCmd.Flags().String(
+		"grpc-tls-cert",
+		"",
+		"<file>\t\t\t\tPEM certificate of the gRPC API, required by tcp:// endpoints but loopback ones",
+	)
+	err = viper.BindPFlag("grpc-tls-cert", rootCmd.Flags().Lookup("grpc-tls-cert"))
+	if err != nil {
+		return err
+	}
+	rootCmd.Flags().String(
+		"grpc-tls-key",
+		"",
+		"<file>\t\t\t\tPEM key of the certificate of the gRPC API",
+	)
+	err = viper.BindPFlag("grpc-tls-key", rootCmd.Flags().Lookup("grpc-tls-key"))
+	if err != nil {
+		return err
+	}
+	rootCmd.Flags().String(
+		"grpc-tls-client-ca",
+		"",
+		"<file>\t\t\t\tPEM certificate authorities of the gRPC API clients, which must then present a certificate",
+	)
+	err = viper.BindPFlag("grpc-tls-client-ca", rootCmd.Flags().Lookup("grpc-tls-client-ca"))
+	if err != nil {
+		return err
+	}
+	rootCmd.Flags().Bool(
+		"metrics",
+		false,
+		"\t\t\t\t\tServe Prometheus metrics on /metrics",
+	)
+	err = viper.BindPFlag("metrics", rootCmd.Flags().Lookup("metrics"))
+	if err != nil {
+		return err
+	}
+	rootCmd.Flags().Bool(
+		"health",
+		false,
+		"\t\t\t\t\tServe the /healthz and /readyz probes",
+	)
+	err = viper.BindPFlag("health", rootCmd.Flags().Lookup("health"))
+	if err != nil {
+		return err
+	}
+	rootCmd.Flags().Bool(
+		"pprof",
+		false,
+		"\t\t\t\t\tServe the pprof profiles and the /debug/diag dump read by 'eolh diag' on --pprof-listen-addr",
+	)
+	err = viper.BindPFlag("pprof", rootCmd.Flags().Lookup("pprof"))
+	if err != nil {
+		return err
+	}
+	rootCmd.Flags().String(
+		"http-listen-addr",
+		"127.0.0.1:3366",
+		"<host:port>\t\t\tAddress of the HTTP server for --metrics and --health, e.g. :3366 for kubelet probes",
+	)
+	err = viper.BindPFlag("http-listen-addr", rootCmd.Flags().Lookup("http-listen-addr"))
+	if err != nil {
+		return err
+	}
+	rootCmd.Flags().String(
+		"pprof-listen-addr",
+		"127.0.0.1:3367",
+		"<host:port>\t\t\tLoopback address of the HTTP server for --pprof",
+	)
+	err = viper.BindPFlag("pprof-listen-addr", rootCmd.Flags().Lookup("pprof-listen-addr"))
+	if err != nil {
+		return err
+	}
+	rootCmd.Flags().Int64(
+		"hash-max-size",
+		enrich.DefaultMaxFileSize,
+		"<bytes>\t\t\t\tSize of the largest executable hashed for process start and file close events",
+	)
+	err = viper.BindPFlag("hash-max-size", rootCmd.Flags().Lookup("hash-max-size"))
+	if err != nil {
+		return err
+	}
+	rootCmd.Flags().Duration(
+		"net-flow-window",
+		30*time.Second,
+		"<duration>\t\t\tReport network flows per window instead of every packet, 0 reports every packet",
+	)
+	err = viper.BindPFlag("net-flow-window", rootCmd.Flags().Lookup("net-flow-window"))
+	if err != nil {
+		return err
+	}
+	rootCmd.Flags().String(
+		"etw-session-name",
+		etw.DefaultSessionName,
+		"<name>\t\t\t\tName of the ETW session, a session of the same name left behind by a crashed eolh is stopped",
+	)
+	err = viper.BindPFlag("etw-session-name", rootCmd.Flags().Lookup("etw-session-name"))
+	if err != nil {
+		return err
+	}
+	rootCmd.Flags().Uint32(
+		"etw-buffer-size",
+		etw.DefaultBufferSize,
+		"<KB>\t\t\t\tSize of the buffers of the ETW session, up to 1024",
+	)
+	err = viper.BindPFlag("etw-buffer-size", rootCmd.Flags().Lookup("etw-buffer-size"))
+	if err != nil {
+		return err
+	}
+	rootCmd.Flags().Uint32(
+		"etw-min-buffers",
+		0,
+		"<count>\t\t\tMinimum number of buffers of the ETW session, 0 lets ETW pick it",
+	)
+	err = viper.BindPFlag("etw-min-buffers", rootCmd.Flags().Lookup("etw-min-buffers"))
+	if err != nil {
+		return err
+	}
+	rootCmd.Flags().Uint32(
+		"etw-max-buffers",
+		0,
+		"<count>\t\t\tMaximum number of buffers of the ETW session, raise it when ETW loses buffers, 0 lets ETW pick it",
+	)
+	err = viper.BindPFlag("etw-max-buffers", rootCmd.Flags().Lookup("etw-max-buffers"))
+	if err != nil {
+		return err
+	}
+	rootCmd.Flags().String(
+		"config",
+		"",
+		"<file>\t\t\t\tRead flags, providers, signature-overrides and exclusions from a YAML or JSON file",
+	)
+	err = viper.BindPFlag("config", rootCmd.Flags().Lookup("config"))
 	if err != nil {
 		return err
 	}
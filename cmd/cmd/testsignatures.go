@@ -0,0 +1,54 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+package cmd
+
+import (
+	"eolh/pkg/detect"
+	"eolh/pkg/signatures"
+	"eolh/pkg/signatures/regosig"
+	"eolh/pkg/signatures/sigtest"
+	"fmt"
+
+	"github.com/open-policy-agent/opa/compile"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(testSignaturesCmd)
+}
+
+var testSignaturesCmd = &cobra.Command{
+	Use:   "test-signatures <dir>",
+	Short: "Run the signatures against the fixtures found in a directory",
+	Long: `Run the Go signatures, and the Rego and Sigma signatures found in a directory, against the
+fixtures (*` + sigtest.FixtureSuffix + `) found in the same directory, and report the findings which differ
+from the expected ones.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir := args[0]
+		load := func() ([]detect.Signature, error) {
+			return signatures.FindIn(dir, regosig.Options{Target: compile.TargetRego})
+		}
+		results, err := sigtest.RunDir(load, dir)
+		if err != nil {
+			return err
+		}
+		failed := 0
+		for _, result := range results {
+			if result.Passed() {
+				fmt.Fprintf(cmd.OutOrStdout(), "PASS %s\n", result.Fixture.Path)
+				continue
+			}
+			failed++
+			fmt.Fprintf(cmd.OutOrStdout(), "FAIL %s\n%s", result.Fixture.Path, result.Diff())
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "%d passed, %d failed\n", len(results)-failed, failed)
+		if failed > 0 {
+			return fmt.Errorf("%d fixtures failed", failed)
+		}
+		return nil
+	},
+	DisableFlagsInUseLine: true,
+}
@@ -0,0 +1,135 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package api
+
+import (
+	"context"
+	"eolh/pkg/detect"
+	"eolh/pkg/logger"
+	"eolh/pkg/metrics"
+	"eolh/pkg/streams"
+	"eolh/pkg/trace"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// streamBufferSize is the number of events buffered for a subscriber, events are dropped beyond
+const streamBufferSize = 10000
+
+// Server serves the eolh service
+type Server struct {
+	grpcServer *grpc.Server
+	signatures []detect.Signature
+	stats      *metrics.Stats
+	streams    *streams.Manager
+}
+
+func NewServer(signatures []detect.Signature, stats *metrics.Stats, streams *streams.Manager, opts ...grpc.ServerOption) *Server {
+	s := &Server{
+		grpcServer: grpc.NewServer(opts...),
+		signatures: signatures,
+		stats:      stats,
+		streams:    streams,
+	}
+	RegisterEolhServer(s.grpcServer, s)
+	return s
+}
+
+// Serve serves the connections of the listener until Stop is called
+func (s *Server) Serve(lis net.Listener) error {
+	return s.grpcServer.Serve(lis)
+}
+
+// Stop closes the listener and the connections, ending the streams
+func (s *Server) Stop() {
+	s.grpcServer.Stop()
+}
+
+func (s *Server) StreamEvents(req *StreamEventsRequest, stream EolhStreamEventsServer) error {
+	sub := s.streams.Subscribe(req.Filter, streamBufferSize)
+	defer s.streams.Unsubscribe(sub)
+	logger.Debugw("Stream subscribed", "filter", req.Filter)
+	for {
+		select {
+		case event, ok := <-sub.Events():
+			if !ok {
+				return nil
+			}
+			if !req.IncludeRaw {
+				event.RawEvent = trace.RawEvent{}
+			}
+			res := &StreamEventsResponse{
+				Finding: streams.IsFinding(&event),
+				Event:   event,
+			}
+			if err := stream.Send(res); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+// aggregating is implemented by signatures evaluating several signatures, see regosig.AIO
+type aggregating interface {
+	Signatures() []detect.SignatureMetadata
+}
+
+func (s *Server) ListSignatures(ctx context.Context, req *ListSignaturesRequest) (*ListSignaturesResponse, error) {
+	res := &ListSignaturesResponse{Signatures: []Signature{}}
+	for _, sig := range s.signatures {
+		if aio, ok := sig.(aggregating); ok {
+			for _, metadata := range aio.Signatures() {
+				res.Signatures = append(res.Signatures, newSignature(metadata, nil))
+			}
+			continue
+		}
+		metadata, err := sig.GetMetadata()
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		selectedEvents, err := sig.GetSelectedEvents()
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		res.Signatures = append(res.Signatures, newSignature(metadata, selectedEvents))
+	}
+	return res, nil
+}
+
+func newSignature(metadata detect.SignatureMetadata, selectedEvents []detect.SignatureEventSelector) Signature {
+	return Signature{
+		ID:             metadata.ID,
+		Name:           metadata.Name,
+		Version:        metadata.Version,
+		Description:    metadata.Description,
+		Tags:           metadata.Tags,
+		Properties:     metadata.Properties,
+		SelectedEvents: selectedEvents,
+	}
+}
+
+func (s *Server) GetStats(ctx context.Context, req *GetStatsRequest) (*GetStatsResponse, error) {
+	return &GetStatsResponse{
+		Stats:       s.stats.Snapshot(),
+		Subscribers: s.streams.Subscribers(),
+	}, nil
+}
+
+func (s *Server) SetLogLevel(ctx context.Context, req *SetLogLevelRequest) (*SetLogLevelResponse, error) {
+	level, err := logger.ParseLevel(req.Level)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	previous := logger.GetLevel()
+	logger.SetLevel(level)
+	logger.Infow("Log level changed", "level", level.String(), "previous", previous.String())
+	return &SetLogLevelResponse{Previous: previous.String()}, nil
+}
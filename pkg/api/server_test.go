@@ -0,0 +1,188 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package api
+
+import (
+	"context"
+	"eolh/pkg/detect"
+	"eolh/pkg/logger"
+	"eolh/pkg/metrics"
+	"eolh/pkg/signatures"
+	"eolh/pkg/streams"
+	"eolh/pkg/trace"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// aggregatingSignature evaluates the signatures of its metadata
+type aggregatingSignature struct {
+	*signatures.FakeSignature
+	metadata []detect.SignatureMetadata
+}
+
+func (s aggregatingSignature) Signatures() []detect.SignatureMetadata {
+	return s.metadata
+}
+
+// serve serves the service on a local port and returns a client of it
+func serve(t *testing.T, sigs []detect.Signature, stats *metrics.Stats, manager *streams.Manager) *Client {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(sigs, stats, manager)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return NewClient(conn)
+}
+
+// waitSubscribers waits for the streams of the clients to be subscribed or unsubscribed
+func waitSubscribers(t *testing.T, manager *streams.Manager, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for manager.Subscribers() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d subscribers, want %d", manager.Subscribers(), n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestListSignatures(t *testing.T) {
+	selected := []detect.SignatureEventSelector{{Source: "eolh", Name: "process_start", Origin: "*"}}
+	sigs := []detect.Signature{
+		&signatures.FakeSignature{
+			FakeGetMetadata: func() (detect.SignatureMetadata, error) {
+				return detect.SignatureMetadata{ID: "TEST-1", Name: "one", Tags: []string{"execution"}}, nil
+			},
+			FakeGetSelectedEvents: func() ([]detect.SignatureEventSelector, error) {
+				return selected, nil
+			},
+		},
+		aggregatingSignature{
+			FakeSignature: &signatures.FakeSignature{},
+			metadata:      []detect.SignatureMetadata{{ID: "TEST-2", Name: "two"}, {ID: "TEST-3", Name: "three"}},
+		},
+	}
+	client := serve(t, sigs, &metrics.Stats{}, streams.NewManager(nil))
+	res, err := client.ListSignatures(context.Background(), &ListSignaturesRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the aggregated signatures are listed in place of the aggregating one
+	if len(res.Signatures) != 3 {
+		t.Fatalf("signatures = %+v, want TEST-1, TEST-2 and TEST-3", res.Signatures)
+	}
+	for i, id := range []string{"TEST-1", "TEST-2", "TEST-3"} {
+		if res.Signatures[i].ID != id {
+			t.Errorf("signature %d = %s, want %s", i, res.Signatures[i].ID, id)
+		}
+	}
+	if one := res.Signatures[0]; len(one.Tags) != 1 || len(one.SelectedEvents) != 1 || one.SelectedEvents[0] != selected[0] {
+		t.Errorf("TEST-1 = %+v, want its tags and selected events", one)
+	}
+}
+
+func TestGetStats(t *testing.T) {
+	stats := &metrics.Stats{}
+	stats.EventCount.Add(3)
+	stats.ProviderEvents.Add("Microsoft-Windows-Kernel-Process", 2)
+	manager := streams.NewManager(stats)
+	manager.Subscribe(streams.Filter{}, 1)
+	client := serve(t, nil, stats, manager)
+	res, err := client.GetStats(context.Background(), &GetStatsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Stats.EventCount != 3 || res.Stats.ProviderEvents["Microsoft-Windows-Kernel-Process"] != 2 || res.Subscribers != 1 {
+		t.Errorf("stats = %+v, want 3 events, 2 of them from the kernel process provider, and 1 subscriber", res)
+	}
+}
+
+func TestSetLogLevel(t *testing.T) {
+	defer logger.SetLevel(logger.GetLevel())
+	logger.SetLevel(logger.InfoLevel)
+	client := serve(t, nil, &metrics.Stats{}, streams.NewManager(nil))
+	res, err := client.SetLogLevel(context.Background(), &SetLogLevelRequest{Level: "debug"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Previous != "info" || logger.GetLevel() != logger.DebugLevel {
+		t.Errorf("previous level = %s and level = %s, want info and debug", res.Previous, logger.GetLevel())
+	}
+	_, err = client.SetLogLevel(context.Background(), &SetLogLevelRequest{Level: "verbose"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("setting an unknown level returned %v, want InvalidArgument", err)
+	}
+}
+
+func TestStreamEvents(t *testing.T) {
+	manager := streams.NewManager(nil)
+	client := serve(t, nil, &metrics.Stats{}, manager)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := client.StreamEvents(ctx, &StreamEventsRequest{Filter: streams.Filter{Kind: streams.KindFindings}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitSubscribers(t, manager, 1)
+
+	var raw trace.RawEvent
+	raw.EventData = map[string]interface{}{"Image": `C:\Windows\System32\cmd.exe`}
+	manager.Publish(&trace.Event{EventName: "process_start", RawEvent: raw})
+	manager.Publish(&trace.Event{EventName: "ppid_spoofing", RawEvent: raw, Metadata: &trace.Metadata{Version: "1"}})
+	res, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// only the finding passes the filter, without its raw event
+	if !res.Finding || res.Event.EventName != "ppid_spoofing" || res.Event.RawEvent.EventData != nil {
+		t.Errorf("received %+v, want the ppid_spoofing finding without its raw event", res)
+	}
+
+	// the subscription ends with the call
+	cancel()
+	waitSubscribers(t, manager, 0)
+}
+
+func TestStreamEventsEndsWhenStreamsClose(t *testing.T) {
+	manager := streams.NewManager(nil)
+	client := serve(t, nil, &metrics.Stats{}, manager)
+	stream, err := client.StreamEvents(context.Background(), &StreamEventsRequest{IncludeRaw: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitSubscribers(t, manager, 1)
+
+	var raw trace.RawEvent
+	raw.EventData = map[string]interface{}{"Image": `C:\Windows\System32\cmd.exe`}
+	manager.Publish(&trace.Event{EventName: "process_start", RawEvent: raw})
+	res, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Finding || res.Event.RawEvent.EventData["Image"] != `C:\Windows\System32\cmd.exe` {
+		t.Errorf("received %+v, want the process_start event with its raw event", res)
+	}
+
+	// closing the streams, as eolh does on shutdown, ends the call
+	manager.Close()
+	if _, err := stream.Recv(); err == nil {
+		t.Error("the stream is still open once the streams are closed")
+	}
+}
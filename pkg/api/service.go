@@ -0,0 +1,174 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+// Package api serves the eolh.api.v1.Eolh gRPC service, which streams the events and findings of a running eolh
+// to other processes, and lets them inspect and tune it.
+package api
+
+import (
+	"context"
+	"eolh/pkg/detect"
+	"eolh/pkg/metrics"
+	"eolh/pkg/rpc"
+	"eolh/pkg/streams"
+	"eolh/pkg/trace"
+
+	"google.golang.org/grpc"
+)
+
+const serviceName = "eolh.api.v1.Eolh"
+
+type StreamEventsRequest struct {
+	Filter streams.Filter `json:"filter"`
+	// IncludeRaw keeps the raw ETW events, which are stripped otherwise
+	IncludeRaw bool `json:"includeRaw,omitempty"`
+}
+
+type StreamEventsResponse struct {
+	// Finding tells whether the event was reported for a finding, its metadata then describes the signature
+	Finding bool        `json:"finding"`
+	Event   trace.Event `json:"event"`
+}
+
+type ListSignaturesRequest struct{}
+
+type Signature struct {
+	ID             string                          `json:"id"`
+	Name           string                          `json:"name"`
+	Version        string                          `json:"version"`
+	Description    string                          `json:"description"`
+	Tags           []string                        `json:"tags,omitempty"`
+	Properties     map[string]interface{}          `json:"properties,omitempty"`
+	SelectedEvents []detect.SignatureEventSelector `json:"selectedEvents"`
+}
+
+type ListSignaturesResponse struct {
+	Signatures []Signature `json:"signatures"`
+}
+
+type GetStatsRequest struct{}
+
+type GetStatsResponse struct {
+	Stats       metrics.Snapshot `json:"stats"`
+	Subscribers int              `json:"subscribers"`
+}
+
+type SetLogLevelRequest struct {
+	// Level is one of debug, info, warn and error
+	Level string `json:"level"`
+}
+
+type SetLogLevelResponse struct {
+	// Previous is the level before the request
+	Previous string `json:"previous"`
+}
+
+// EolhServer is the service served by eolh
+type EolhServer interface {
+	StreamEvents(*StreamEventsRequest, EolhStreamEventsServer) error
+	ListSignatures(context.Context, *ListSignaturesRequest) (*ListSignaturesResponse, error)
+	GetStats(context.Context, *GetStatsRequest) (*GetStatsResponse, error)
+	SetLogLevel(context.Context, *SetLogLevelRequest) (*SetLogLevelResponse, error)
+}
+
+type EolhStreamEventsServer interface {
+	Send(*StreamEventsResponse) error
+	grpc.ServerStream
+}
+
+type streamEventsServer struct {
+	grpc.ServerStream
+}
+
+func (s streamEventsServer) Send(res *StreamEventsResponse) error {
+	return s.ServerStream.SendMsg(res)
+}
+
+func streamEventsHandler(srv interface{}, stream grpc.ServerStream) error {
+	req := new(StreamEventsRequest)
+	if err := stream.RecvMsg(req); err != nil {
+		return err
+	}
+	return srv.(EolhServer).StreamEvents(req, streamEventsServer{stream})
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*EolhServer)(nil),
+	Methods: []grpc.MethodDesc{
+		rpc.UnaryMethod(serviceName, "ListSignatures", EolhServer.ListSignatures),
+		rpc.UnaryMethod(serviceName, "GetStats", EolhServer.GetStats),
+		rpc.UnaryMethod(serviceName, "SetLogLevel", EolhServer.SetLogLevel),
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamEvents",
+			Handler:       streamEventsHandler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "eolh/api/v1/eolh",
+}
+
+// RegisterEolhServer registers the eolh service on a gRPC server
+func RegisterEolhServer(s *grpc.Server, srv EolhServer) {
+	s.RegisterService(&serviceDesc, srv)
+}
+
+// Client calls the eolh service
+type Client struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewClient(cc grpc.ClientConnInterface) *Client {
+	return &Client{cc: cc}
+}
+
+func (c *Client) invoke(ctx context.Context, method string, req interface{}, res interface{}) error {
+	return c.cc.Invoke(ctx, "/"+serviceName+"/"+method, req, res, rpc.CallOption())
+}
+
+func (c *Client) ListSignatures(ctx context.Context, req *ListSignaturesRequest) (*ListSignaturesResponse, error) {
+	res := new(ListSignaturesResponse)
+	return res, c.invoke(ctx, "ListSignatures", req, res)
+}
+
+func (c *Client) GetStats(ctx context.Context, req *GetStatsRequest) (*GetStatsResponse, error) {
+	res := new(GetStatsResponse)
+	return res, c.invoke(ctx, "GetStats", req, res)
+}
+
+func (c *Client) SetLogLevel(ctx context.Context, req *SetLogLevelRequest) (*SetLogLevelResponse, error) {
+	res := new(SetLogLevelResponse)
+	return res, c.invoke(ctx, "SetLogLevel", req, res)
+}
+
+// EventStream receives the events of StreamEvents
+type EventStream struct {
+	stream grpc.ClientStream
+}
+
+func (s *EventStream) Recv() (*StreamEventsResponse, error) {
+	res := new(StreamEventsResponse)
+	if err := s.stream.RecvMsg(res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// StreamEvents subscribes to the events matching the filter of the request, until ctx is done
+func (c *Client) StreamEvents(ctx context.Context, req *StreamEventsRequest) (*EventStream, error) {
+	stream, err := c.cc.NewStream(ctx, &serviceDesc.Streams[0], "/"+serviceName+"/StreamEvents", rpc.CallOption())
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.SendMsg(req); err != nil {
+		return nil, err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return &EventStream{stream: stream}, nil
+}
@@ -11,6 +11,11 @@ import (
 	"eolh/pkg/cmd"
 	"eolh/pkg/cmd/flags"
 	"eolh/pkg/cmd/printer"
+	"eolh/pkg/etw"
+	"eolh/pkg/exclusions"
+	"eolh/pkg/signatures"
+	"eolh/pkg/tlsconfig"
+	"fmt"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -18,6 +23,12 @@ import (
 
 func GetEolhRunner(c *cobra.Command) (cmd.Runner, error) {
 	var runner cmd.Runner
+	if config := viper.GetString("config"); config != "" {
+		viper.SetConfigFile(config)
+		if err := viper.ReadInConfig(); err != nil {
+			return runner, fmt.Errorf("reading config %s: %w", config, err)
+		}
+	}
 	output, err := flags.PrepareOutput(viper.GetStringSlice("output"))
 	if err != nil {
 		return runner, err
@@ -29,7 +40,85 @@ func GetEolhRunner(c *cobra.Command) (cmd.Runner, error) {
 	runner.Printer = p
 	detect := viper.GetBool("detect")
 	runner.EolhConfig.Detect = detect
-	providers := flags.PrepareETW(viper.GetStringSlice("add"), viper.GetStringSlice("remove"))
+	var providerSpecs []flags.ProviderSpec
+	if err := viper.UnmarshalKey("providers", &providerSpecs); err != nil {
+		return runner, fmt.Errorf("reading providers: %w", err)
+	}
+	providers, err := flags.PrepareETW(viper.GetStringSlice("add"), viper.GetStringSlice("remove"), providerSpecs)
+	if err != nil {
+		return runner, err
+	}
 	runner.EolhConfig.Providers = providers
+	// the defaults are only replaced by a config file setting exclusions, an empty list excludes nothing
+	exclusionRules := exclusions.Defaults
+	if viper.IsSet("exclusions") {
+		exclusionRules = []exclusions.Rule{}
+		if err := viper.UnmarshalKey("exclusions", &exclusionRules); err != nil {
+			return runner, fmt.Errorf("reading exclusions: %w", err)
+		}
+	}
+	for _, rule := range exclusionRules {
+		if err := rule.Validate(); err != nil {
+			return runner, fmt.Errorf("reading exclusions: %w", err)
+		}
+	}
+	runner.EolhConfig.Exclusions = exclusionRules
+	rego, err := flags.PrepareRego(viper.GetStringSlice("rego"))
+	if err != nil {
+		return runner, err
+	}
+	runner.EolhConfig.Rego = rego
+	var overrides []signatures.Override
+	if err := viper.UnmarshalKey("signature-overrides", &overrides); err != nil {
+		return runner, fmt.Errorf("reading signature-overrides: %w", err)
+	}
+	selection, err := flags.PrepareSignatures(viper.GetStringSlice("signatures"), viper.GetStringSlice("exclude-signatures"), overrides)
+	if err != nil {
+		return runner, err
+	}
+	runner.EolhConfig.Selection = selection
+	bundles, err := flags.PrepareBundles(viper.GetStringSlice("signatures-bundle"), viper.GetString("signatures-bundle-key"))
+	if err != nil {
+		return runner, err
+	}
+	runner.EolhConfig.SignaturesBundles = bundles
+	runner.EolhConfig.SignaturesDirs = viper.GetStringSlice("signatures-dir")
+	runner.EolhConfig.PluginEndpoints = viper.GetStringSlice("signatures-plugin")
+	requireSigned := viper.GetBool("require-signed-signatures")
+	if requireSigned && (len(runner.EolhConfig.SignaturesDirs) > 0 || len(runner.EolhConfig.PluginEndpoints) > 0) {
+		return runner, fmt.Errorf("--require-signed-signatures rejects the unsigned signatures of --signatures-dir and --signatures-plugin, bundle them instead")
+	}
+	// unsigned rules are only searched next to the executable when no bundle is given
+	if len(runner.EolhConfig.SignaturesDirs) == 0 && len(bundles) == 0 && !requireSigned {
+		runner.EolhConfig.SignaturesDirs = signatures.DefaultDirs()
+	}
+	runner.EolhConfig.StrictSignatures = viper.GetBool("strict-signatures")
+	runner.EolhConfig.PluginTLS = tlsconfig.Files{
+		Cert: viper.GetString("signatures-plugin-tls-cert"),
+		Key:  viper.GetString("signatures-plugin-tls-key"),
+		CA:   viper.GetString("signatures-plugin-tls-ca"),
+	}
+	runner.EolhConfig.GRPCListenAddr = viper.GetString("grpc-listen-addr")
+	runner.EolhConfig.GRPCTLS = tlsconfig.Files{
+		Cert: viper.GetString("grpc-tls-cert"),
+		Key:  viper.GetString("grpc-tls-key"),
+		CA:   viper.GetString("grpc-tls-client-ca"),
+	}
+	runner.EolhConfig.Metrics = viper.GetBool("metrics")
+	runner.EolhConfig.Health = viper.GetBool("health")
+	runner.EolhConfig.PProf = viper.GetBool("pprof")
+	runner.EolhConfig.HashMaxSize = viper.GetInt64("hash-max-size")
+	runner.EolhConfig.NetFlowWindow = viper.GetDuration("net-flow-window")
+	runner.EolhConfig.Session = etw.SessionConfig{
+		Name:           viper.GetString("etw-session-name"),
+		BufferSize:     viper.GetUint32("etw-buffer-size"),
+		MinimumBuffers: viper.GetUint32("etw-min-buffers"),
+		MaximumBuffers: viper.GetUint32("etw-max-buffers"),
+	}
+	if err := runner.EolhConfig.Session.Validate(); err != nil {
+		return runner, err
+	}
+	runner.EolhConfig.HTTPListenAddr = viper.GetString("http-listen-addr")
+	runner.EolhConfig.PProfListenAddr = viper.GetString("pprof-listen-addr")
 	return runner, nil
 }
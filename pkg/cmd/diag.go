@@ -0,0 +1,56 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// diagTimeout bounds every request to the diagnostics endpoints
+const diagTimeout = 30 * time.Second
+
+// Diag fetches the diagnostics of an eolh running with --pprof, and writes the state of its pipeline followed by the
+// stacks of its goroutines
+func Diag(w io.Writer, addr string) error {
+	client := &http.Client{Timeout: diagTimeout}
+	diag, err := fetch(client, "http://"+addr+"/debug/diag")
+	if err != nil {
+		return err
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, diag, "", "  "); err != nil {
+		return fmt.Errorf("reading diagnostics: %w", err)
+	}
+	if _, err := fmt.Fprintf(w, "%s\n", indented.Bytes()); err != nil {
+		return err
+	}
+	goroutines, err := fetch(client, "http://"+addr+"/debug/pprof/goroutine?debug=2")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "\n%s", goroutines)
+	return err
+}
+
+func fetch(client *http.Client, url string) ([]byte, error) {
+	res, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s, is eolh running with --pprof?", url, res.Status)
+	}
+	return body, nil
+}
@@ -9,15 +9,29 @@ package cmd
 
 import (
 	"context"
+	"eolh/pkg/api"
+	"eolh/pkg/cmd/flags"
 	"eolh/pkg/cmd/printer"
 	"eolh/pkg/containers/runtime"
 	"eolh/pkg/detect"
 	"eolh/pkg/engine"
 	"eolh/pkg/etw"
+	"eolh/pkg/exclusions"
 	"eolh/pkg/logger"
+	"eolh/pkg/metrics"
+	"eolh/pkg/server/http"
 	"eolh/pkg/signatures"
+	"eolh/pkg/signatures/bundle"
+	"eolh/pkg/signatures/regosig"
+	"eolh/pkg/streams"
+	"eolh/pkg/tlsconfig"
 	"eolh/pkg/trace"
+	"fmt"
+	"net"
 	"os"
+	"time"
+
+	"google.golang.org/grpc"
 )
 
 type Event = etw.Event
@@ -35,7 +49,37 @@ func IsPe(bytesArray []byte) bool {
 type Config struct {
 	ChanEvents chan trace.Event
 	Detect     bool
-	Providers  []string
+	Providers  []etw.Provider
+	Rego       regosig.Options
+	Selection  signatures.Selection
+	// SignaturesDirs are searched for Rego and Sigma signatures besides the embedded ones
+	SignaturesDirs    []string
+	SignaturesBundles []*bundle.Bundle
+	StrictSignatures  bool
+	// PluginEndpoints serve signatures from out of process plugins
+	PluginEndpoints []string
+	// PluginTLS secures the tcp:// plugins, which require it unless they are on loopback
+	PluginTLS tlsconfig.Files
+	// GRPCListenAddr is the endpoint of the gRPC API, which is disabled when empty
+	GRPCListenAddr string
+	// GRPCTLS secures the gRPC API on tcp:// endpoints, the client certificates being verified when its CA is set
+	GRPCTLS tlsconfig.Files
+	// Metrics and Health enable the endpoints of the HTTP server listening on HTTPListenAddr
+	Metrics        bool
+	Health         bool
+	HTTPListenAddr string
+	// PProf serves the profiles and the diagnostics on PProfListenAddr, which must be a loopback address as they
+	// aren't authenticated
+	PProf           bool
+	PProfListenAddr string
+	// HashMaxSize is the size of the largest executable hashed
+	HashMaxSize int64
+	// NetFlowWindow is how long network events are aggregated into flows, 0 disables the aggregation
+	NetFlowWindow time.Duration
+	// Exclusions are the rules excluding the events of noisy processes
+	Exclusions []exclusions.Rule
+	// Session configures the ETW session the events are consumed from
+	Session etw.SessionConfig
 }
 
 type Runner struct {
@@ -43,7 +87,7 @@ type Runner struct {
 	Printer    printer.EventPrinter
 }
 
-func (r Runner) Run(ctx context.Context) {
+func (r Runner) Run(ctx context.Context) error {
 	sockets := runtime.Autodiscover(func(err error, runtime runtime.RuntimeId, socket string) {
 		if err != nil {
 			logger.Debugw("RuntimeSockets: failed to register default", "socket", runtime.String(), "error", err)
@@ -51,7 +95,27 @@ func (r Runner) Run(ctx context.Context) {
 			logger.Debugw("RuntimeSockets: registered default", "socket", runtime.String(), "from", socket)
 		}
 	})
-	sigs, _ := signatures.Find()
+	regoConfig := r.EolhConfig.Rego
+	regoConfig.Select = r.EolhConfig.Selection.Selected
+	sigs, err := signatures.Find(signatures.Config{
+		Dirs:    r.EolhConfig.SignaturesDirs,
+		Bundles: r.EolhConfig.SignaturesBundles,
+		Strict:  r.EolhConfig.StrictSignatures,
+		Rego:    regoConfig,
+	})
+	if err != nil {
+		return fmt.Errorf("loading signatures: %w", err)
+	}
+	stats := &metrics.Stats{}
+	pluginSigs, err := flags.PreparePlugins(r.EolhConfig.PluginEndpoints, r.EolhConfig.PluginTLS, &stats.PluginDroppedCount)
+	if err != nil {
+		return fmt.Errorf("loading plugin signatures: %w", err)
+	}
+	sigs = append(sigs, pluginSigs...)
+	sigs, err = r.EolhConfig.Selection.Apply(sigs)
+	if err != nil {
+		return fmt.Errorf("selecting signatures: %w", err)
+	}
 	enabled := true
 	if !r.EolhConfig.Detect {
 		enabled = false
@@ -61,47 +125,171 @@ func (r Runner) Run(ctx context.Context) {
 		Signatures:          sigs,
 		SignatureBufferSize: 1000,
 		DataSources:         []detect.DataSource{},
+		TickInterval:        time.Minute,
+	}
+	channels := &metrics.Channels{}
+	var eventStreams *streams.Manager
+	if r.EolhConfig.GRPCListenAddr != "" {
+		eventStreams = streams.NewManager(stats)
 	}
 	config := etw.Config{
-		Sockets:      sockets,
-		EngineConfig: engineConfig,
-		ChanEvents:   make(chan trace.Event, 1000),
-		Providers:    r.EolhConfig.Providers,
+		Sockets:       sockets,
+		EngineConfig:  engineConfig,
+		ChanEvents:    make(chan trace.Event, 1000),
+		Providers:     r.EolhConfig.Providers,
+		HashMaxSize:   r.EolhConfig.HashMaxSize,
+		NetFlowWindow: r.EolhConfig.NetFlowWindow,
+		Session:       r.EolhConfig.Session,
+		Exclusions:    r.EolhConfig.Exclusions,
+		Stats:         stats,
+		Streams:       eventStreams,
+		Channels:      channels,
 	}
 	eolh := etw.New(config)
-	err := eolh.Init()
-	if err != nil {
-		logger.Errorw("Failed to initialize Eolh ", err.Error())
-		return
+	if err := eolh.Init(); err != nil {
+		return fmt.Errorf("initializing eolh: %w", err)
+	}
+	// stops the ETW session if the servers fail to start, Run closes it otherwise
+	defer eolh.Close()
+	if r.EolhConfig.GRPCListenAddr != "" {
+		creds, err := ServerCredentials(r.EolhConfig.GRPCListenAddr, r.EolhConfig.GRPCTLS)
+		if err != nil {
+			return fmt.Errorf("securing the gRPC API: %w", err)
+		}
+		var opts []grpc.ServerOption
+		if creds != nil {
+			opts = append(opts, grpc.Creds(creds))
+		}
+		lis, err := Listen(r.EolhConfig.GRPCListenAddr)
+		if err != nil {
+			return fmt.Errorf("listening for the gRPC API: %w", err)
+		}
+		server := api.NewServer(sigs, stats, eventStreams, opts...)
+		go func() {
+			if err := server.Serve(lis); err != nil {
+				logger.Errorw("Serving the gRPC API", "error", err)
+			}
+		}()
+		defer server.Stop()
+		logger.Infow("Serving the gRPC API", "endpoint", r.EolhConfig.GRPCListenAddr)
+	}
+	if r.EolhConfig.Metrics || r.EolhConfig.Health {
+		server, err := r.httpServer(eolh, stats, eventStreams)
+		if err != nil {
+			return err
+		}
+		lis, err := net.Listen("tcp", r.EolhConfig.HTTPListenAddr)
+		if err != nil {
+			return fmt.Errorf("listening for the HTTP server: %w", err)
+		}
+		go func() {
+			if err := server.Serve(lis); err != nil {
+				logger.Errorw("Serving HTTP", "error", err)
+			}
+		}()
+		defer server.Shutdown()
+		logger.Infow("Serving HTTP", "address", r.EolhConfig.HTTPListenAddr)
+	}
+	if r.EolhConfig.PProf {
+		lis, err := listenPProf(r.EolhConfig.PProfListenAddr)
+		if err != nil {
+			return err
+		}
+		server := http.New()
+		server.EnablePProfEndpoints()
+		server.EnableDiagEndpoint(func() interface{} {
+			return eolh.Diagnostics()
+		})
+		go func() {
+			if err := server.Serve(lis); err != nil {
+				logger.Errorw("Serving pprof", "error", err)
+			}
+		}()
+		defer server.Shutdown()
+		logger.Infow("Serving pprof", "address", r.EolhConfig.PProfListenAddr)
 	}
 	printerConfig := printer.PrinterConfig{
 		Kind:    "json",
 		OutFile: os.Stdout,
+		Stats:   stats,
 	}
 	pConfigs := [1]printer.PrinterConfig{printerConfig}
 	p, err := printer.NewBroadcast(pConfigs[:], printer.ContainerModeEnabled)
 	if err != nil {
-		logger.Errorw(err.Error())
-		return
+		return fmt.Errorf("creating the printer: %w", err)
 	}
+	p.TrackChannels(channels)
+	printCtx, stopPrinting := context.WithCancel(ctx)
+	printed := make(chan struct{})
 	go func() {
+		defer close(printed)
 		for {
 			select {
 			case event := <-config.ChanEvents:
 				p.Print(event)
-			case <-ctx.Done():
+			case <-printCtx.Done():
 				return
 			}
 		}
 	}()
-	eolh.Run(ctx)
+	err = eolh.Run(ctx)
+	stopPrinting()
+	<-printed
+	// the events left are printed even if eolh failed
 	for {
 		select {
 		case event := <-config.ChanEvents:
 			p.Print(event)
 		default:
 			p.Close()
-			return
+			if err != nil {
+				return fmt.Errorf("running eolh: %w", err)
+			}
+			return nil
+		}
+	}
+}
+
+// httpServer creates the HTTP server with the enabled endpoints
+func (r Runner) httpServer(eolh *etw.Eolh, stats *metrics.Stats, eventStreams *streams.Manager) (*http.Server, error) {
+	server := http.New()
+	if r.EolhConfig.Metrics {
+		collector := metrics.NewCollector(stats)
+		collector.ContainerCount = eolh.ContainerCount
+		if eventStreams != nil {
+			collector.Subscribers = eventStreams.Subscribers
+		}
+		if err := server.EnableMetricsEndpoint(collector); err != nil {
+			return nil, fmt.Errorf("enabling the metrics endpoint: %w", err)
 		}
 	}
+	if r.EolhConfig.Health {
+		liveness := make(map[string]http.Check)
+		for name, check := range eolh.HealthChecks() {
+			liveness[name] = check
+		}
+		readiness := make(map[string]http.Check)
+		for name, check := range eolh.ReadinessChecks() {
+			readiness[name] = check
+		}
+		server.EnableHealthEndpoints(liveness, readiness)
+	}
+	return server, nil
+}
+
+// listenPProf listens for the pprof and diagnostics endpoints, which expose the process to anyone reaching them and
+// are thus only served on loopback
+func listenPProf(addr string) (net.Listener, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pprof address %s: %w", addr, err)
+	}
+	if !tlsconfig.Loopback(host) {
+		return nil, fmt.Errorf("pprof address %s is reachable from the network, listen on 127.0.0.1", addr)
+	}
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("listening for pprof: %w", err)
+	}
+	return lis, nil
 }
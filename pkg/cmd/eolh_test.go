@@ -0,0 +1,36 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+package cmd
+
+import "testing"
+
+func TestListenPProf(t *testing.T) {
+	tests := []struct {
+		addr      string
+		wantError bool
+	}{
+		{addr: "127.0.0.1:0"},
+		{addr: "localhost:0"},
+		{addr: ":0", wantError: true},
+		{addr: "0.0.0.0:0", wantError: true},
+		{addr: "192.0.2.1:0", wantError: true},
+		{addr: "127.0.0.1", wantError: true},
+	}
+	for _, tt := range tests {
+		lis, err := listenPProf(tt.addr)
+		if tt.wantError {
+			if err == nil {
+				lis.Close()
+				t.Errorf("listenPProf(%q) didn't fail", tt.addr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("listenPProf(%q): %v", tt.addr, err)
+			continue
+		}
+		lis.Close()
+	}
+}
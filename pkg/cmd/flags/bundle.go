@@ -0,0 +1,36 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+package flags
+
+import (
+	"eolh/pkg/logger"
+	"eolh/pkg/signatures/bundle"
+	"fmt"
+)
+
+// PrepareBundles opens the signature bundles, verifying them against the public key.
+// The signature of a bundle is read from the bundle path followed by bundle.SignatureSuffix.
+func PrepareBundles(bundleSlice []string, keyPath string) ([]*bundle.Bundle, error) {
+	if len(bundleSlice) == 0 {
+		return nil, nil
+	}
+	if keyPath == "" {
+		return nil, fmt.Errorf("signature bundles need a public key, use --signatures-bundle-key")
+	}
+	key, err := bundle.LoadPublicKey(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("loading bundle key: %w", err)
+	}
+	bundles := make([]*bundle.Bundle, 0, len(bundleSlice))
+	for _, path := range bundleSlice {
+		b, err := bundle.Open(path, path+bundle.SignatureSuffix, key)
+		if err != nil {
+			return nil, fmt.Errorf("loading signature bundle: %w", err)
+		}
+		logger.Infow("Loaded signature bundle", "bundle", b.String(), "path", path)
+		bundles = append(bundles, b)
+	}
+	return bundles, nil
+}
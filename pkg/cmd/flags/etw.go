@@ -4,19 +4,205 @@ Licensed under Apache License 2.0, see LICENCE.
 */
 package flags
 
-import "slices"
+import (
+	"eolh/pkg/etw"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
 
-func PrepareETW(addSlice []string, removeSlice []string) []string {
-	etwProviders := []string{}
-	if !slices.Contains(removeSlice, "file") {
-		etwProviders = append(etwProviders, "Microsoft-Windows-Kernel-File")
+	getw "local.packages/golang-etw/etw"
+)
+
+// ProviderDefinition describes an ETW provider known to eolh
+type ProviderDefinition struct {
+	// Category is the name used to disable a default provider with --remove, or to enable an optional one with --add
+	Category    string `json:"category"`
+	Name        string `json:"name"`
+	Default     bool   `json:"default"`
+	Level       uint8  `json:"level"`
+	Keywords    uint64 `json:"keywords"` // MatchAnyKeyword, 0 enables every keyword
+	Description string `json:"description"`
+}
+
+// Keywords of Microsoft-Windows-Kernel-File
+const (
+	kernelFileKeywordFileIO        = 0x20
+	kernelFileKeywordCreate        = 0x80
+	kernelFileKeywordWrite         = 0x200
+	kernelFileKeywordDeletePath    = 0x400
+	kernelFileKeywordRenamePath    = 0x800
+	kernelFileKeywordCreateNewFile = 0x1000
+
+	// kernelFileKeywords are the default file events, reads are left out for their volume and closes come with the
+	// other I/O events
+	kernelFileKeywords = kernelFileKeywordFileIO | kernelFileKeywordCreate | kernelFileKeywordWrite |
+		kernelFileKeywordDeletePath | kernelFileKeywordRenamePath | kernelFileKeywordCreateNewFile
+)
+
+// ProviderDefinitions are the default providers, and the optional ones which may be enabled with --add
+var ProviderDefinitions = []ProviderDefinition{
+	{
+		Category:    "file",
+		Name:        "Microsoft-Windows-Kernel-File",
+		Default:     true,
+		Level:       0xff,
+		Keywords:    kernelFileKeywords,
+		Description: "File creation, writes, closes, renames and deletion",
+	},
+	{
+		Category:    "network",
+		Name:        "Microsoft-Windows-Kernel-Network",
+		Default:     true,
+		Level:       0xff,
+		Description: "TCP and UDP traffic over IPv4 and IPv6",
+	},
+	{
+		Category:    "process",
+		Name:        "Microsoft-Windows-Kernel-Process",
+		Default:     true,
+		Level:       0xff,
+		Description: "Process, thread and image lifecycle",
+	},
+	{
+		Category:    "registry",
+		Name:        "Microsoft-Windows-Kernel-Registry",
+		Level:       0xff,
+		Description: "Registry key and value operations",
+	},
+	{
+		Category:    "dns",
+		Name:        "Microsoft-Windows-DNS-Client",
+		Level:       0xff,
+		Description: "DNS queries and responses",
+	},
+	{
+		Category:    "powershell",
+		Name:        "Microsoft-Windows-PowerShell",
+		Level:       0xff,
+		Description: "PowerShell module and script block logging",
+	},
+}
+
+func (def ProviderDefinition) provider() (etw.Provider, error) {
+	p, err := resolveProvider(def.Name)
+	if err != nil {
+		return etw.Provider{}, err
+	}
+	p.EnableLevel = def.Level
+	p.MatchAnyKeyword = def.Keywords
+	return etw.Provider{Provider: p}, nil
+}
+
+// ProviderSpec configures a provider in the providers list of the config file
+type ProviderSpec struct {
+	// Name is the name or the GUID of the provider, or the category of a known one such as file
+	Name string `mapstructure:"name"`
+	// Level is the most verbose level of the events, 255 when 0
+	Level uint8 `mapstructure:"level"`
+	// AnyKeywords enables the events matching any of the keywords, 0 matches every keyword
+	AnyKeywords uint64 `mapstructure:"any-keywords"`
+	// AllKeywords enables the events matching all of the keywords
+	AllKeywords uint64 `mapstructure:"all-keywords"`
+	// EventIDs only enables the events with these IDs, all of them when empty
+	EventIDs []uint16 `mapstructure:"event-ids"`
+	// StackTrace is rejected, the ETW session can't collect the call stack of the events
+	StackTrace bool `mapstructure:"stack-trace"`
+}
+
+// resolveProvider finds a provider from its category, name or GUID, --add also accepts the name:level:keywords syntax
+func resolveProvider(name string) (getw.Provider, error) {
+	for _, def := range ProviderDefinitions {
+		if def.Category == name {
+			name = def.Name
+		}
+	}
+	p, err := getw.ParseProvider(name)
+	if err != nil {
+		return p, fmt.Errorf("unknown ETW provider %q, see 'eolh list providers' or use its GUID: %w", name, err)
+	}
+	return p, nil
+}
+
+func (s ProviderSpec) provider() (etw.Provider, error) {
+	if s.Name == "" {
+		return etw.Provider{}, errors.New("provider without name")
+	}
+	if strings.ContainsAny(s.Name, ":|") {
+		return etw.Provider{}, fmt.Errorf("invalid provider name %q, set its level, keywords and event IDs in their own fields", s.Name)
+	}
+	level := s.Level
+	if level == 0 {
+		level = 0xff
+	}
+	if s.StackTrace {
+		return etw.Provider{}, fmt.Errorf("stack traces are not supported for provider %s, remove stack-trace", s.Name)
+	}
+	if level > 5 && level != 0xff {
+		return etw.Provider{}, fmt.Errorf("invalid level %d for provider %s, use a value between 1 and 5, or 255", s.Level, s.Name)
+	}
+	p, err := resolveProvider(s.Name)
+	if err != nil {
+		return etw.Provider{}, err
+	}
+	p.EnableLevel = level
+	p.MatchAnyKeyword = s.AnyKeywords
+	p.MatchAllKeyword = s.AllKeywords
+	p.Filter = s.EventIDs
+	return etw.Provider{Provider: p}, nil
+}
+
+// PrepareETW returns the default providers but the removed categories, the added ones, and the providers of the config
+// file. Added providers are categories such as dns, or provider names and GUIDs. The config file providers replace the
+// default and added ones with the same GUID.
+func PrepareETW(addSlice []string, removeSlice []string, specs []ProviderSpec) ([]etw.Provider, error) {
+	for _, r := range removeSlice {
+		if !slices.ContainsFunc(ProviderDefinitions, func(def ProviderDefinition) bool { return def.Default && def.Category == r }) {
+			return nil, fmt.Errorf("invalid --remove value %q, use one of process, file and network", r)
+		}
+	}
+	var providers []etw.Provider
+	add := func(p etw.Provider) {
+		for i := range providers {
+			if strings.EqualFold(providers[i].GUID, p.GUID) {
+				providers[i] = p
+				return
+			}
+		}
+		providers = append(providers, p)
+	}
+	for _, def := range ProviderDefinitions {
+		if !def.Default || slices.Contains(removeSlice, def.Category) {
+			continue
+		}
+		p, err := def.provider()
+		if err != nil {
+			return nil, err
+		}
+		add(p)
 	}
-	if !slices.Contains(removeSlice, "network") {
-		etwProviders = append(etwProviders, "Microsoft-Windows-Kernel-Network")
+	for _, a := range addSlice {
+		// known categories are enabled with the level and keywords of their definition
+		if i := slices.IndexFunc(ProviderDefinitions, func(def ProviderDefinition) bool { return def.Category == a }); i >= 0 {
+			p, err := ProviderDefinitions[i].provider()
+			if err != nil {
+				return nil, err
+			}
+			add(p)
+			continue
+		}
+		p, err := resolveProvider(a)
+		if err != nil {
+			return nil, err
+		}
+		add(etw.Provider{Provider: p})
 	}
-	if !slices.Contains(removeSlice, "process") {
-		etwProviders = append(etwProviders, "Microsoft-Windows-Kernel-Process")
+	for i, spec := range specs {
+		p, err := spec.provider()
+		if err != nil {
+			return nil, fmt.Errorf("providers[%d]: %w", i, err)
+		}
+		add(p)
 	}
-	etwProviders = append(etwProviders, addSlice...)
-	return etwProviders
+	return providers, nil
 }
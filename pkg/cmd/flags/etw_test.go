@@ -0,0 +1,79 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+package flags
+
+import (
+	"eolh/pkg/etw"
+	"strings"
+	"testing"
+)
+
+func TestPrepareETWErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		add    []string
+		remove []string
+		specs  []ProviderSpec
+		err    string
+	}{
+		{name: "level", specs: []ProviderSpec{{Name: "dns", Level: 6}}, err: "invalid level 6"},
+		{name: "name with level", specs: []ProviderSpec{{Name: "dns:4"}}, err: "invalid provider name"},
+		{name: "name with filter", specs: []ProviderSpec{{Name: "dns|1"}}, err: "invalid provider name"},
+		{name: "no name", specs: []ProviderSpec{{Level: 4}}, err: "provider without name"},
+		{name: "stack trace", specs: []ProviderSpec{{Name: "process", StackTrace: true}}, err: "stack traces are not supported"},
+		{name: "unknown spec", specs: []ProviderSpec{{Name: "Unknown-Provider"}}, err: "unknown ETW provider"},
+		{name: "unknown add", add: []string{"Unknown-Provider"}, err: "unknown ETW provider"},
+		{name: "remove optional", remove: []string{"dns"}, err: "invalid --remove value"},
+		{name: "remove unknown", remove: []string{"bogus"}, err: "invalid --remove value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := PrepareETW(tt.add, tt.remove, tt.specs)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("PrepareETW() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestPrepareETWAddCategory(t *testing.T) {
+	providers, err := PrepareETW([]string{"file", "dns"}, []string{"file", "network", "process"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		name     string
+		keywords uint64
+	}{
+		{name: "Microsoft-Windows-Kernel-File", keywords: kernelFileKeywords},
+		{name: "Microsoft-Windows-DNS-Client"},
+	}
+	if len(providers) != len(want) {
+		t.Fatalf("got %d providers, want %d", len(providers), len(want))
+	}
+	for i, w := range want {
+		p := providers[i]
+		if !strings.EqualFold(p.Name, w.name) || p.EnableLevel != 0xff || p.MatchAnyKeyword != w.keywords {
+			t.Errorf("providers[%d] = %s level %d keywords %#x, want %s level 255 keywords %#x",
+				i, p.Name, p.EnableLevel, p.MatchAnyKeyword, w.name, w.keywords)
+		}
+	}
+}
+
+func TestPrepareETWSpecReplacesDefault(t *testing.T) {
+	providers, err := PrepareETW(nil, nil, []ProviderSpec{{Name: "file", Level: 4, AnyKeywords: kernelFileKeywordCreate}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []etw.Provider
+	for _, p := range providers {
+		if strings.EqualFold(p.Name, "Microsoft-Windows-Kernel-File") {
+			files = append(files, p)
+		}
+	}
+	if len(files) != 1 || files[0].EnableLevel != 4 || files[0].MatchAnyKeyword != kernelFileKeywordCreate {
+		t.Errorf("Kernel-File providers = %+v, want one of level 4 and keywords %#x", files, kernelFileKeywordCreate)
+	}
+}
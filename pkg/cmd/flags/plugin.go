@@ -0,0 +1,76 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+package flags
+
+import (
+	"eolh/pkg/containers/runtime"
+	"eolh/pkg/detect"
+	"eolh/pkg/logger"
+	"eolh/pkg/signatures/plugin"
+	"eolh/pkg/tlsconfig"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// PreparePlugins connects to the signature plugins listening on the endpoints, npipe:// or tcp:// URLs,
+// and returns their signatures. tcp:// plugins are verified with TLS unless they listen on loopback, dropped counts
+// the events the plugins were too slow for.
+func PreparePlugins(endpointSlice []string, files tlsconfig.Files, dropped *atomic.Uint64) ([]detect.Signature, error) {
+	var sigs []detect.Signature
+	for _, endpoint := range endpointSlice {
+		addr, dialer, err := runtime.GetAddressAndDialer(endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("invalid plugin endpoint %s: %w", endpoint, err)
+		}
+		creds, err := pluginCredentials(endpoint, addr, files)
+		if err != nil {
+			return nil, err
+		}
+		conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(creds), grpc.WithContextDialer(dialer))
+		if err != nil {
+			return nil, fmt.Errorf("connecting to plugin %s: %w", endpoint, err)
+		}
+		pluginSigs, err := plugin.Load(conn, dropped)
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s: %w", endpoint, err)
+		}
+		logger.Infow("Loaded signature plugin", "endpoint", endpoint, "signatures", len(pluginSigs))
+		sigs = append(sigs, pluginSigs...)
+	}
+	return sigs, nil
+}
+
+// pluginCredentials returns the credentials of a plugin endpoint. Named pipes don't use TLS, tcp:// endpoints require
+// it unless they are on loopback.
+func pluginCredentials(endpoint, addr string, files tlsconfig.Files) (credentials.TransportCredentials, error) {
+	if !strings.HasPrefix(endpoint, "tcp://") {
+		if !files.Empty() {
+			return nil, fmt.Errorf("TLS only applies to tcp:// plugins, not to %s", endpoint)
+		}
+		return insecure.NewCredentials(), nil
+	}
+	if files.Empty() {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid plugin endpoint %s: %w", endpoint, err)
+		}
+		if !tlsconfig.Loopback(host) {
+			return nil, fmt.Errorf("plugin %s is reachable from the network, set the certificate authority of its TLS certificate", endpoint)
+		}
+		return insecure.NewCredentials(), nil
+	}
+	config, err := tlsconfig.Client(files)
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s: %w", endpoint, err)
+	}
+	return credentials.NewTLS(config), nil
+}
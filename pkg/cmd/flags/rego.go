@@ -0,0 +1,46 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+package flags
+
+import (
+	"eolh/pkg/signatures/regosig"
+	"fmt"
+	"strings"
+
+	"github.com/open-policy-agent/opa/compile"
+)
+
+func PrepareRego(regoSlice []string) (regosig.Options, error) {
+	regoConfig := regosig.Options{
+		Target: compile.TargetRego,
+	}
+	for _, o := range regoSlice {
+		regoParts := strings.SplitN(o, "=", 2)
+		switch regoParts[0] {
+		case "partial-eval":
+			regoConfig.PartialEval = true
+		case "aio":
+			regoConfig.AIO = true
+		case "runtime-target":
+			if len(regoParts) != 2 {
+				return regoConfig, fmt.Errorf("missing runtime target, use '--rego help' for more info")
+			}
+			switch regoParts[1] {
+			case compile.TargetRego:
+				regoConfig.Target = regoParts[1]
+			case compile.TargetWasm:
+				if !regosig.WasmAvailable {
+					return regoConfig, fmt.Errorf("runtime target wasm is not available, eolh was built without the opa_wasm tag")
+				}
+				regoConfig.Target = regoParts[1]
+			default:
+				return regoConfig, fmt.Errorf("invalid runtime target: %s, use '--rego help' for more info", regoParts[1])
+			}
+		default:
+			return regoConfig, fmt.Errorf("invalid rego option: %s, use '--rego help' for more info", regoParts[0])
+		}
+	}
+	return regoConfig, nil
+}
@@ -0,0 +1,41 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+package flags
+
+import (
+	"eolh/pkg/signatures"
+	"fmt"
+	"strings"
+)
+
+func PrepareSignatures(includeSlice []string, excludeSlice []string, overrides []signatures.Override) (signatures.Selection, error) {
+	selection := signatures.Selection{
+		Include:   splitList(includeSlice),
+		Exclude:   splitList(excludeSlice),
+		Overrides: overrides,
+	}
+	for _, o := range overrides {
+		if o.ID == "" {
+			return selection, fmt.Errorf("signature override without id")
+		}
+		if o.Severity != nil && (*o.Severity < 0 || *o.Severity > 4) {
+			return selection, fmt.Errorf("invalid severity for signature %s: %d, use a value between 0 and 4", o.ID, *o.Severity)
+		}
+	}
+	return selection, nil
+}
+
+// splitList accepts both repeated flags and comma separated values
+func splitList(values []string) []string {
+	var list []string
+	for _, v := range values {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
@@ -0,0 +1,148 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"eolh/pkg/cmd/flags"
+	"eolh/pkg/detect"
+	"eolh/pkg/events"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// SignatureInfo describes a loaded signature for eolh list
+type SignatureInfo struct {
+	ID             string                          `json:"id"`
+	Name           string                          `json:"name"`
+	Version        string                          `json:"version"`
+	Severity       interface{}                     `json:"severity,omitempty"`
+	Description    string                          `json:"description"`
+	SelectedEvents []detect.SignatureEventSelector `json:"selectedEvents"`
+	Source         string                          `json:"source,omitempty"`
+}
+
+// EventInfo describes an event definition for eolh list
+type EventInfo struct {
+	ID       events.ID `json:"id"`
+	Name     string    `json:"name"`
+	Provider string    `json:"provider"`
+	EtwID    uint16    `json:"etwId"`
+	Sets     []string  `json:"sets"`
+	Args     []string  `json:"args"`
+}
+
+// sourced is implemented by signatures loaded from a file
+type sourced interface {
+	Source() string
+}
+
+// Signatures describes the signatures, sorted by ID
+func Signatures(sigs []detect.Signature) ([]SignatureInfo, error) {
+	var infos []SignatureInfo
+	for _, sig := range sigs {
+		metadata, err := sig.GetMetadata()
+		if err != nil {
+			return nil, err
+		}
+		selectedEvents, err := sig.GetSelectedEvents()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", metadata.ID, err)
+		}
+		info := SignatureInfo{
+			ID:             metadata.ID,
+			Name:           metadata.Name,
+			Version:        metadata.Version,
+			Severity:       metadata.Properties["Severity"],
+			Description:    metadata.Description,
+			SelectedEvents: selectedEvents,
+		}
+		if s, ok := sig.(sourced); ok {
+			info.Source = s.Source()
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ID < infos[j].ID
+	})
+	return infos, nil
+}
+
+// Events describes the event definitions, sorted by ID
+func Events() []EventInfo {
+	infos := make([]EventInfo, 0, len(events.Definitions))
+	for id, def := range events.Definitions {
+		info := EventInfo{
+			ID:       id,
+			Name:     def.Name,
+			Provider: def.Provider,
+			EtwID:    def.EtwID,
+			Sets:     def.Sets,
+		}
+		for _, param := range def.Params {
+			info.Args = append(info.Args, param.Type+" "+param.Name)
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ID < infos[j].ID
+	})
+	return infos
+}
+
+// PrintList prints the output of eolh list in the given format, table or json
+func PrintList(w io.Writer, format string, list interface{}) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(list)
+	case "table":
+	default:
+		return fmt.Errorf("invalid format: %s, use table or json", format)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	switch l := list.(type) {
+	case []SignatureInfo:
+		fmt.Fprintln(tw, "ID\tNAME\tVERSION\tSEVERITY\tSELECTED EVENTS\tSOURCE")
+		for _, s := range l {
+			severity := ""
+			if s.Severity != nil {
+				severity = fmt.Sprint(s.Severity)
+			}
+			var selected []string
+			for _, e := range s.SelectedEvents {
+				selected = append(selected, e.Source+":"+e.Name)
+			}
+			source := s.Source
+			if source == "" {
+				source = "builtin"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", s.ID, s.Name, s.Version, severity, strings.Join(selected, ","), source)
+		}
+	case []EventInfo:
+		fmt.Fprintln(tw, "ID\tNAME\tPROVIDER\tETW ID\tSETS\tARGS")
+		for _, e := range l {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%d\t%s\t%s\n", e.ID, e.Name, e.Provider, e.EtwID, strings.Join(e.Sets, ","), strings.Join(e.Args, ", "))
+		}
+	case []flags.ProviderDefinition:
+		fmt.Fprintln(tw, "CATEGORY\tNAME\tDEFAULT\tLEVEL\tKEYWORDS\tDESCRIPTION")
+		for _, p := range l {
+			// providers enable every keyword when none is set
+			keywords := "any"
+			if p.Keywords != 0 {
+				keywords = fmt.Sprintf("0x%x", p.Keywords)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%t\t0x%x\t%s\t%s\n", p.Category, p.Name, p.Default, p.Level, keywords, p.Description)
+		}
+	default:
+		return fmt.Errorf("unsupported list: %T", list)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,137 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"eolh/pkg/detect"
+	"eolh/pkg/events"
+	"eolh/pkg/signatures"
+	"strings"
+	"testing"
+)
+
+// fileSignature is a signature loaded from a file
+type fileSignature struct {
+	*signatures.FakeSignature
+	source string
+}
+
+func (s fileSignature) Source() string {
+	return s.source
+}
+
+func fakeSignature(id string, severity interface{}) *signatures.FakeSignature {
+	return &signatures.FakeSignature{
+		FakeGetMetadata: func() (detect.SignatureMetadata, error) {
+			return detect.SignatureMetadata{
+				ID:         id,
+				Name:       "Test " + id,
+				Version:    "1",
+				Properties: map[string]interface{}{"Severity": severity},
+			}, nil
+		},
+		FakeGetSelectedEvents: func() ([]detect.SignatureEventSelector, error) {
+			return []detect.SignatureEventSelector{{Source: "eolh", Name: "process_start"}, {Source: "eolh", Name: "process_stop"}}, nil
+		},
+	}
+}
+
+func TestSignatures(t *testing.T) {
+	sigs := []detect.Signature{
+		fileSignature{FakeSignature: fakeSignature("TEST-2", nil), source: `C:\rules\test.rego`},
+		fakeSignature("TEST-1", 3),
+	}
+	infos, err := Signatures(sigs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 2 || infos[0].ID != "TEST-1" || infos[1].ID != "TEST-2" {
+		t.Fatalf("signatures = %+v, want TEST-1 then TEST-2", infos)
+	}
+	if infos[0].Source != "" || infos[1].Source != `C:\rules\test.rego` {
+		t.Errorf("sources = %q, %q, want none for the builtin one", infos[0].Source, infos[1].Source)
+	}
+
+	var table bytes.Buffer
+	if err := PrintList(&table, "table", infos); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"ID      NAME         VERSION  SEVERITY  SELECTED EVENTS                       SOURCE",
+		"TEST-1  Test TEST-1  1        3         eolh:process_start,eolh:process_stop  builtin",
+		`TEST-2  Test TEST-2  1                  eolh:process_start,eolh:process_stop  C:\rules\test.rego`,
+	}
+	if got := strings.Split(strings.TrimSpace(table.String()), "\n"); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("table =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	var out bytes.Buffer
+	if err := PrintList(&out, "json", infos); err != nil {
+		t.Fatal(err)
+	}
+	var decoded []map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != 2 {
+		t.Fatalf("json = %s, want 2 signatures", out.String())
+	}
+	// builtin signatures have no source
+	if _, ok := decoded[0]["source"]; ok {
+		t.Errorf("json = %v, want no source for TEST-1", decoded[0])
+	}
+	if decoded[1]["source"] != `C:\rules\test.rego` || decoded[0]["severity"] != 3.0 {
+		t.Errorf("json = %s, want the source of TEST-2 and the severity of TEST-1", out.String())
+	}
+}
+
+func TestEvents(t *testing.T) {
+	infos := Events()
+	if len(infos) != len(events.Definitions) {
+		t.Fatalf("got %d events, want %d", len(infos), len(events.Definitions))
+	}
+	for i := 1; i < len(infos); i++ {
+		if infos[i-1].ID >= infos[i].ID {
+			t.Fatalf("events aren't sorted by ID: %d before %d", infos[i-1].ID, infos[i].ID)
+		}
+	}
+	start := infos[0]
+	if start.ID != events.ProcessStart || start.Name != "process_start" || start.EtwID != 1 || len(start.Args) == 0 || start.Args[0] != "uint32 ProcessID" {
+		t.Errorf("first event = %+v, want process_start", start)
+	}
+
+	var table bytes.Buffer
+	if err := PrintList(&table, "table", infos[:1]); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(table.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "ID  NAME") || !strings.HasPrefix(lines[1], "1   process_start  Microsoft-Windows-Kernel-Process  1") {
+		t.Errorf("table =\n%s", table.String())
+	}
+
+	var out bytes.Buffer
+	if err := PrintList(&out, "json", infos[:1]); err != nil {
+		t.Fatal(err)
+	}
+	var decoded []EventInfo
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != 1 || decoded[0].Name != "process_start" || decoded[0].EtwID != 1 {
+		t.Errorf("json = %s", out.String())
+	}
+}
+
+func TestPrintListErrors(t *testing.T) {
+	var out bytes.Buffer
+	if err := PrintList(&out, "yaml", Events()); err == nil {
+		t.Error("PrintList accepted the yaml format")
+	}
+	if err := PrintList(&out, "table", []string{"unsupported"}); err == nil {
+		t.Error("PrintList accepted an unsupported list")
+	}
+}
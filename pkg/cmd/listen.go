@@ -0,0 +1,75 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+package cmd
+
+import (
+	"eolh/pkg/tlsconfig"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	winio "github.com/Microsoft/go-winio"
+	"google.golang.org/grpc/credentials"
+)
+
+// pipeSecurityDescriptor only grants access to the named pipes of eolh to administrators and SYSTEM
+const pipeSecurityDescriptor = "D:P(A;;GA;;;BA)(A;;GA;;;SY)"
+
+// parseEndpoint parses a tcp://host:port or a npipe://./pipe/name URL
+func parseEndpoint(endpoint string) (*url.URL, error) {
+	u, err := url.Parse(strings.ReplaceAll(endpoint, "\\", "/"))
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "tcp" && u.Scheme != "npipe" {
+		return nil, fmt.Errorf("invalid endpoint %s: only tcp:// and npipe:// are supported", endpoint)
+	}
+	return u, nil
+}
+
+// ServerCredentials returns the TLS credentials of a gRPC endpoint. Named pipes are restricted to administrators and
+// don't use TLS, tcp:// endpoints require TLS unless they only listen on loopback. The credentials are nil for
+// endpoints without TLS.
+func ServerCredentials(endpoint string, files tlsconfig.Files) (credentials.TransportCredentials, error) {
+	u, err := parseEndpoint(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "npipe" {
+		if !files.Empty() {
+			return nil, fmt.Errorf("TLS only applies to tcp:// endpoints, not to %s", endpoint)
+		}
+		return nil, nil
+	}
+	if files.Empty() {
+		if !tlsconfig.Loopback(u.Hostname()) {
+			return nil, fmt.Errorf("%s is reachable from the network, set a TLS certificate and key, or listen on 127.0.0.1", endpoint)
+		}
+		return nil, nil
+	}
+	config, err := tlsconfig.Server(files)
+	if err != nil {
+		return nil, err
+	}
+	return credentials.NewTLS(config), nil
+}
+
+// Listen listens on an endpoint, a tcp://host:port or a npipe://./pipe/name URL
+func Listen(endpoint string) (net.Listener, error) {
+	u, err := parseEndpoint(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "tcp" {
+		return net.Listen("tcp", u.Host)
+	}
+	host := u.Host
+	if host == "" {
+		host = "."
+	}
+	path := `\\` + host + strings.ReplaceAll(u.Path, "/", `\`)
+	return winio.ListenPipe(path, &winio.PipeConfig{SecurityDescriptor: pipeSecurityDescriptor})
+}
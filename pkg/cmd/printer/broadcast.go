@@ -8,7 +8,9 @@ Licensed under Apache License 2.0, see LICENCE.
 package printer
 
 import (
+	"eolh/pkg/metrics"
 	"eolh/pkg/trace"
+	"fmt"
 	"io"
 	"sync"
 )
@@ -27,6 +29,8 @@ type PrinterConfig struct {
 	OutFile       io.WriteCloser
 	ContainerMode ContainerMode
 	RelativeTS    bool
+	// Stats count the print errors, when not nil
+	Stats *metrics.Stats
 }
 
 type Broadcast struct {
@@ -93,6 +97,13 @@ func (b *Broadcast) Print(event trace.Event) {
 	}
 }
 
+// TrackChannels tracks the channel of every printer, named after the printer kind
+func (b *Broadcast) TrackChannels(c *metrics.Channels) {
+	for i, ch := range b.eventsChan {
+		metrics.TrackChannel(c, fmt.Sprintf("printer_%d_%s", i, b.PrinterConfigs[i].Kind), ch)
+	}
+}
+
 /**
 func (b *Broadcast) Epilogue(stats metrics.Stats) {
 	// if you execute epilogue no other events should be sent to the printers,
@@ -11,6 +11,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"eolh/pkg/logger"
+	"eolh/pkg/metrics"
 	"eolh/pkg/trace"
 	"fmt"
 	"io"
@@ -36,8 +37,15 @@ type EventPrinter interface {
 }
 
 type jsonEventPrinter struct {
-	out    io.WriteCloser
-	logger logger.Logger
+	out   io.WriteCloser
+	stats *metrics.Stats
+}
+
+// countError counts a print error, stats may be nil
+func countError(stats *metrics.Stats) {
+	if stats != nil {
+		stats.PrinterErrorCount.Add(1)
+	}
 }
 
 func New(cfg PrinterConfig) (EventPrinter, error) {
@@ -51,15 +59,18 @@ func New(cfg PrinterConfig) (EventPrinter, error) {
 	switch {
 	case kind == "json":
 		res = &jsonEventPrinter{
-			out: cfg.OutFile,
+			out:   cfg.OutFile,
+			stats: cfg.Stats,
 		}
 	case kind == "forward":
 		res = &forwardEventPrinter{
 			outPath: cfg.OutPath,
+			stats:   cfg.Stats,
 		}
 	case kind == "webhook":
 		res = &webhookEventPrinter{
 			outPath: cfg.OutPath,
+			stats:   cfg.Stats,
 		}
 	}
 	err := res.Init()
@@ -76,9 +87,13 @@ func (p jsonEventPrinter) Preamble() {}
 func (p jsonEventPrinter) Print(event trace.Event) {
 	eBytes, err := json.Marshal(event)
 	if err != nil {
-		p.logger.Errorw("Error marshaling event to json", "error", err)
+		logger.Errorw("Error marshaling event to json", "error", err)
+		countError(p.stats)
+		return
+	}
+	if _, err := fmt.Fprintln(p.out, string(eBytes)); err != nil {
+		countError(p.stats)
 	}
-	fmt.Fprintln(p.out, string(eBytes))
 }
 
 func (p jsonEventPrinter) Close() {
@@ -86,6 +101,7 @@ func (p jsonEventPrinter) Close() {
 
 type webhookEventPrinter struct {
 	outPath string
+	stats   *metrics.Stats
 	url     *url.URL
 	timeout time.Duration
 }
@@ -125,6 +141,7 @@ func (ws *webhookEventPrinter) Print(event trace.Event) {
 	payload, err := json.Marshal(event)
 	if err != nil {
 		logger.Errorw("Error marshalling event", "error", err)
+		countError(ws.stats)
 		return
 	}
 
@@ -133,6 +150,7 @@ func (ws *webhookEventPrinter) Print(event trace.Event) {
 	req, err := http.NewRequest(http.MethodPost, ws.url.String(), bytes.NewReader(payload))
 	if err != nil {
 		logger.Errorw("Error creating request", "error", err)
+		countError(ws.stats)
 		return
 	}
 
@@ -141,11 +159,13 @@ func (ws *webhookEventPrinter) Print(event trace.Event) {
 	resp, err := client.Do(req)
 	if err != nil {
 		logger.Errorw("Error sending webhook", "error", err)
+		countError(ws.stats)
 		return
 	}
 
 	if resp.StatusCode != http.StatusOK {
 		logger.Errorw(fmt.Sprintf("Error sending webhook, http status: %d", resp.StatusCode))
+		countError(ws.stats)
 	}
 
 	_ = resp.Body.Close()
@@ -158,6 +178,7 @@ func (ws *webhookEventPrinter) Close() {
 
 type forwardEventPrinter struct {
 	outPath string
+	stats   *metrics.Stats
 	url     *url.URL
 	client  *forward.Client
 	// These parameters can be set up from the URL
@@ -238,6 +259,7 @@ func (p *forwardEventPrinter) Preamble() {}
 func (p *forwardEventPrinter) Print(event trace.Event) {
 	if p.client == nil {
 		logger.Errorw("Invalid Forward client")
+		countError(p.stats)
 		return
 	}
 
@@ -245,6 +267,8 @@ func (p *forwardEventPrinter) Print(event trace.Event) {
 	eBytes, err := json.Marshal(event)
 	if err != nil {
 		logger.Errorw("Error marshaling event to json", "error", err)
+		countError(p.stats)
+		return
 	}
 
 	record := map[string]interface{}{
@@ -267,6 +291,9 @@ func (p *forwardEventPrinter) Print(event trace.Event) {
 					break
 				}
 			}
+			if err != nil {
+				countError(p.stats)
+			}
 		}
 	}
 }
@@ -9,14 +9,19 @@ Licensed under Apache License 2.0, see LICENCE.
 package containers
 
 import (
+	"context"
 	"encoding/json"
 	cruntime "eolh/pkg/containers/runtime"
 	"eolh/pkg/detect"
 	"eolh/pkg/logger"
 	"fmt"
 	"sync"
+	"time"
 )
 
+// pingTimeout bounds the checks of the container runtime
+const pingTimeout = 2 * time.Second
+
 type SignaturesDataSource struct {
 	containers *Containers
 }
@@ -33,6 +38,13 @@ type Containers struct {
 	deleted  []uint64
 	mtx      sync.RWMutex // protecting both cgroups and deleted fields
 	enricher runtimeInfoService
+	onChange func(ContainerChange)
+}
+
+// ContainerChange describes a container which appeared or disappeared between two populations
+type ContainerChange struct {
+	Container cruntime.ContainerMetadata
+	Removed   bool
 }
 
 func (ctx SignaturesDataSource) Get(key interface{}) (map[string]interface{}, error) {
@@ -112,7 +124,9 @@ func (c *Containers) Enrich(pid int) (cruntime.ContainerMetadata, error) {
 	if err != nil {
 		return cruntime.ContainerMetadata{}, err
 	}
+	c.mtx.RLock()
 	crinfo, ok := c.crMap[si]
+	c.mtx.RUnlock()
 	if !ok {
 		return cruntime.ContainerMetadata{}, fmt.Errorf("No container found with the session identifier")
 	}
@@ -120,7 +134,69 @@ func (c *Containers) Enrich(pid int) (cruntime.ContainerMetadata, error) {
 }
 
 func (c *Containers) Populate() error {
-	var err error
-	c.crMap, err = c.enricher.Populate(cruntime.FromString("containerd"))
-	return err
+	crMap, err := c.enricher.Populate(cruntime.FromString("containerd"))
+	if err != nil {
+		// keep the containers known until the runtime is reachable again
+		return err
+	}
+	c.mtx.Lock()
+	previous := c.crMap
+	c.crMap = crMap
+	onChange := c.onChange
+	c.mtx.Unlock()
+	if onChange != nil {
+		notifyChanges(previous, crMap, onChange)
+	}
+	return nil
+}
+
+// Ping checks the container runtime is reachable, without listing its containers
+func (c *Containers) Ping() error {
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+	return c.enricher.Ping(ctx, cruntime.FromString("containerd"))
+}
+
+// Count returns the number of known containers
+func (c *Containers) Count() int {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	return len(c.crMap)
+}
+
+// List returns a copy of the known containers, keyed by their session ID
+func (c *Containers) List() map[uint32]cruntime.CRInfo {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	res := make(map[uint32]cruntime.CRInfo, len(c.crMap))
+	for id, crinfo := range c.crMap {
+		res[id] = crinfo
+	}
+	return res
+}
+
+// OnChange registers a callback invoked for every container started or stopped since the previous population
+func (c *Containers) OnChange(f func(ContainerChange)) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.onChange = f
+}
+
+func notifyChanges(previous, current map[uint32]cruntime.CRInfo, onChange func(ContainerChange)) {
+	previousIds := make(map[string]cruntime.ContainerMetadata, len(previous))
+	for _, crinfo := range previous {
+		previousIds[crinfo.Container.ContainerId] = crinfo.Container
+	}
+	currentIds := make(map[string]struct{}, len(current))
+	for _, crinfo := range current {
+		currentIds[crinfo.Container.ContainerId] = struct{}{}
+		if _, ok := previousIds[crinfo.Container.ContainerId]; !ok {
+			onChange(ContainerChange{Container: crinfo.Container})
+		}
+	}
+	for id, container := range previousIds {
+		if _, ok := currentIds[id]; !ok {
+			onChange(ContainerChange{Container: container, Removed: true})
+		}
+	}
 }
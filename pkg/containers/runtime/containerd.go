@@ -160,8 +160,8 @@ func (e *containerdEnricher) Get(ctx context.Context, containerId string) (Conta
 					Image: strings.TrimPrefix(image, "sha256:"),
 				},
 			})
-			if err != nil {
-				logger.Infow("SHA256err %v", err.Error())
+			if err != nil || imageInfo.Image == nil {
+				logger.Infow("SHA256err", "error", err)
 				imageName = image
 				imageDigest = image
 			} else {
@@ -205,9 +205,12 @@ func (e *containerdEnricher) FindContainer(procid int32) string {
 	processSI, _ := GetSIOfProcess(procid)
 	containers, _ := e.client.Containers(context.Background())
 	for _, c := range containers {
-		res, _ := e.service.ContainerStatus(context.Background(), &cri.ContainerStatusRequest{
+		res, err := e.service.ContainerStatus(context.Background(), &cri.ContainerStatusRequest{
 			ContainerId: c.ID(),
 		})
+		if err != nil {
+			continue
+		}
 		pid := res.Info["pid"]
 		num, _ := strconv.ParseUint(pid, 10, 64)
 		num32 := int32(num)
@@ -219,6 +222,11 @@ func (e *containerdEnricher) FindContainer(procid int32) string {
 	return ""
 }
 
+func (e *containerdEnricher) Ping(ctx context.Context) error {
+	_, err := e.service.Version(ctx, &cri.VersionRequest{})
+	return err
+}
+
 type Info struct {
 	Pid int `json:"pid"`
 }
@@ -228,6 +236,7 @@ func (e *containerdEnricher) Populate() (map[uint32]CRInfo, error) {
 	res, err := e.service.ListContainers(namespaces.WithNamespace(context.Background(), "k8s.io"), &cri.ListContainersRequest{})
 	if err != nil {
 		logger.Debugw("ListContainersError", "error", err.Error())
+		return nil, err
 	}
 	for _, c := range res.Containers {
 		metadata := ContainerMetadata{
@@ -243,8 +252,8 @@ func (e *containerdEnricher) Populate() (map[uint32]CRInfo, error) {
 					Image: strings.TrimPrefix(image, "sha256:"),
 				},
 			})
-			if err != nil {
-				logger.Infow("SHA256err %v", err.Error())
+			if err != nil || imageInfo.Image == nil {
+				logger.Infow("SHA256err", "error", err)
 				imageName = image
 				imageDigest = image
 			} else {
@@ -43,6 +43,8 @@ type ContainerEnricher interface {
 	FindContainer(procid int32) string
 	//GetContainerList() ([]types.Container, error)
 	Populate() (map[uint32]CRInfo, error)
+	// Ping checks the runtime is reachable, cheaply
+	Ping(ctx context.Context) error
 }
 
 // Represents the internal ID of a container runtime
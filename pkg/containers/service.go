@@ -52,6 +52,14 @@ func (e *runtimeInfoService) Populate(containerRuntime runtime.RuntimeId) (map[u
 	return nil, fmt.Errorf("unsupported runtime")
 }
 
+func (e *runtimeInfoService) Ping(ctx context.Context, containerRuntime runtime.RuntimeId) error {
+	enricher := e.enrichers[containerRuntime]
+	if enricher != nil {
+		return enricher.Ping(ctx)
+	}
+	return fmt.Errorf("unsupported runtime")
+}
+
 // Get calls the inner enricher's Get, based on the containerRuntime parameter if a relevant enricher was registered
 // If an unknown runtime is received, enrichment will be attempted through all registered enrichers
 func (e *runtimeInfoService) Get(ctx context.Context, containerId string, containerRuntime runtime.RuntimeId) (runtime.ContainerMetadata, error) {
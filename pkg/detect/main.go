@@ -11,6 +11,7 @@ package detect
 import (
 	"eolh/pkg/protocol"
 	"errors"
+	"time"
 )
 
 type SignatureMetadata struct {
@@ -91,5 +92,27 @@ type Signature interface {
 
 type SignalSourceComplete string
 
+// SignalContainer describes the container a container lifecycle signal refers to
+type SignalContainer struct {
+	ContainerID  string
+	Name         string
+	Image        string
+	PodName      string
+	PodNamespace string
+	Timestamp    time.Time
+}
+
+// SignalContainerStart is sent when a new container is discovered
+type SignalContainerStart SignalContainer
+
+// SignalContainerStop is sent when a known container disappears
+type SignalContainerStop SignalContainer
+
+// SignalTick is sent periodically, allowing signatures to act on time passing
+type SignalTick time.Time
+
+// SignalShutdown is sent once before the engine stops, allowing signatures to flush their state
+type SignalShutdown struct{}
+
 var ErrDataNotFound = errors.New("requested data was not found")
 var ErrKeyNotSupported = errors.New("queried key is not supported")
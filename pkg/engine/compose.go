@@ -0,0 +1,119 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package engine
+
+import (
+	"eolh/pkg/detect"
+	"eolh/pkg/protocol"
+	"fmt"
+)
+
+// findingsConsumed returns the finding event names a signature subscribes to through the findings source
+func findingsConsumed(selectedEvents []detect.SignatureEventSelector) []string {
+	var names []string
+	for _, selectedEvent := range selectedEvents {
+		if selectedEvent.Source != protocol.FindingsSource {
+			continue
+		}
+		if selectedEvent.Name == "" {
+			names = append(names, ALL_EVENT_TYPES)
+			continue
+		}
+		names = append(names, selectedEvent.Name)
+	}
+	return names
+}
+
+// aggregating is implemented by signatures evaluating several signatures, see regosig.AIO. Their findings
+// carry the event names of the aggregated signatures, so the cycle check walks those instead.
+type aggregating interface {
+	Signatures() []detect.SignatureMetadata
+	SelectedEventsOf(id string) []detect.SignatureEventSelector
+}
+
+// findingsEdge links the finding event names a signature consumes to the one it produces
+type findingsEdge struct {
+	produced string
+	consumed []string
+}
+
+// findingsEdges returns the edges of a signature, one per aggregated signature for aggregating ones
+func findingsEdges(sig detect.Signature, metadata detect.SignatureMetadata, selectedEvents []detect.SignatureEventSelector) []findingsEdge {
+	a, ok := sig.(aggregating)
+	if !ok {
+		return []findingsEdge{{produced: metadata.EventName, consumed: findingsConsumed(selectedEvents)}}
+	}
+	var edges []findingsEdge
+	for _, m := range a.Signatures() {
+		edges = append(edges, findingsEdge{produced: m.EventName, consumed: findingsConsumed(a.SelectedEventsOf(m.ID))})
+	}
+	return edges
+}
+
+// checkFindingsCycle makes sure that loading a signature won't create a loop of signatures triggering each other
+// through their findings. It must be called before the signature is stored in the engine.
+func (engine *Engine) checkFindingsCycle(sig detect.Signature, metadata detect.SignatureMetadata, selectedEvents []detect.SignatureEventSelector) error {
+	added := findingsEdges(sig, metadata, selectedEvents)
+	consuming := false
+	for _, edge := range added {
+		consuming = consuming || len(edge.consumed) > 0
+	}
+	if !consuming {
+		return nil
+	}
+
+	// produces maps a finding event name to the finding event names produced by the signatures consuming it
+	produces := map[string][]string{}
+	var wildcards []string
+	addEdges := func(edges []findingsEdge) {
+		for _, edge := range edges {
+			for _, name := range edge.consumed {
+				if name == ALL_EVENT_TYPES {
+					wildcards = append(wildcards, edge.produced)
+					continue
+				}
+				produces[name] = append(produces[name], edge.produced)
+			}
+		}
+	}
+
+	engine.signaturesMutex.RLock()
+	for loaded := range engine.signatures {
+		m, err := loaded.GetMetadata()
+		if err != nil {
+			continue
+		}
+		se, err := loaded.GetSelectedEvents()
+		if err != nil {
+			continue
+		}
+		addEdges(findingsEdges(loaded, m, se))
+	}
+	engine.signaturesMutex.RUnlock()
+	addEdges(added)
+
+	// any new cycle goes through a finding of the new signature, walk the findings produced downstream of each
+	for _, edge := range added {
+		visited := map[string]bool{}
+		queue := []string{edge.produced}
+		for len(queue) > 0 {
+			current := queue[0]
+			queue = queue[1:]
+			for _, next := range [][]string{produces[current], wildcards} {
+				for _, name := range next {
+					if name == edge.produced {
+						return fmt.Errorf("signature findings would form a cycle through \"%s\"", current)
+					}
+					if !visited[name] {
+						visited[name] = true
+						queue = append(queue, name)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package engine_test
+
+import (
+	"context"
+	"eolh/pkg/detect"
+	"eolh/pkg/engine"
+	"eolh/pkg/protocol"
+	"eolh/pkg/signatures"
+	"sync"
+	"testing"
+	"time"
+)
+
+// composedSignature reports a finding named eventName for every event it selects
+func composedSignature(id, eventName string, selected ...detect.SignatureEventSelector) *signatures.FakeSignature {
+	var cb detect.SignatureHandler
+	return &signatures.FakeSignature{
+		FakeGetMetadata: func() (detect.SignatureMetadata, error) {
+			return detect.SignatureMetadata{ID: id, Name: id, EventName: eventName}, nil
+		},
+		FakeGetSelectedEvents: func() ([]detect.SignatureEventSelector, error) {
+			return selected, nil
+		},
+		FakeInit: func(ctx detect.SignatureContext) error {
+			cb = ctx.Callback
+			return nil
+		},
+		FakeOnEvent: func(event protocol.Event) error {
+			cb(detect.Finding{Event: event, SigMetadata: detect.SignatureMetadata{ID: id, EventName: eventName}})
+			return nil
+		},
+	}
+}
+
+func findingsOf(name string) detect.SignatureEventSelector {
+	return detect.SignatureEventSelector{Source: protocol.FindingsSource, Name: name, Origin: "*"}
+}
+
+// aggregatedSignatures evaluates signatures together, like the Rego AIO signature
+type aggregatedSignatures struct {
+	*signatures.FakeSignature
+	metadata []detect.SignatureMetadata
+	selected map[string][]detect.SignatureEventSelector
+}
+
+func aggregate(sigs ...*signatures.FakeSignature) *aggregatedSignatures {
+	a := &aggregatedSignatures{
+		FakeSignature: composedSignature("AIO", "", detect.SignatureEventSelector{Source: "eolh", Name: "*"}),
+		selected:      map[string][]detect.SignatureEventSelector{},
+	}
+	for _, sig := range sigs {
+		metadata, _ := sig.GetMetadata()
+		selected, _ := sig.GetSelectedEvents()
+		a.metadata = append(a.metadata, metadata)
+		a.selected[metadata.ID] = selected
+	}
+	return a
+}
+
+func (a aggregatedSignatures) Signatures() []detect.SignatureMetadata {
+	return a.metadata
+}
+
+func (a aggregatedSignatures) SelectedEventsOf(id string) []detect.SignatureEventSelector {
+	return a.selected[id]
+}
+
+func newComposingEngine(t *testing.T, sources engine.EventSources, output chan detect.Finding, sigs ...detect.Signature) *engine.Engine {
+	t.Helper()
+	e, err := engine.NewEngine(engine.Config{
+		Enabled:             true,
+		SignatureBufferSize: 10,
+		Signatures:          sigs,
+		Feedback: func(f detect.Finding) (protocol.Event, error) {
+			return protocol.Event{Headers: protocol.EventHeaders{Selector: protocol.Selector{
+				Source: protocol.FindingsSource,
+				Name:   f.SigMetadata.EventName,
+				Origin: "host",
+			}}}, nil
+		},
+	}, sources, output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestLoadSignatureRejectsFindingsCycle(t *testing.T) {
+	tests := []struct {
+		name    string
+		loaded  []detect.Signature
+		sig     detect.Signature
+		wantErr bool
+	}{
+		{
+			name:   "chain",
+			loaded: []detect.Signature{composedSignature("A", "a", detect.SignatureEventSelector{Source: "eolh", Name: "*"})},
+			sig:    composedSignature("B", "b", findingsOf("a")),
+		},
+		{
+			name:    "self",
+			sig:     composedSignature("A", "a", findingsOf("a")),
+			wantErr: true,
+		},
+		{
+			name:    "loop",
+			loaded:  []detect.Signature{composedSignature("A", "a", findingsOf("b"))},
+			sig:     composedSignature("B", "b", findingsOf("a")),
+			wantErr: true,
+		},
+		{
+			name:    "any finding",
+			loaded:  []detect.Signature{composedSignature("A", "a", findingsOf("b"))},
+			sig:     composedSignature("B", "b", detect.SignatureEventSelector{Source: protocol.FindingsSource, Name: "*"}),
+			wantErr: true,
+		},
+		{
+			name: "chain within an aggregating signature",
+			sig: aggregate(
+				composedSignature("A", "a", detect.SignatureEventSelector{Source: "eolh", Name: "*"}),
+				composedSignature("B", "b", findingsOf("a")),
+			),
+		},
+		{
+			name:    "loop through an aggregating signature",
+			loaded:  []detect.Signature{composedSignature("A", "a", findingsOf("c"))},
+			sig:     aggregate(composedSignature("B", "b", findingsOf("a")), composedSignature("C", "c", findingsOf("b"))),
+			wantErr: true,
+		},
+		{
+			name:    "loop into an aggregating signature",
+			loaded:  []detect.Signature{aggregate(composedSignature("B", "b", findingsOf("a")))},
+			sig:     composedSignature("A", "a", findingsOf("b")),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newComposingEngine(t, engine.EventSources{Eolh: make(chan protocol.Event)}, make(chan detect.Finding, 10), tt.loaded...)
+			_, err := e.LoadSignature(tt.sig)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LoadSignature() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFeedbackComposesSignatures(t *testing.T) {
+	var mutex sync.Mutex
+	var got []string
+	record := func(name string) *signatures.FakeSignature {
+		sig := composedSignature(name, name, findingsOf("a"))
+		sig.FakeOnEvent = func(event protocol.Event) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			got = append(got, name+"<-"+event.Headers.Selector.Name)
+			return nil
+		}
+		return sig
+	}
+	sources := engine.EventSources{Eolh: make(chan protocol.Event)}
+	output := make(chan detect.Finding, 10)
+	e := newComposingEngine(t, sources, output,
+		composedSignature("A", "a", detect.SignatureEventSelector{Source: "eolh", Name: "process_start", Origin: "*"}),
+		record("B"),
+	)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		e.Start(context.Background())
+	}()
+	sources.Eolh <- protocol.Event{Headers: protocol.EventHeaders{Selector: protocol.Selector{Source: "eolh", Name: "process_start", Origin: "host"}}}
+	close(sources.Eolh)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("engine did not stop")
+	}
+	// the finding of A is fed back to B before the engine stops
+	if len(got) != 1 || got[0] != "B<-a" {
+		t.Errorf("fed back events = %v, want [B<-a]", got)
+	}
+	if len(output) != 1 {
+		t.Errorf("%d findings, want 1", len(output))
+	}
+}
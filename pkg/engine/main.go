@@ -15,6 +15,7 @@ import (
 	"eolh/pkg/protocol"
 	"fmt"
 	"sync"
+	"time"
 )
 
 const ALL_EVENT_ORIGINS = "*"
@@ -22,16 +23,26 @@ const EVENT_CONTAINER_ORIGIN = "container"
 const EVENT_HOST_ORIGIN = "host"
 const ALL_EVENT_TYPES = "*"
 
+// EVENT_SIGNAL_SOURCE marks signals queued to a signature alongside its events
+const EVENT_SIGNAL_SOURCE = "eolh-signal"
+
 type Config struct {
 	// Enables the signatures engine to run in the events pipeline
 	Enabled             bool
 	SignatureBufferSize uint
 	Signatures          []detect.Signature
 	DataSources         []detect.DataSource
+	// TickInterval is the interval between detect.SignalTick signals, zero disables them
+	TickInterval time.Duration
+	// Feedback converts the findings into the events fed back to the signatures subscribed to findings, so that
+	// signatures can build on other signatures' findings. They aren't fed back when it is nil.
+	Feedback func(detect.Finding) (protocol.Event, error)
 }
 
 type EventSources struct {
 	Eolh chan protocol.Event
+	// Signals carries lifecycle signals (e.g. container start/stop) broadcast to every signature
+	Signals chan detect.Signal
 }
 
 type Engine struct {
@@ -46,15 +57,38 @@ type Engine struct {
 	dataSources      map[string]map[string]detect.DataSource
 	dataSourcesMutex sync.RWMutex
 	logger           logger.Logger
+	feedback         feedbackQueue
+}
+
+// feedbackQueue holds the findings fed back to the engine. It never blocks the signatures reporting them, while the
+// engine may itself be blocked on one of them.
+type feedbackQueue struct {
+	mtx    sync.Mutex
+	events []protocol.Event
+	ready  chan struct{}
 }
 
-func (engine *Engine) checkCompletion() bool {
-	if engine.inputs.Eolh == nil {
-		engine.unloadAllSignatures()
-		engine.waitGroup.Wait()
-		return true
+func (q *feedbackQueue) push(event protocol.Event) {
+	q.mtx.Lock()
+	q.events = append(q.events, event)
+	q.mtx.Unlock()
+	select {
+	case q.ready <- struct{}{}:
+	default:
 	}
-	return false
+}
+
+func (q *feedbackQueue) take() []protocol.Event {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	events := q.events
+	q.events = nil
+	return events
+}
+
+// barrier is queued to every signature after their events, they are done with them once it is handled
+type barrier struct {
+	wg *sync.WaitGroup
 }
 
 func (engine *Engine) RegisterDataSource(dataSource detect.DataSource) error {
@@ -79,6 +113,15 @@ func (engine *Engine) RegisterDataSource(dataSource detect.DataSource) error {
 // matchHandler is a function that runs when a signature is matched
 func (engine *Engine) matchHandler(res detect.Finding) {
 	engine.output <- res
+	if engine.config.Feedback == nil {
+		return
+	}
+	event, err := engine.config.Feedback(res)
+	if err != nil {
+		logger.Debugw("Converting finding to event", "signature", res.SigMetadata.ID, "error", err)
+		return
+	}
+	engine.feedback.push(event)
 }
 
 func (engine *Engine) GetDataSource(namespace string, id string) (detect.DataSource, bool) {
@@ -106,6 +149,9 @@ func (engine *Engine) loadSignature(signature detect.Signature) (string, error)
 	if err != nil {
 		return "", fmt.Errorf("error getting selected events for signature %s: %w", metadata.Name, err)
 	}
+	if err := engine.checkFindingsCycle(signature, metadata, selectedEvents); err != nil {
+		return "", fmt.Errorf("failed to store signature \"%s\": %w", metadata.Name, err)
+	}
 	// insert in engine.signatures map
 	engine.signaturesMutex.RLock()
 	if engine.signatures[signature] != nil {
@@ -150,9 +196,20 @@ func (engine *Engine) loadSignature(signature detect.Signature) (string, error)
 }
 
 // signatureStart is the signature handling business logics.
+// Signals are queued in the same channel as events so that a signature never handles both concurrently.
 func signatureStart(signature detect.Signature, c chan protocol.Event, wg *sync.WaitGroup) {
-	wg.Add(1)
 	for e := range c {
+		if e.Headers.Selector.Source == EVENT_SIGNAL_SOURCE {
+			if b, ok := e.Payload.(barrier); ok {
+				b.wg.Done()
+				continue
+			}
+			if err := signature.OnSignal(e.Payload); err != nil {
+				meta, _ := signature.GetMetadata()
+				logger.Errorw("Handling signal by signature " + meta.Name + ": " + err.Error())
+			}
+			continue
+		}
 		if err := signature.OnEvent(e); err != nil {
 			meta, _ := signature.GetMetadata()
 			logger.Errorw("Handling event by signature " + meta.Name + ": " + err.Error())
@@ -169,6 +226,7 @@ func (engine *Engine) LoadSignature(signature detect.Signature) (string, error)
 		return id, err
 	}
 	engine.signaturesMutex.RLock()
+	engine.waitGroup.Add(1)
 	go signatureStart(signature, engine.signatures[signature], &engine.waitGroup)
 	engine.signaturesMutex.RUnlock()
 
@@ -185,6 +243,7 @@ func NewEngine(config Config, sources EventSources, output chan detect.Finding)
 		output:    output,
 		config:    config,
 	}
+	engine.feedback.ready = make(chan struct{}, 1)
 	engine.signaturesMutex.Lock()
 	engine.signatures = make(map[detect.Signature]chan protocol.Event)
 	engine.signaturesIndex = make(map[detect.SignatureEventSelector][]detect.Signature)
@@ -209,8 +268,9 @@ func NewEngine(config Config, sources EventSources, output chan detect.Finding)
 	return &engine, nil
 }
 
+// Start runs the engine until its input is exhausted or ctx is cancelled.
+// Before returning, every signature gets a detect.SignalShutdown and all pending findings are emitted.
 func (engine *Engine) Start(ctx context.Context) {
-	defer engine.unloadAllSignatures()
 	engine.signaturesMutex.RLock()
 	for s, c := range engine.signatures {
 		engine.waitGroup.Add(1)
@@ -218,36 +278,46 @@ func (engine *Engine) Start(ctx context.Context) {
 	}
 	engine.signaturesMutex.RUnlock()
 	engine.consumeSources(ctx)
+	engine.broadcastSignal(detect.SignalShutdown{})
+	// the findings reported on shutdown are fed back too
+	engine.flushFindings()
+	engine.unloadAllSignatures()
 }
 
 func (engine *Engine) consumeSources(ctx context.Context) {
+	var tick <-chan time.Time
+	if engine.config.TickInterval > 0 {
+		ticker := time.NewTicker(engine.config.TickInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
 	for {
 		select {
 		case event, ok := <-engine.inputs.Eolh:
 			if !ok {
-				engine.signaturesMutex.RLock()
-				for sig := range engine.signatures {
-					se, err := sig.GetSelectedEvents()
-					if err != nil {
-						engine.logger.Errorw("Getting selected events: " + err.Error())
-						continue
-					}
-					for _, sel := range se {
-						if sel.Source == "eolh" {
-							_ = sig.OnSignal(detect.SignalSourceComplete("eolh"))
-							break
-						}
-					}
-				}
-				engine.signaturesMutex.RUnlock()
 				engine.inputs.Eolh = nil
-				if engine.checkCompletion() {
-					return
-				}
+				engine.signalSourceComplete("eolh")
+				// the findings derived from the last events are fed back before the findings are over too
+				engine.flushFindings()
+				engine.signalSourceComplete(protocol.FindingsSource)
+				return
+			}
+			engine.processEvent(event)
 
+		case <-engine.feedback.ready:
+			engine.processFeedback()
+
+		case signal, ok := <-engine.inputs.Signals:
+			if !ok {
+				engine.inputs.Signals = nil
 				continue
 			}
-			engine.processEvent(event)
+			engine.processFeedback()
+			engine.broadcastSignal(signal)
+
+		case t := <-tick:
+			engine.processFeedback()
+			engine.broadcastSignal(detect.SignalTick(t))
 
 		case <-ctx.Done():
 			goto drain
@@ -255,27 +325,105 @@ func (engine *Engine) consumeSources(ctx context.Context) {
 	}
 
 drain:
-	// drain and process all remaining events
+	// drain and process the remaining events, the sources may be closed on cancellation
 	for {
 		select {
-		case event := <-engine.inputs.Eolh:
+		case event, ok := <-engine.inputs.Eolh:
+			if !ok {
+				engine.inputs.Eolh = nil
+				continue
+			}
 			engine.processEvent(event)
 
 		default:
+			engine.flushFindings()
+			return
+		}
+	}
+}
+
+// processFeedback dispatches the findings fed back so far, signals are broadcast after them so that the signatures
+// handle the findings reported before a signal first
+func (engine *Engine) processFeedback() {
+	for _, event := range engine.feedback.take() {
+		engine.processEvent(event)
+	}
+}
+
+// flushFindings waits for the signatures to handle the events dispatched so far, and feeds back the findings they
+// reported until there are none left
+func (engine *Engine) flushFindings() {
+	for {
+		var wg sync.WaitGroup
+		engine.signaturesMutex.RLock()
+		wg.Add(len(engine.signatures))
+		for sig := range engine.signatures {
+			engine.dispatchSignal(sig, barrier{wg: &wg})
+		}
+		engine.signaturesMutex.RUnlock()
+		wg.Wait()
+		events := engine.feedback.take()
+		if len(events) == 0 {
 			return
 		}
+		for _, event := range events {
+			engine.processEvent(event)
+		}
 	}
 }
 
+// signalSourceComplete notifies every signature subscribed to the given source that it won't produce more events
+func (engine *Engine) signalSourceComplete(source string) {
+	engine.signaturesMutex.RLock()
+	defer engine.signaturesMutex.RUnlock()
+	for sig := range engine.signatures {
+		se, err := sig.GetSelectedEvents()
+		if err != nil {
+			logger.Errorw("Getting selected events: " + err.Error())
+			continue
+		}
+		for _, sel := range se {
+			if sel.Source == source {
+				engine.dispatchSignal(sig, detect.SignalSourceComplete(source))
+				break
+			}
+		}
+	}
+}
+
+// broadcastSignal queues a signal to every loaded signature
+func (engine *Engine) broadcastSignal(signal detect.Signal) {
+	engine.signaturesMutex.RLock()
+	defer engine.signaturesMutex.RUnlock()
+	for sig := range engine.signatures {
+		engine.dispatchSignal(sig, signal)
+	}
+}
+
+func (engine *Engine) dispatchSignal(s detect.Signature, signal detect.Signal) {
+	engine.signatures[s] <- protocol.Event{
+		Headers: protocol.EventHeaders{
+			Selector: protocol.Selector{Source: EVENT_SIGNAL_SOURCE},
+		},
+		Payload: signal,
+	}
+}
+
+// unloadAllSignatures stops the signatures, they are closed once they are done with their queued events and signals
 func (engine *Engine) unloadAllSignatures() {
 	engine.signaturesMutex.Lock()
-	defer engine.signaturesMutex.Unlock()
+	sigs := make([]detect.Signature, 0, len(engine.signatures))
 	for sig, c := range engine.signatures {
-		sig.Close()
 		close(c)
 		delete(engine.signatures, sig)
+		sigs = append(sigs, sig)
 	}
 	engine.signaturesIndex = make(map[detect.SignatureEventSelector][]detect.Signature)
+	engine.signaturesMutex.Unlock()
+	engine.waitGroup.Wait()
+	for _, sig := range sigs {
+		sig.Close()
+	}
 }
 
 func (engine *Engine) dispatchEvent(s detect.Signature, event protocol.Event) {
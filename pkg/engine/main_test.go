@@ -0,0 +1,244 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package engine_test
+
+import (
+	"context"
+	"eolh/pkg/detect"
+	"eolh/pkg/engine"
+	"eolh/pkg/protocol"
+	"eolh/pkg/signatures"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingSignature subscribes to every event and to ppid_spoofing findings, and records what it handles
+type recordingSignature struct {
+	mutex    sync.Mutex
+	events   []string
+	shutdown bool
+}
+
+func (r *recordingSignature) signature() detect.Signature {
+	return &signatures.FakeSignature{
+		FakeGetMetadata: func() (detect.SignatureMetadata, error) {
+			return detect.SignatureMetadata{ID: "TEST-1", Name: "Recording", EventName: "recorded"}, nil
+		},
+		FakeGetSelectedEvents: func() ([]detect.SignatureEventSelector, error) {
+			return []detect.SignatureEventSelector{
+				{Source: "eolh", Name: "*", Origin: "*"},
+				{Source: protocol.FindingsSource, Name: "ppid_spoofing", Origin: "*"},
+			}, nil
+		},
+		FakeOnEvent: func(event protocol.Event) error {
+			r.mutex.Lock()
+			defer r.mutex.Unlock()
+			r.events = append(r.events, event.Headers.Selector.Source+"/"+event.Headers.Selector.Name)
+			return nil
+		},
+		FakeOnSignal: func(signal detect.Signal) error {
+			if _, ok := signal.(detect.SignalShutdown); ok {
+				r.mutex.Lock()
+				defer r.mutex.Unlock()
+				r.shutdown = true
+			}
+			return nil
+		},
+	}
+}
+
+func event(source, name string) protocol.Event {
+	return protocol.Event{Headers: protocol.EventHeaders{Selector: protocol.Selector{Source: source, Name: name, Origin: "host"}}}
+}
+
+func start(t *testing.T, ctx context.Context, sources engine.EventSources, sigs ...detect.Signature) <-chan struct{} {
+	t.Helper()
+	e := newComposingEngine(t, sources, make(chan detect.Finding, 10), sigs...)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		e.Start(ctx)
+	}()
+	return done
+}
+
+func wait(t *testing.T, done <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("engine did not stop")
+	}
+}
+
+func TestStartFlushesOnCancel(t *testing.T) {
+	r := &recordingSignature{}
+	sources := engine.EventSources{Eolh: make(chan protocol.Event, 10)}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := start(t, ctx, sources, r.signature())
+	sources.Eolh <- event("eolh", "process_start")
+	// the pipeline closes its sources once cancelled
+	cancel()
+	close(sources.Eolh)
+	wait(t, done)
+	if !r.shutdown {
+		t.Error("signature did not get the shutdown signal")
+	}
+}
+
+func TestStartConsumesFindingsAfterEvents(t *testing.T) {
+	r := &recordingSignature{}
+	sources := engine.EventSources{Eolh: make(chan protocol.Event)}
+	producer := composedSignature("TEST-4", "ppid_spoofing", detect.SignatureEventSelector{Source: "eolh", Name: "process_start", Origin: "*"})
+	done := start(t, context.Background(), sources, r.signature(), producer)
+	sources.Eolh <- event("eolh", "process_start")
+	// the finding derived from the last event is fed back after the events are over
+	close(sources.Eolh)
+	wait(t, done)
+	want := []string{"eolh/process_start", protocol.FindingsSource + "/ppid_spoofing"}
+	if len(r.events) != len(want) {
+		t.Fatalf("events = %v, want %v", r.events, want)
+	}
+	for i := range want {
+		if r.events[i] != want[i] {
+			t.Errorf("events[%d] = %s, want %s", i, r.events[i], want[i])
+		}
+	}
+	if !r.shutdown {
+		t.Error("signature did not get the shutdown signal")
+	}
+}
+
+func TestStartFeedsBackEveryFinding(t *testing.T) {
+	const events = 500
+	var cb detect.SignatureHandler
+	producer := &signatures.FakeSignature{
+		FakeGetMetadata: func() (detect.SignatureMetadata, error) {
+			return detect.SignatureMetadata{ID: "TEST-2", Name: "Producer", EventName: "produced"}, nil
+		},
+		FakeGetSelectedEvents: func() ([]detect.SignatureEventSelector, error) {
+			return []detect.SignatureEventSelector{{Source: "eolh", Name: "process_start", Origin: "*"}}, nil
+		},
+		FakeInit: func(ctx detect.SignatureContext) error {
+			cb = ctx.Callback
+			return nil
+		},
+		FakeOnEvent: func(event protocol.Event) error {
+			cb(detect.Finding{Event: event, SigMetadata: detect.SignatureMetadata{ID: "TEST-2", EventName: "produced"}})
+			return nil
+		},
+	}
+	var consumed int
+	var shutdownConsumed int
+	consumer := &signatures.FakeSignature{
+		FakeGetMetadata: func() (detect.SignatureMetadata, error) {
+			return detect.SignatureMetadata{ID: "TEST-3", Name: "Consumer", EventName: "consumed"}, nil
+		},
+		FakeGetSelectedEvents: func() ([]detect.SignatureEventSelector, error) {
+			return []detect.SignatureEventSelector{{Source: protocol.FindingsSource, Name: "produced", Origin: "*"}}, nil
+		},
+		FakeOnEvent: func(event protocol.Event) error {
+			consumed++
+			return nil
+		},
+		FakeOnSignal: func(signal detect.Signal) error {
+			if _, ok := signal.(detect.SignalShutdown); ok {
+				shutdownConsumed = consumed
+			}
+			return nil
+		},
+	}
+	sources := engine.EventSources{Eolh: make(chan protocol.Event)}
+	// a small output, slower than the producer, so that the engine would block on the feedback
+	output := make(chan detect.Finding)
+	e, err := engine.NewEngine(engine.Config{
+		Enabled:             true,
+		SignatureBufferSize: 1,
+		Signatures:          []detect.Signature{producer, consumer},
+		Feedback: func(f detect.Finding) (protocol.Event, error) {
+			return event(protocol.FindingsSource, f.SigMetadata.EventName), nil
+		},
+	}, sources, output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for range output {
+			time.Sleep(10 * time.Microsecond)
+		}
+	}()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		e.Start(context.Background())
+	}()
+	for i := 0; i < events; i++ {
+		sources.Eolh <- event("eolh", "process_start")
+	}
+	close(sources.Eolh)
+	wait(t, done)
+	close(output)
+	if shutdownConsumed != events {
+		t.Errorf("the consumer got %d findings before shutdown, want %d", shutdownConsumed, events)
+	}
+}
+
+func TestStartFeedsBackShutdownFindings(t *testing.T) {
+	var cb detect.SignatureHandler
+	summary := &signatures.FakeSignature{
+		FakeGetMetadata: func() (detect.SignatureMetadata, error) {
+			return detect.SignatureMetadata{ID: "TEST-5", Name: "Summary", EventName: "summary"}, nil
+		},
+		FakeGetSelectedEvents: func() ([]detect.SignatureEventSelector, error) {
+			return []detect.SignatureEventSelector{{Source: "eolh", Name: "process_start", Origin: "*"}}, nil
+		},
+		FakeInit: func(ctx detect.SignatureContext) error {
+			cb = ctx.Callback
+			return nil
+		},
+		FakeOnSignal: func(signal detect.Signal) error {
+			if _, ok := signal.(detect.SignalShutdown); ok {
+				cb(detect.Finding{SigMetadata: detect.SignatureMetadata{ID: "TEST-5", EventName: "summary"}})
+			}
+			return nil
+		},
+	}
+	var mutex sync.Mutex
+	var consumed int
+	var closed bool
+	consumer := &signatures.FakeSignature{
+		FakeGetMetadata: func() (detect.SignatureMetadata, error) {
+			return detect.SignatureMetadata{ID: "TEST-6", Name: "Consumer", EventName: "consumed"}, nil
+		},
+		FakeGetSelectedEvents: func() ([]detect.SignatureEventSelector, error) {
+			return []detect.SignatureEventSelector{{Source: protocol.FindingsSource, Name: "summary", Origin: "*"}}, nil
+		},
+		FakeOnEvent: func(event protocol.Event) error {
+			// slower than the engine, so that it would be closed while handling the finding
+			time.Sleep(10 * time.Millisecond)
+			mutex.Lock()
+			defer mutex.Unlock()
+			if closed {
+				t.Error("the consumer got a finding once closed")
+			}
+			consumed++
+			return nil
+		},
+		FakeClose: func() {
+			mutex.Lock()
+			defer mutex.Unlock()
+			closed = true
+		},
+	}
+	sources := engine.EventSources{Eolh: make(chan protocol.Event)}
+	done := start(t, context.Background(), sources, summary, consumer)
+	close(sources.Eolh)
+	wait(t, done)
+	if consumed != 1 || !closed {
+		t.Errorf("the consumer got %d findings and was closed %v, want 1 and true", consumed, closed)
+	}
+}
@@ -0,0 +1,165 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+// Package enrich computes the hashes and the PE metadata of the files behind events.
+package enrich
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMaxFileSize is the size of the largest file hashed by default
+	DefaultMaxFileSize = 64 << 20
+	// DefaultCacheSize is the number of files whose information is cached by default
+	DefaultCacheSize = 4096
+)
+
+// FileInfo describes a file, PE is nil unless the file is a PE image
+type FileInfo struct {
+	SHA256  string    `json:"sha256"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	PE      *PEInfo   `json:"pe,omitempty"`
+}
+
+// ErrNotPE is returned by Info for the files which are not PE images when only PE images are requested
+var ErrNotPE = errors.New("not a PE image")
+
+// ErrNotSigned is returned by Signer for the files without a valid embedded signature
+var ErrNotSigned = errors.New("not signed")
+
+type cacheKey struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+type cacheEntry struct {
+	key  cacheKey
+	info FileInfo
+}
+
+// Files computes the information of files, caching it by path, size and modification time, safe for concurrent use
+type Files struct {
+	maxSize   int64
+	cacheSize int
+	mtx       sync.Mutex
+	entries   map[cacheKey]*list.Element
+	lru       *list.List
+}
+
+// NewFiles creates a Files hashing the files up to maxSize bytes and caching cacheSize of them, the defaults when 0
+func NewFiles(maxSize int64, cacheSize int) *Files {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxFileSize
+	}
+	if cacheSize <= 0 {
+		cacheSize = DefaultCacheSize
+	}
+	return &Files{
+		maxSize:   maxSize,
+		cacheSize: cacheSize,
+		entries:   make(map[cacheKey]*list.Element),
+		lru:       list.New(),
+	}
+}
+
+// Info returns the information of a file. When peOnly is set, the files which are not PE images are not hashed and
+// ErrNotPE is returned.
+func (f *Files) Info(path string, peOnly bool) (FileInfo, error) {
+	file, err := openFile(path)
+	if err != nil {
+		return FileInfo{}, err
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return FileInfo{}, err
+	}
+	if !stat.Mode().IsRegular() {
+		return FileInfo{}, fmt.Errorf("%s is not a regular file", path)
+	}
+	if stat.Size() > f.maxSize {
+		return FileInfo{}, fmt.Errorf("%s is larger than %d bytes", path, f.maxSize)
+	}
+	key := cacheKey{path: path, size: stat.Size(), modTime: stat.ModTime()}
+	if info, ok := f.get(key); ok {
+		if peOnly && info.PE == nil {
+			return FileInfo{}, ErrNotPE
+		}
+		return info, nil
+	}
+	if peOnly && !hasMZ(file) {
+		return FileInfo{}, ErrNotPE
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(file, 0, stat.Size())); err != nil {
+		return FileInfo{}, err
+	}
+	info := FileInfo{
+		SHA256:  hex.EncodeToString(h.Sum(nil)),
+		Size:    stat.Size(),
+		ModTime: stat.ModTime(),
+	}
+	// not a PE image when it fails to parse
+	if pe, err := ParsePE(io.NewSectionReader(file, 0, stat.Size())); err == nil {
+		info.PE = pe
+	}
+	f.put(key, info)
+	return info, nil
+}
+
+// IsPE tells whether a file starts with the MZ magic of PE images, without hashing nor parsing it
+func IsPE(path string) (bool, error) {
+	file, err := openFile(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	return hasMZ(file), nil
+}
+
+func hasMZ(r io.ReaderAt) bool {
+	magic := make([]byte, 2)
+	if _, err := r.ReadAt(magic, 0); err != nil {
+		return false
+	}
+	return magic[0] == 'M' && magic[1] == 'Z'
+}
+
+func (f *Files) get(key cacheKey) (FileInfo, bool) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	e, ok := f.entries[key]
+	if !ok {
+		return FileInfo{}, false
+	}
+	f.lru.MoveToFront(e)
+	return e.Value.(*cacheEntry).info, true
+}
+
+func (f *Files) put(key cacheKey, info FileInfo) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	if e, ok := f.entries[key]; ok {
+		f.lru.MoveToFront(e)
+		return
+	}
+	f.entries[key] = f.lru.PushFront(&cacheEntry{key: key, info: info})
+	for f.lru.Len() > f.cacheSize {
+		oldest := f.lru.Back()
+		f.lru.Remove(oldest)
+		delete(f.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
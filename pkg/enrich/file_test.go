@@ -0,0 +1,174 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package enrich
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, dir, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestFilesInfo(t *testing.T) {
+	dir := t.TempDir()
+	image := peImage(t, nil)
+	exe := writeFile(t, dir, "a.exe", image)
+	txt := writeFile(t, dir, "a.txt", []byte("not a PE image"))
+	large := writeFile(t, dir, "large.exe", append(image, make([]byte, 1024)...))
+	files := NewFiles(int64(len(image)+100), 0)
+
+	info, err := files.Info(exe, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.SHA256 != sha256Hex(image) || info.Size != int64(len(image)) || info.PE == nil || info.PE.Machine != "amd64" {
+		t.Errorf("info = %+v, want the hash and the PE metadata of the image", info)
+	}
+	if _, err := files.Info(txt, true); !errors.Is(err, ErrNotPE) {
+		t.Errorf("Info(%s, true) = %v, want ErrNotPE", txt, err)
+	}
+	info, err = files.Info(txt, false)
+	if err != nil || info.PE != nil || info.SHA256 != sha256Hex([]byte("not a PE image")) {
+		t.Errorf("Info(%s, false) = %+v, %v, want its hash", txt, info, err)
+	}
+	// the cached information is checked against peOnly too
+	if _, err := files.Info(txt, true); !errors.Is(err, ErrNotPE) {
+		t.Errorf("cached Info(%s, true) = %v, want ErrNotPE", txt, err)
+	}
+	if _, err := files.Info(large, false); err == nil {
+		t.Error("hashed a file larger than the maximum size")
+	}
+	if _, err := files.Info(dir, false); err == nil {
+		t.Error("hashed a directory")
+	}
+	if _, err := files.Info(filepath.Join(dir, "missing.exe"), false); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Info of a missing file = %v, want ErrNotExist", err)
+	}
+}
+
+// the magic is checked whether the image parses or not
+func TestIsPE(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name string
+		data []byte
+		want bool
+	}{
+		{name: "a.exe", data: peImage(t, nil), want: true},
+		{name: "truncated.exe", data: []byte("MZ\x90\x00"), want: true},
+		{name: "a.txt", data: []byte("not a PE image")},
+		{name: "empty.exe", data: nil},
+	}
+	for _, tt := range tests {
+		path := writeFile(t, dir, tt.name, tt.data)
+		if got, err := IsPE(path); got != tt.want || err != nil {
+			t.Errorf("IsPE(%s) = %v, %v, want %v", tt.name, got, err, tt.want)
+		}
+	}
+	if _, err := IsPE(filepath.Join(dir, "missing.exe")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("IsPE of a missing file = %v, want ErrNotExist", err)
+	}
+}
+
+func TestFilesCacheInvalidation(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "a.txt", []byte("first"))
+	files := NewFiles(0, 0)
+	if _, err := files.Info(path, false); err != nil {
+		t.Fatal(err)
+	}
+	// a file changing is hashed again, its size or its modification time changed
+	writeFile(t, dir, "a.txt", []byte("second"))
+	info, err := files.Info(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.SHA256 != sha256Hex([]byte("second")) {
+		t.Error("the information of a changed file was served from the cache")
+	}
+	later := time.Now().Add(time.Hour)
+	writeFile(t, dir, "a.txt", []byte("third!"))
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := files.Info(path, false); info.SHA256 != sha256Hex([]byte("third!")) {
+		t.Error("the information of a file changed with the same size was served from the cache")
+	}
+}
+
+func TestFilesCacheEviction(t *testing.T) {
+	files := NewFiles(0, 2)
+	key := func(path string) cacheKey {
+		return cacheKey{path: path}
+	}
+	files.put(key("a"), FileInfo{SHA256: "a"})
+	files.put(key("b"), FileInfo{SHA256: "b"})
+	// a is used again, b is the least recently used one
+	if _, ok := files.get(key("a")); !ok {
+		t.Fatal("a isn't cached")
+	}
+	files.put(key("c"), FileInfo{SHA256: "c"})
+	if _, ok := files.get(key("b")); ok {
+		t.Error("b was kept over the recently used a")
+	}
+	for _, path := range []string{"a", "c"} {
+		if info, ok := files.get(key(path)); !ok || info.SHA256 != path {
+			t.Errorf("%s = %+v, %t, want it cached", path, info, ok)
+		}
+	}
+	// putting a cached file again doesn't duplicate it
+	files.put(key("a"), FileInfo{SHA256: "a"})
+	if files.lru.Len() != 2 || len(files.entries) != 2 {
+		t.Errorf("cache holds %d entries and %d keys, want 2", files.lru.Len(), len(files.entries))
+	}
+}
+
+func TestPool(t *testing.T) {
+	dir := t.TempDir()
+	data := []byte("hashed by the pool")
+	path := writeFile(t, dir, "a.txt", data)
+
+	// without workers, the files wait in the queue until it is full
+	idle := NewPool(NewFiles(0, 0), 0, 1)
+	defer idle.Close()
+	if _, err := idle.Info(path, false, time.Millisecond); !errors.Is(err, ErrTimeout) {
+		t.Errorf("Info without workers = %v, want ErrTimeout", err)
+	}
+	if _, err := idle.Info(path, false, time.Millisecond); !errors.Is(err, ErrBusy) {
+		t.Errorf("Info with a full queue = %v, want ErrBusy", err)
+	}
+
+	files := NewFiles(0, 0)
+	pool := NewPool(files, 1, 1)
+	info, err := pool.Info(path, false, time.Minute)
+	if err != nil || info.SHA256 != sha256Hex(data) {
+		t.Errorf("Info = %+v, %v, want the hash of the file", info, err)
+	}
+	if _, err := pool.Info(path, true, time.Minute); !errors.Is(err, ErrNotPE) {
+		t.Errorf("Info(peOnly) = %v, want ErrNotPE", err)
+	}
+	pool.Close()
+	if _, err := pool.Info(path, false, time.Minute); err == nil {
+		t.Error("a closed pool hashed a file")
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !windows
+
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package enrich
+
+import "os"
+
+// openFile opens a file for reading, other platforms don't lock the files being read
+func openFile(path string) (*os.File, error) {
+	return os.Open(path)
+}
@@ -0,0 +1,210 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package enrich
+
+import (
+	"bytes"
+	"crypto/md5"
+	"debug/pe"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+const (
+	dirEntryResource = 2
+	dirEntrySecurity = 4
+	// rtVersion is the resource type of the version information
+	rtVersion = 16
+)
+
+// PEInfo is the metadata of a PE image
+type PEInfo struct {
+	// Machine is the architecture of the image, e.g. amd64
+	Machine string `json:"machine"`
+	// Signed tells whether the image embeds an Authenticode signature, which is not verified
+	Signed           bool      `json:"signed"`
+	CompileTime      time.Time `json:"compileTime"`
+	OriginalFilename string    `json:"originalFilename,omitempty"`
+	// Imphash is the MD5 of the imported functions, as computed by pefile, ordinal imports excepted
+	Imphash string `json:"imphash,omitempty"`
+}
+
+var machines = map[uint16]string{
+	pe.IMAGE_FILE_MACHINE_I386:  "i386",
+	pe.IMAGE_FILE_MACHINE_AMD64: "amd64",
+	pe.IMAGE_FILE_MACHINE_ARM:   "arm",
+	pe.IMAGE_FILE_MACHINE_ARMNT: "armnt",
+	pe.IMAGE_FILE_MACHINE_ARM64: "arm64",
+	pe.IMAGE_FILE_MACHINE_IA64:  "ia64",
+}
+
+// ParsePE reads the metadata of a PE image
+func ParsePE(r io.ReaderAt) (*PEInfo, error) {
+	f, err := pe.NewFile(r)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info := &PEInfo{
+		Machine:     machines[f.Machine],
+		CompileTime: time.Unix(int64(f.TimeDateStamp), 0).UTC(),
+	}
+	if info.Machine == "" {
+		info.Machine = fmt.Sprintf("0x%x", f.Machine)
+	}
+	var dirs []pe.DataDirectory
+	switch h := f.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		dirs = dataDirectories(h.DataDirectory[:], h.NumberOfRvaAndSizes)
+	case *pe.OptionalHeader64:
+		dirs = dataDirectories(h.DataDirectory[:], h.NumberOfRvaAndSizes)
+	}
+	if len(dirs) > dirEntrySecurity {
+		info.Signed = dirs[dirEntrySecurity].VirtualAddress != 0 && dirs[dirEntrySecurity].Size != 0
+	}
+	if len(dirs) > dirEntryResource && dirs[dirEntryResource].Size != 0 {
+		if version, ok := versionResource(f, dirs[dirEntryResource].VirtualAddress); ok {
+			info.OriginalFilename = versionString(version, "OriginalFilename")
+		}
+	}
+	// the imports are optional, a failure to read them leaves the imphash empty
+	if symbols, err := f.ImportedSymbols(); err == nil {
+		info.Imphash = imphash(symbols)
+	}
+	return info, nil
+}
+
+// dataDirectories returns the declared data directories, debug/pe only keeping the first 16 of malformed images
+// declaring more
+func dataDirectories(dirs []pe.DataDirectory, n uint32) []pe.DataDirectory {
+	if n < uint32(len(dirs)) {
+		return dirs[:n]
+	}
+	return dirs
+}
+
+// imphash hashes the symbols of debug/pe, formatted as function:library
+func imphash(symbols []string) string {
+	if len(symbols) == 0 {
+		return ""
+	}
+	entries := make([]string, 0, len(symbols))
+	for _, symbol := range symbols {
+		function, library, ok := strings.Cut(symbol, ":")
+		if !ok {
+			continue
+		}
+		library = strings.ToLower(library)
+		for _, ext := range []string{".dll", ".ocx", ".sys"} {
+			library = strings.TrimSuffix(library, ext)
+		}
+		entries = append(entries, library+"."+strings.ToLower(function))
+	}
+	sum := md5.Sum([]byte(strings.Join(entries, ",")))
+	return hex.EncodeToString(sum[:])
+}
+
+// sectionOf returns the data of the section containing an RVA, and the RVA of the section
+func sectionOf(f *pe.File, rva uint32) ([]byte, uint32, bool) {
+	for _, s := range f.Sections {
+		if rva >= s.VirtualAddress && rva < s.VirtualAddress+s.VirtualSize {
+			data, err := s.Data()
+			if err != nil {
+				return nil, 0, false
+			}
+			return data, s.VirtualAddress, true
+		}
+	}
+	return nil, 0, false
+}
+
+// versionResource returns the VS_VERSIONINFO of the first language of the version resource
+func versionResource(f *pe.File, rootRVA uint32) ([]byte, bool) {
+	data, sectionRVA, ok := sectionOf(f, rootRVA)
+	if !ok {
+		return nil, false
+	}
+	root := rootRVA - sectionRVA
+	// the resource tree has three levels: type, name and language
+	offset := root
+	for level := 0; level < 3; level++ {
+		var id uint32
+		if level == 0 {
+			id = rtVersion
+		}
+		entry, ok := resourceEntry(data, offset, level == 0, id)
+		if !ok {
+			return nil, false
+		}
+		if level < 2 {
+			if entry&0x80000000 == 0 {
+				return nil, false
+			}
+			offset = root + entry&0x7fffffff
+			continue
+		}
+		offset = root + entry
+	}
+	// IMAGE_RESOURCE_DATA_ENTRY: RVA and size of the data
+	if uint64(offset)+8 > uint64(len(data)) {
+		return nil, false
+	}
+	dataRVA := binary.LittleEndian.Uint32(data[offset:])
+	size := binary.LittleEndian.Uint32(data[offset+4:])
+	if dataRVA < sectionRVA || uint64(dataRVA-sectionRVA)+uint64(size) > uint64(len(data)) {
+		return nil, false
+	}
+	return data[dataRVA-sectionRVA : dataRVA-sectionRVA+size], true
+}
+
+// resourceEntry returns the offset of the entry with the given ID of an IMAGE_RESOURCE_DIRECTORY, or of its first entry
+func resourceEntry(data []byte, offset uint32, byID bool, id uint32) (uint32, bool) {
+	if uint64(offset)+16 > uint64(len(data)) {
+		return 0, false
+	}
+	named := uint32(binary.LittleEndian.Uint16(data[offset+12:]))
+	ids := uint32(binary.LittleEndian.Uint16(data[offset+14:]))
+	for i := uint32(0); i < named+ids; i++ {
+		entry := offset + 16 + i*8
+		if uint64(entry)+8 > uint64(len(data)) {
+			return 0, false
+		}
+		name := binary.LittleEndian.Uint32(data[entry:])
+		if !byID || (i >= named && name == id) {
+			return binary.LittleEndian.Uint32(data[entry+4:]), true
+		}
+	}
+	return 0, false
+}
+
+// versionString finds the value of a key of the string tables of a VS_VERSIONINFO
+func versionString(version []byte, key string) string {
+	var encodedKey []byte
+	for _, c := range utf16.Encode([]rune(key + "\x00")) {
+		encodedKey = binary.LittleEndian.AppendUint16(encodedKey, c)
+	}
+	i := bytes.Index(version, encodedKey)
+	if i < 0 {
+		return ""
+	}
+	// the value follows the key, aligned on 32 bits
+	i += len(encodedKey)
+	i = (i + 3) &^ 3
+	var value []uint16
+	for ; i+1 < len(version); i += 2 {
+		c := binary.LittleEndian.Uint16(version[i:])
+		if c == 0 {
+			break
+		}
+		value = append(value, c)
+	}
+	return string(utf16.Decode(value))
+}
@@ -0,0 +1,107 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package enrich
+
+import (
+	"bytes"
+	"debug/pe"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// peImage builds a PE32+ image without sections, declaring the given number of data directories
+func peImage(t *testing.T, dirs []pe.DataDirectory) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	dos := make([]byte, 0x40)
+	copy(dos, "MZ")
+	binary.LittleEndian.PutUint32(dos[0x3c:], 0x40)
+	b.Write(dos)
+	b.WriteString("PE\x00\x00")
+	header := pe.FileHeader{
+		Machine:              pe.IMAGE_FILE_MACHINE_AMD64,
+		TimeDateStamp:        1700000000,
+		SizeOfOptionalHeader: uint16(112 + 8*len(dirs)),
+	}
+	if err := binary.Write(&b, binary.LittleEndian, header); err != nil {
+		t.Fatal(err)
+	}
+	optional := make([]byte, 112)
+	binary.LittleEndian.PutUint16(optional, 0x20b)
+	binary.LittleEndian.PutUint32(optional[108:], uint32(len(dirs)))
+	b.Write(optional)
+	if err := binary.Write(&b, binary.LittleEndian, dirs); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestParsePE(t *testing.T) {
+	signed := make([]pe.DataDirectory, 16)
+	signed[dirEntrySecurity] = pe.DataDirectory{VirtualAddress: 0x1000, Size: 0x100}
+	tests := []struct {
+		name   string
+		dirs   []pe.DataDirectory
+		signed bool
+	}{
+		{name: "no directories", dirs: nil},
+		{name: "unsigned", dirs: make([]pe.DataDirectory, 16)},
+		{name: "signed", dirs: signed, signed: true},
+		{name: "fewer directories than the security one", dirs: make([]pe.DataDirectory, dirEntrySecurity)},
+		{name: "more directories than the optional header holds", dirs: append(signed, pe.DataDirectory{}), signed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := ParsePE(bytes.NewReader(peImage(t, tt.dirs)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Machine != "amd64" {
+				t.Errorf("Machine = %s, want amd64", info.Machine)
+			}
+			if want := time.Unix(1700000000, 0).UTC(); !info.CompileTime.Equal(want) {
+				t.Errorf("CompileTime = %v, want %v", info.CompileTime, want)
+			}
+			if info.Signed != tt.signed {
+				t.Errorf("Signed = %t, want %t", info.Signed, tt.signed)
+			}
+		})
+	}
+}
+
+func TestParsePENotPE(t *testing.T) {
+	if _, err := ParsePE(bytes.NewReader([]byte("#!/bin/sh\n"))); err == nil {
+		t.Error("ParsePE succeeded on a script")
+	}
+}
+
+func TestImphash(t *testing.T) {
+	tests := []struct {
+		name    string
+		symbols []string
+		want    string
+	}{
+		{name: "no imports", symbols: nil, want: ""},
+		{
+			name:    "lowercased without extensions",
+			symbols: []string{"CreateFileW:KERNEL32.dll", "MessageBoxA:USER32.dll"},
+			want:    "8c91e403f625258eb3069f8907c30cc4",
+		},
+		{
+			name:    "malformed symbols skipped",
+			symbols: []string{"WSAStartup:ws2_32.dll", "ordinal", "printf:msvcrt.dll"},
+			want:    "d64369982da2dd3033b882c001d91dda",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := imphash(tt.symbols); got != tt.want {
+				t.Errorf("imphash(%v) = %s, want %s", tt.symbols, got, tt.want)
+			}
+		})
+	}
+}
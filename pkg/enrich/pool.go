@@ -0,0 +1,90 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package enrich
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrBusy is returned by Pool.Info when too many files are waiting to be hashed
+var ErrBusy = errors.New("too many files being hashed")
+
+// ErrTimeout is returned by Pool.Info when a file takes too long to be hashed, its information is cached once it is
+var ErrTimeout = errors.New("timed out hashing the file")
+
+// Pool computes the information of files on a bounded number of workers, so that the callers don't wait for the
+// large files. Their information is still computed and cached for the next callers.
+type Pool struct {
+	files *Files
+	jobs  chan job
+	done  chan struct{}
+}
+
+type job struct {
+	path   string
+	peOnly bool
+	res    chan result
+}
+
+type result struct {
+	info FileInfo
+	err  error
+}
+
+// NewPool starts the workers computing the information of files, up to queueSize files wait for them
+func NewPool(files *Files, workers int, queueSize int) *Pool {
+	p := &Pool{
+		files: files,
+		jobs:  make(chan job, queueSize),
+		done:  make(chan struct{}),
+	}
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+func (p *Pool) work() {
+	for {
+		select {
+		case j := <-p.jobs:
+			info, err := p.files.Info(j.path, j.peOnly)
+			j.res <- result{info: info, err: err}
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// Info returns the information of a file like Files.Info, waiting up to timeout for a worker to compute it
+func (p *Pool) Info(path string, peOnly bool, timeout time.Duration) (FileInfo, error) {
+	// buffered so that the worker doesn't block once the caller gave up
+	j := job{path: path, peOnly: peOnly, res: make(chan result, 1)}
+	select {
+	case <-p.done:
+		return FileInfo{}, ErrBusy
+	default:
+	}
+	select {
+	case p.jobs <- j:
+	default:
+		return FileInfo{}, ErrBusy
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case r := <-j.res:
+		return r.info, r.err
+	case <-timer.C:
+		return FileInfo{}, ErrTimeout
+	}
+}
+
+// Close stops the workers, the files being hashed are still hashed
+func (p *Pool) Close() {
+	close(p.done)
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package enrich
+
+// Signer returns the subject of the certificate signing an executable, signatures are only verified on Windows
+func Signer(path string) (string, error) {
+	return "", ErrNotSigned
+}
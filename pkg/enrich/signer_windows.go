@@ -0,0 +1,86 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package enrich
+
+import (
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	crypt32              = windows.NewLazySystemDLL("crypt32.dll")
+	procCryptMsgGetParam = crypt32.NewProc("CryptMsgGetParam")
+	procCryptMsgClose    = crypt32.NewProc("CryptMsgClose")
+)
+
+// cmsgSignerCertInfoParam is CMSG_SIGNER_CERT_INFO_PARAM
+const cmsgSignerCertInfoParam = 7
+
+// Signer returns the subject of the certificate signing an executable, once its embedded Authenticode signature is
+// verified. Executables signed through a catalog, as many of Windows are, are reported as not signed.
+func Signer(path string) (string, error) {
+	name, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return "", err
+	}
+	if err := verifySignature(name); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrNotSigned, err)
+	}
+	var encoding, contentType, formatType uint32
+	var store, msg windows.Handle
+	err = windows.CryptQueryObject(
+		windows.CERT_QUERY_OBJECT_FILE,
+		unsafe.Pointer(name),
+		windows.CERT_QUERY_CONTENT_FLAG_PKCS7_SIGNED_EMBED,
+		windows.CERT_QUERY_FORMAT_FLAG_BINARY,
+		0, &encoding, &contentType, &formatType, &store, &msg, nil,
+	)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrNotSigned, err)
+	}
+	defer windows.CertCloseStore(store, 0)
+	defer procCryptMsgClose.Call(uintptr(msg))
+
+	var size uint32
+	if r, _, err := procCryptMsgGetParam.Call(uintptr(msg), cmsgSignerCertInfoParam, 0, 0, uintptr(unsafe.Pointer(&size))); r == 0 {
+		return "", err
+	}
+	info := make([]byte, size)
+	if r, _, err := procCryptMsgGetParam.Call(uintptr(msg), cmsgSignerCertInfoParam, 0, uintptr(unsafe.Pointer(&info[0])), uintptr(unsafe.Pointer(&size))); r == 0 {
+		return "", err
+	}
+	cert, err := windows.CertFindCertificateInStore(store, encoding, 0, windows.CERT_FIND_SUBJECT_CERT, unsafe.Pointer(&info[0]), nil)
+	if err != nil {
+		return "", err
+	}
+	defer windows.CertFreeCertificateContext(cert)
+	n := windows.CertGetNameString(cert, windows.CERT_NAME_SIMPLE_DISPLAY_TYPE, 0, nil, nil, 0)
+	subject := make([]uint16, n)
+	windows.CertGetNameString(cert, windows.CERT_NAME_SIMPLE_DISPLAY_TYPE, 0, nil, &subject[0], n)
+	return windows.UTF16ToString(subject), nil
+}
+
+// verifySignature checks the embedded signature of a file, without checking the revocation of the certificates
+func verifySignature(name *uint16) error {
+	file := &windows.WinTrustFileInfo{
+		Size:     uint32(unsafe.Sizeof(windows.WinTrustFileInfo{})),
+		FilePath: name,
+	}
+	data := &windows.WinTrustData{
+		Size:                            uint32(unsafe.Sizeof(windows.WinTrustData{})),
+		UIChoice:                        windows.WTD_UI_NONE,
+		RevocationChecks:                windows.WTD_REVOKE_NONE,
+		UnionChoice:                     windows.WTD_CHOICE_FILE,
+		FileOrCatalogOrBlobOrSgnrOrCert: unsafe.Pointer(file),
+		StateAction:                     windows.WTD_STATEACTION_VERIFY,
+	}
+	err := windows.WinVerifyTrustEx(windows.InvalidHWND, &windows.WINTRUST_ACTION_GENERIC_VERIFY_V2, data)
+	data.StateAction = windows.WTD_STATEACTION_CLOSE
+	windows.WinVerifyTrustEx(windows.InvalidHWND, &windows.WINTRUST_ACTION_GENERIC_VERIFY_V2, data)
+	return err
+}
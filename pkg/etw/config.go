@@ -11,12 +11,37 @@ package etw
 import (
 	"eolh/pkg/containers/runtime"
 	"eolh/pkg/engine"
+	"eolh/pkg/exclusions"
+	"eolh/pkg/metrics"
+	"eolh/pkg/streams"
 	"eolh/pkg/trace"
+	"time"
+
+	getw "local.packages/golang-etw/etw"
 )
 
+// Provider is an ETW provider to enable
+type Provider struct {
+	getw.Provider
+}
+
 type Config struct {
 	EngineConfig engine.Config
 	Sockets      runtime.Sockets
 	ChanEvents   chan trace.Event
-	Providers    []string
+	Providers    []Provider
+	// Exclusions are the rules excluding the events of processes, exclusions.Defaults when nil
+	Exclusions []exclusions.Rule
+	// Session configures the ETW session, its name defaults to DefaultSessionName
+	Session SessionConfig
+	// HashMaxSize is the size of the largest executable hashed, enrich.DefaultMaxFileSize when 0
+	HashMaxSize int64
+	// NetFlowWindow is how long the network events of a flow are aggregated, they are all reported when 0
+	NetFlowWindow time.Duration
+	// Stats are updated by the pipeline, New creates them when nil
+	Stats *metrics.Stats
+	// Streams receive the events and the findings of the pipeline, when not nil
+	Streams *streams.Manager
+	// Channels track the occupancy of the pipeline channels, New creates them when nil
+	Channels *metrics.Channels
 }
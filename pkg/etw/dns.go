@@ -0,0 +1,42 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package etw
+
+import (
+	"eolh/pkg/trace"
+	"strings"
+)
+
+// dnsAnswers splits the QueryResults of DNS-Client, such as "type:  5 example.net;::ffff:93.184.216.34;", into the
+// names and addresses it resolved to
+func dnsAnswers(results string) []string {
+	answers := []string{}
+	for _, result := range strings.Split(results, ";") {
+		result = strings.TrimSpace(result)
+		if rest, ok := strings.CutPrefix(result, "type:"); ok {
+			// a record which isn't an address, e.g. a CNAME: its type and its data
+			fields := strings.Fields(rest)
+			if len(fields) < 2 {
+				continue
+			}
+			result = fields[len(fields)-1]
+		}
+		result = strings.TrimPrefix(result, "::ffff:")
+		if result != "" {
+			answers = append(answers, result)
+		}
+	}
+	return answers
+}
+
+// decodeDnsResponse adds the answers of a DNS response to its arguments
+func (e *Eolh) decodeDnsResponse(evt *trace.Event) error {
+	evt.Args = append(evt.Args, trace.Argument{
+		ArgMeta: trace.ArgMeta{Name: "answers", Type: "[]string"},
+		Value:   dnsAnswers(argString(evt, "QueryResults")),
+	})
+	return nil
+}
@@ -0,0 +1,33 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package etw
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDnsAnswers(t *testing.T) {
+	tests := []struct {
+		results string
+		want    []string
+	}{
+		{results: "", want: []string{}},
+		{results: "93.184.216.34;", want: []string{"93.184.216.34"}},
+		{results: "::ffff:93.184.216.34;::ffff:93.184.216.35;", want: []string{"93.184.216.34", "93.184.216.35"}},
+		{results: "2606:2800:220:1:248:1893:25c8:1946;", want: []string{"2606:2800:220:1:248:1893:25c8:1946"}},
+		{
+			results: "type:  5 edge.example.net;::ffff:93.184.216.34;",
+			want:    []string{"edge.example.net", "93.184.216.34"},
+		},
+		{results: "type:  5;  ; 10.0.0.1", want: []string{"10.0.0.1"}},
+	}
+	for _, tt := range tests {
+		if got := dnsAnswers(tt.results); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("dnsAnswers(%q) = %q, want %q", tt.results, got, tt.want)
+		}
+	}
+}
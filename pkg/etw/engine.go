@@ -14,8 +14,12 @@ import (
 	"eolh/pkg/detect"
 	"eolh/pkg/engine"
 	"eolh/pkg/logger"
+	"eolh/pkg/metrics"
+	"eolh/pkg/proctree"
 	"eolh/pkg/protocol"
 	"eolh/pkg/trace"
+	"sync"
+	"time"
 )
 
 func (e *Eolh) engineEvents(ctx context.Context, in <-chan *trace.Event) (<-chan *trace.Event, <-chan error) {
@@ -24,9 +28,29 @@ func (e *Eolh) engineEvents(ctx context.Context, in <-chan *trace.Event) (<-chan
 
 	engineOutput := make(chan detect.Finding, 100)
 	engineInput := make(chan protocol.Event)
-	source := engine.EventSources{Eolh: engineInput}
+	engineSignals := make(chan detect.Signal, 100)
+	metrics.TrackChannel(e.config.Channels, "engine", out)
+	metrics.TrackChannel(e.config.Channels, "engine_input", engineInput)
+	metrics.TrackChannel(e.config.Channels, "engine_signals", engineSignals)
+	metrics.TrackChannel(e.config.Channels, "engine_output", engineOutput)
+	source := engine.EventSources{Eolh: engineInput, Signals: engineSignals}
+	// the engine feeds the findings back to the signatures subscribed to them
+	e.config.EngineConfig.Feedback = func(f detect.Finding) (protocol.Event, error) {
+		event, err := FindingToEvent(f)
+		if err != nil {
+			return protocol.Event{}, err
+		}
+		return event.ToFindingProtocol(), nil
+	}
 
-	e.config.EngineConfig.DataSources = append(e.config.EngineConfig.DataSources, containers.NewDataSource(e.containers))
+	e.config.EngineConfig.DataSources = append(e.config.EngineConfig.DataSources, containers.NewDataSource(e.containers), proctree.NewDataSource(e.processTree))
+	e.containers.OnChange(func(change containers.ContainerChange) {
+		select {
+		case engineSignals <- containerSignal(change):
+		default:
+			logger.Debugw("Dropping container signal", "container", change.Container.ContainerId)
+		}
+	})
 
 	sigEngine, err := engine.NewEngine(e.config.EngineConfig, source, engineOutput)
 	if err != nil {
@@ -34,17 +58,28 @@ func (e *Eolh) engineEvents(ctx context.Context, in <-chan *trace.Event) (<-chan
 	}
 	e.sigEngine = sigEngine
 
-	go e.sigEngine.Start(ctx)
+	go func() {
+		defer close(e.engineDone)
+		defer close(engineOutput)
+		e.sigEngine.Start(ctx)
+	}()
 
 	// TODO: in the upcoming releases, the rule engine should be changed to receive trace.Event,
 	// and return a trace.Event, which should remove the necessity of converting trace.Event to protocol.Event,
 	// and converting detect.Finding into trace.Event
 
+	// out is shared by the events and the findings goroutines, close it once both are done
+	var wg sync.WaitGroup
+	wg.Add(2)
 	go func() {
-		defer close(out)
-		defer close(errc)
+		wg.Wait()
+		close(out)
+		close(errc)
+	}()
+
+	go func() {
+		defer wg.Done()
 		defer close(engineInput)
-		defer close(engineOutput)
 
 		for {
 			select {
@@ -71,10 +106,18 @@ func (e *Eolh) engineEvents(ctx context.Context, in <-chan *trace.Event) (<-chan
 				eventCopy := *event
 				// pass the event to the sink stage, if the event is also marked as emit
 				// it will be sent to print by the sink stage
-				out <- event
+				select {
+				case out <- event:
+				case <-ctx.Done():
+					return
+				}
 
 				// send the event to the rule event
-				engineInput <- eventCopy.ToProtocol()
+				select {
+				case engineInput <- eventCopy.ToProtocol():
+				case <-ctx.Done():
+					return
+				}
 				//}
 			case <-ctx.Done():
 				return
@@ -83,23 +126,48 @@ func (e *Eolh) engineEvents(ctx context.Context, in <-chan *trace.Event) (<-chan
 	}()
 
 	go func() {
-		for {
+		defer wg.Done()
+
+		// engineOutput is closed once the engine has flushed every signature
+		for finding := range engineOutput {
+			if finding.Event.Payload == nil {
+				continue // might happen during initialization (ctrl+c seg faults)
+			}
+			event, err := FindingToEvent(finding)
+			if err != nil {
+				// e.handleError(err)
+				continue
+			}
+			e.config.Stats.FindingCount.Add(1)
+			e.config.Stats.SignatureFindings.Add(finding.SigMetadata.ID, 1)
 			select {
-			case finding := <-engineOutput:
-				if finding.Event.Payload == nil {
-					continue // might happen during initialization (ctrl+c seg faults)
-				}
-				event, err := FindingToEvent(finding)
-				if err != nil {
-					// e.handleError(err)
-					continue
-				}
-				out <- event
+			case out <- event:
 			case <-ctx.Done():
-				return
+				// the pipeline is shutting down, hand findings flushed by the engine straight to the printers
+				select {
+				case e.config.ChanEvents <- *event:
+				default:
+					e.config.Stats.DroppedCount.Add(1)
+					logger.Warnw("Dropping finding flushed on shutdown", "signature", finding.SigMetadata.ID)
+				}
 			}
 		}
 	}()
 
 	return out, errc
 }
+
+func containerSignal(change containers.ContainerChange) detect.Signal {
+	container := detect.SignalContainer{
+		ContainerID:  change.Container.ContainerId,
+		Name:         change.Container.Name,
+		Image:        change.Container.Image,
+		PodName:      change.Container.Pod.Name,
+		PodNamespace: change.Container.Pod.Namespace,
+		Timestamp:    time.Now(),
+	}
+	if change.Removed {
+		return detect.SignalContainerStop(container)
+	}
+	return detect.SignalContainerStart(container)
+}
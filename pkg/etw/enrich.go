@@ -0,0 +1,174 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package etw
+
+import (
+	"eolh/pkg/enrich"
+	"eolh/pkg/events"
+	"eolh/pkg/logger"
+	"eolh/pkg/trace"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// maxTrackedFiles bounds the files tracked between their creation and their closing, as events may be lost
+	maxTrackedFiles = 1 << 16
+	// hashWorkers bounds the files hashed concurrently
+	hashWorkers = 2
+	// hashQueue bounds the files waiting to be hashed, the events of the others aren't enriched
+	hashQueue = 64
+	// hashWait bounds how long an event waits for its file to be hashed. The file is still hashed and cached for the
+	// next events when it takes longer.
+	hashWait = 100 * time.Millisecond
+)
+
+type trackedFile struct {
+	name    string
+	written bool
+}
+
+// openPath makes an NT path such as \Device\HarddiskVolume3\Windows\System32\cmd.exe openable
+func openPath(name string) string {
+	if strings.HasPrefix(name, `\Device\`) {
+		return `\\?\GLOBALROOT` + name
+	}
+	return name
+}
+
+func argString(evt *trace.Event, name string) string {
+	arg, ok := evt.Arg(name)
+	if !ok {
+		return ""
+	}
+	s, _ := arg.Value.(string)
+	return s
+}
+
+// addFileArgs adds the hash and the PE metadata of a file to the arguments of an event
+func addFileArgs(evt *trace.Event, info enrich.FileInfo) {
+	evt.Args = append(evt.Args,
+		trace.Argument{ArgMeta: trace.ArgMeta{Name: "sha256", Type: "string"}, Value: info.SHA256},
+		trace.Argument{ArgMeta: trace.ArgMeta{Name: "file_size", Type: "int64"}, Value: info.Size},
+	)
+	if info.PE == nil {
+		return
+	}
+	evt.Args = append(evt.Args,
+		trace.Argument{ArgMeta: trace.ArgMeta{Name: "pe_machine", Type: "string"}, Value: info.PE.Machine},
+		trace.Argument{ArgMeta: trace.ArgMeta{Name: "pe_signed", Type: "bool"}, Value: info.PE.Signed},
+		trace.Argument{ArgMeta: trace.ArgMeta{Name: "pe_compile_time", Type: "time.Time"}, Value: info.PE.CompileTime},
+		trace.Argument{ArgMeta: trace.ArgMeta{Name: "pe_original_filename", Type: "string"}, Value: info.PE.OriginalFilename},
+		trace.Argument{ArgMeta: trace.ArgMeta{Name: "pe_imphash", Type: "string"}, Value: info.PE.Imphash},
+	)
+}
+
+// enrichProcessImage hashes the image of a started process. Enrichment is best effort, its failures don't drop events.
+func (e *Eolh) enrichProcessImage(evt *trace.Event) error {
+	name := argString(evt, "ImageName")
+	if name == "" {
+		return nil
+	}
+	e.enrichLater(func() {
+		info, err := e.hashes.Info(openPath(name), false, hashWait)
+		if err != nil {
+			logger.Debugw("Hashing process image", "image", name, "error", err)
+			return
+		}
+		addFileArgs(evt, info)
+	})
+	return nil
+}
+
+// trackFileCreate remembers the name of a file object, the other file events only carry the object
+func (e *Eolh) trackFileCreate(evt *trace.Event) error {
+	object := argString(evt, "FileObject")
+	name := argString(evt, "FileName")
+	if object == "" || name == "" {
+		return nil
+	}
+	if len(e.trackedFiles) >= maxTrackedFiles {
+		logger.Debugw("Too many tracked files, forgetting them", "count", len(e.trackedFiles))
+		e.trackedFiles = make(map[string]*trackedFile)
+	}
+	if f, ok := e.trackedFiles[object]; ok && f.name == name {
+		return nil
+	}
+	e.trackedFiles[object] = &trackedFile{name: name}
+	return nil
+}
+
+// trackNewFile tracks a created file as written, as it may be written without file write events, e.g. when it is
+// mapped
+func (e *Eolh) trackNewFile(evt *trace.Event) error {
+	if err := e.trackFileCreate(evt); err != nil {
+		return err
+	}
+	return e.trackFileWrite(evt)
+}
+
+func (e *Eolh) trackFileWrite(evt *trace.Event) error {
+	if f, ok := e.trackedFiles[argString(evt, "FileObject")]; ok {
+		f.written = true
+	}
+	return nil
+}
+
+// enrichWrittenFile names the closed file and, when it was written, checks whether it is a PE image and hashes it. The
+// PE images are flagged whether they could be hashed or not.
+func (e *Eolh) enrichWrittenFile(evt *trace.Event) error {
+	object := argString(evt, "FileObject")
+	f, ok := e.trackedFiles[object]
+	if !ok {
+		return nil
+	}
+	delete(e.trackedFiles, object)
+	evt.Args = append(evt.Args, trace.Argument{ArgMeta: trace.ArgMeta{Name: "FileName", Type: "string"}, Value: f.name})
+	if !f.written {
+		return nil
+	}
+	e.enrichLater(func() {
+		path := openPath(f.name)
+		isPE, err := enrich.IsPE(path)
+		if err != nil {
+			logger.Debugw("Reading written file", "file", f.name, "error", err)
+		}
+		if !isPE {
+			return
+		}
+		evt.Args = append(evt.Args, trace.Argument{ArgMeta: trace.ArgMeta{Name: "is_pe", Type: "bool"}, Value: true})
+		info, err := e.hashes.Info(path, false, hashWait)
+		if err != nil {
+			logger.Debugw("Hashing written file", "file", f.name, "error", err)
+			return
+		}
+		addFileArgs(evt, info)
+	})
+	return nil
+}
+
+// registerEnrichment registers the processors hashing the executables behind events
+func (e *Eolh) registerEnrichment() error {
+	e.hashes = enrich.NewPool(enrich.NewFiles(e.config.HashMaxSize, 0), hashWorkers, hashQueue)
+	e.trackedFiles = make(map[string]*trackedFile)
+	processors := []struct {
+		id   events.ID
+		proc func(evt *trace.Event) error
+	}{
+		{events.ProcessStart, e.enrichProcessImage},
+		{events.FileCreate, e.trackFileCreate},
+		{events.FileCreateNew, e.trackNewFile},
+		{events.FileWrite, e.trackFileWrite},
+		{events.FileClose, e.enrichWrittenFile},
+	}
+	for _, p := range processors {
+		if err := e.RegisterEventProcessor(p.id, p.proc); err != nil {
+			return fmt.Errorf("registering the enrichment of %d: %w", p.id, err)
+		}
+	}
+	return nil
+}
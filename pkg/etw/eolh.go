@@ -11,140 +11,244 @@ package etw
 import (
 	"context"
 	"eolh/pkg/containers"
+	cruntime "eolh/pkg/containers/runtime"
 	"eolh/pkg/engine"
+	"eolh/pkg/enrich"
 	"eolh/pkg/events"
+	"eolh/pkg/exclusions"
+	"eolh/pkg/logger"
+	"eolh/pkg/metrics"
+	"eolh/pkg/proctree"
+	"eolh/pkg/signatures/plugin"
 	"eolh/pkg/trace"
+	"errors"
 	"fmt"
 	"os"
+	"runtime"
 	"sync"
 	"sync/atomic"
+	"time"
 
-	"github.com/Microsoft/go-winio/pkg/process"
-	goprocess "github.com/shirou/gopsutil/v3/process"
 	getw "local.packages/golang-etw/etw"
 )
 
+const systemPID = 4
+
+// engineFlushTimeout bounds how long Run waits for the signature engine to flush on shutdown, longer than plugin
+// signatures may take to flush their findings
+var engineFlushTimeout = plugin.ShutdownTimeout + 2*time.Second
+
 type eventConfig struct {
 	submit uint64
 	emit   uint64
 }
 
 type Eolh struct {
-	session            *getw.RealTimeSession
-	sigEngine          *engine.Engine
-	events             map[events.ID]eventConfig
-	eventsChannel      chan getw.Event
-	eventProcessor     map[events.ID][]func(evt *trace.Event) error
-	config             Config
-	containers         *containers.Containers
-	running            atomic.Bool
-	done               chan struct{}
-	eventsPool         *sync.Pool
-	pid                int
-	runtimePid         uint32
-	runtimeContainerID string
-	kubeletPid         uint32
-	defenderPid        uint32
+	session          Session
+	newConsumer      func(ctx context.Context) (Consumer, error)
+	sigEngine        *engine.Engine
+	events           map[events.ID]eventConfig
+	eventsChannel    chan getw.Event
+	eventProcessor   map[events.ID][]func(evt *trace.Event) error
+	config           Config
+	containers       *containers.Containers
+	processTree      *proctree.Tree
+	processEnricher  *processEnricher
+	hashes           *enrich.Pool
+	trackedFiles     map[string]*trackedFile
+	scriptBlocks     map[string]*scriptBlock
+	scriptBlocksSize int            // size of the text buffered in scriptBlocks
+	emitted          []*trace.Event // events made by the processors, passed along before the event processed
+	enrichments      []func()       // enrichments deferred by the processors of the event processed
+	running          atomic.Bool
+	done             chan struct{}
+	closeOnce        sync.Once
+	engineDone       chan struct{}
+	eventsPool       *sync.Pool
+	exclusions       *exclusions.Set
+	pid              int
+	hostContainerID  string
 }
 
 func New(cfg Config) *Eolh {
+	if cfg.Stats == nil {
+		cfg.Stats = &metrics.Stats{}
+	}
+	if cfg.Channels == nil {
+		cfg.Channels = &metrics.Channels{}
+	}
 	eolh := &Eolh{
-		session: getw.NewRealTimeSession("EolhEtw"),
-		config:  cfg,
-		done:    make(chan struct{}),
-		pid:     os.Getpid(),
+		session:         NewSession(cfg.Session, cfg.Providers),
+		config:          cfg,
+		done:            make(chan struct{}),
+		engineDone:      make(chan struct{}),
+		processTree:     proctree.New(proctree.FromSystem),
+		processEnricher: newProcessEnricher(),
+		pid:             os.Getpid(),
 	}
 
+	eolh.newConsumer = eolh.consume
 	eolh.registerEventProcessors()
 	return eolh
 }
 
 func (e *Eolh) Init() error {
-	// Exclude noisy benign host processes.
-	// TODO: Refactor me
-	containerdProcess := make([]*goprocess.Process, 0)
-	kubeletProcess := make([]*goprocess.Process, 0) // Prevent Infinite Loop
-	defenderProcess := make([]*goprocess.Process, 0)
-	processList, _ := process.EnumProcesses()
-	for _, p := range processList {
-		np, _ := goprocess.NewProcess(int32(p))
-		name, _ := np.Name()
-		if name == "containerd.exe" {
-			containerdProcess = append(containerdProcess, np)
-		}
-		if name == "kubelet.exe" {
-			kubeletProcess = append(kubeletProcess, np)
-		}
-		if name == "MsMpEng.exe" {
-			defenderProcess = append(defenderProcess, np)
-		}
-	}
-	if len(containerdProcess) != 1 {
-		return fmt.Errorf("Error: containerd.exe")
-	}
-	if len(kubeletProcess) != 1 {
-		return fmt.Errorf("Error: kubelet.exe")
+	rules := e.config.Exclusions
+	if rules == nil {
+		rules = exclusions.Defaults
 	}
-	if len(defenderProcess) != 1 {
-		return fmt.Errorf("Error: MsMpEng.exe")
+	// eolh would otherwise report the events caused by its own processing of events
+	rules = append([]exclusions.Rule{{Name: "self", PIDs: []uint32{uint32(e.pid)}}}, rules...)
+	set, err := exclusions.New(rules, func(path string) (string, error) {
+		return enrich.Signer(openPath(path))
+	})
+	if err != nil {
+		return fmt.Errorf("error initializing exclusions: %w", err)
 	}
-	e.runtimePid = uint32(containerdProcess[0].Pid)
-	e.kubeletPid = uint32(kubeletProcess[0].Pid)
-	e.defenderPid = uint32(defenderProcess[0].Pid)
+	e.exclusions = set
 
 	c, _ := containers.New(e.config.Sockets)
 	e.containers = c
 	if err := e.containers.Populate(); err != nil {
 		return fmt.Errorf("error initializing containers: %v", err)
 	}
-	metadata, err := e.containers.Enrich(int(e.runtimePid))
-	if err != nil {
-		return fmt.Errorf("error initializeing enrich: %v", err)
+	// host processes, such as the container runtime, share the session of the System process
+	if metadata, err := e.containers.Enrich(systemPID); err == nil {
+		e.hostContainerID = metadata.ContainerId
 	}
-	e.runtimeContainerID = metadata.ContainerId
 	e.eventsChannel = make(chan getw.Event, 1000)
+	metrics.TrackChannel(e.config.Channels, "etw", e.eventsChannel)
 	e.eventsPool = &sync.Pool{
 		New: func() interface{} {
 			return &trace.Event{}
 		},
 	}
-	for _, p := range e.config.Providers {
-		if err := e.session.EnableProvider(getw.MustParseProvider(p)); err != nil {
-			return err
-		}
-	}
-	return nil
+	return e.session.Start()
 }
 
 func (e *Eolh) Run(ctx context.Context) error {
 	defer e.Close()
-	c := getw.NewRealTimeConsumer(ctx)
-	defer c.Stop()
-
-	c.FromSessions(e.session)
-	go func() {
-		for ee := range c.Events {
-			e.eventsChannel <- *ee
-		}
-	}()
 	go e.handleEvents(ctx)
-	if err := c.Start(); err != nil {
+	go e.pruneProcessTree(ctx)
+	e.enrichProcesses(ctx)
+	c, err := e.newConsumer(ctx)
+	if err != nil {
 		return err
 	}
 	e.running.Store(true)
-	<-ctx.Done()
+	err = e.watchSession(ctx, c)
+	if e.config.EngineConfig.Enabled {
+		// give signatures a chance to report what they aggregated before the printers are closed
+		select {
+		case <-e.engineDone:
+		case <-time.After(engineFlushTimeout):
+			logger.Warnw("Timed out waiting for the signature engine to flush")
+		}
+	}
 	e.Close()
-	if c.Err() != nil {
-		return c.Err()
+	return err
+}
+
+// HealthChecks returns the checks telling whether the pipeline is alive
+func (e *Eolh) HealthChecks() map[string]func() error {
+	checks := map[string]func() error{
+		"etw": func() error {
+			if !e.running.Load() {
+				return errors.New("ETW session is not running")
+			}
+			return nil
+		},
+	}
+	if e.config.EngineConfig.Enabled {
+		checks["engine"] = func() error {
+			select {
+			case <-e.engineDone:
+				return errors.New("signature engine stopped")
+			default:
+				return nil
+			}
+		}
+	}
+	return checks
+}
+
+// Ready tells whether the pipeline started collecting events
+func (e *Eolh) Ready() error {
+	if !e.running.Load() {
+		return errors.New("not collecting events")
 	}
 	return nil
 }
 
-func (e *Eolh) Close() {
-	if e.session != nil {
-		e.session.Stop()
-		e.session.DisableAllProviders()
+// ReadinessChecks returns the checks telling whether the pipeline is ready, including those of the dependencies which
+// eolh survives the unavailability of, such as the container runtime
+func (e *Eolh) ReadinessChecks() map[string]func() error {
+	return map[string]func() error{
+		"collecting": e.Ready,
+		"containers": func() error {
+			if err := e.containers.Ping(); err != nil {
+				return fmt.Errorf("container runtime is unreachable: %w", err)
+			}
+			return nil
+		},
 	}
-	e.running.Store(false)
-	close(e.done)
+}
+
+// ContainerCount returns the number of known containers
+func (e *Eolh) ContainerCount() int {
+	if e.containers == nil {
+		return 0
+	}
+	return e.containers.Count()
+}
+
+// Diagnostics is a snapshot of the state of the pipeline, to look into a stalled eolh
+type Diagnostics struct {
+	Time       time.Time                  `json:"time"`
+	Running    bool                       `json:"running"`
+	Goroutines int                        `json:"goroutines"`
+	Channels   []metrics.Channel          `json:"channels"`
+	Containers map[uint32]cruntime.CRInfo `json:"containers"`
+	Processes  int                        `json:"processes"`
+	Stats      metrics.Snapshot           `json:"stats"`
+	Session    *SessionStats              `json:"session,omitempty"`
+}
+
+// Diagnostics returns the occupancy of the pipeline channels, the known containers and the counters
+func (e *Eolh) Diagnostics() Diagnostics {
+	d := Diagnostics{
+		Time:       time.Now(),
+		Running:    e.running.Load(),
+		Goroutines: runtime.NumGoroutine(),
+		Channels:   e.config.Channels.Snapshot(),
+		Stats:      e.config.Stats.Snapshot(),
+		Processes:  e.processTree.Len(),
+	}
+	if e.containers != nil {
+		d.Containers = e.containers.List()
+	}
+	if stats, err := e.session.Stats(); err == nil {
+		d.Session = &stats
+	}
+	return d
+}
+
+// Stats returns the counters of the pipeline
+func (e *Eolh) Stats() *metrics.Stats {
+	return e.config.Stats
+}
+
+func (e *Eolh) Close() {
+	e.closeOnce.Do(func() {
+		if e.session != nil {
+			if err := e.session.Stop(); err != nil {
+				logger.Warnw("Stopping the ETW session", "session", e.session.Name(), "error", err)
+			}
+		}
+		e.running.Store(false)
+		if e.hashes != nil {
+			e.hashes.Close()
+		}
+		close(e.done)
+	})
 }
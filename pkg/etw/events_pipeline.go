@@ -12,33 +12,39 @@ import (
 	"context"
 	"eolh/pkg/events"
 	"eolh/pkg/logger"
+	"eolh/pkg/metrics"
 	"eolh/pkg/trace"
+	"errors"
 	"fmt"
 	"strconv"
 
-	"github.com/shirou/gopsutil/v3/process"
 	"local.packages/golang-etw/etw"
 )
 
 func (e *Eolh) decodeEvents(outerCtx context.Context, sourceChan chan etw.Event) (<-chan *trace.Event, <-chan error) {
 	out := make(chan *trace.Event, 10000)
+	metrics.TrackChannel(e.config.Channels, "decode", out)
 	errc := make(chan error, 1)
 	go func() {
 		defer close(out)
 		defer close(errc)
 		for dataRaw := range sourceChan {
-			pid := dataRaw.EventData["ProcessID"]
-			var num uint64
-			// Fixme
-			if pid == nil {
+			e.config.Stats.ProviderEvents.Add(dataRaw.System.Provider.Name, 1)
+			e.updateProcessTree(dataRaw)
+			pid, ok := eventProcessID(dataRaw)
+			if !ok {
+				e.config.Stats.FilteredCount.Add(1)
 				continue
 			}
-			num, _ = strconv.ParseUint(pid.(string), 10, 64)
-			if num == uint64(e.pid) || num == uint64(e.runtimePid) || num == 0 || num == 4 || num == uint64(e.kubeletPid) || num == uint64(e.defenderPid) {
+			if e.excluded(pid) {
 				continue
 			}
-			num = uint64(dataRaw.System.Execution.ProcessID)
-			metadata, err := e.containers.Enrich(int(num))
+			num := uint64(dataRaw.System.Execution.ProcessID)
+			// network events are reported in the context of any process, their PID field tells the owner
+			if pid, ok := eventDataUint(dataRaw, "PID"); ok {
+				num = uint64(pid)
+			}
+			metadata, _ := e.containers.Enrich(int(num))
 
 			containerData := trace.Container{
 				ID:          metadata.ContainerId,
@@ -59,23 +65,19 @@ func (e *Eolh) decodeEvents(outerCtx context.Context, sourceChan chan etw.Event)
 			evt.Container = containerData
 			evt.Kubernetes = kubernetesData
 			evt.ContainerID = containerData.ID
-			evt.IsHost = evt.ContainerID == e.runtimeContainerID
+			evt.IsHost = evt.ContainerID == e.hostContainerID
 			evt.Cmdline = ""
 			evt.HostName = dataRaw.System.Computer
-			p, err := process.NewProcess(int32(num))
-			if err == nil {
-				name, err := p.Name()
-				if err == nil {
-					evt.ProcessName = name
-				}
-				parent, err := p.Parent()
-				if err == nil {
-					evt.ParentProcessID = int(parent.Pid)
-				}
-				cmdline, err := p.Cmdline()
-				if err == nil {
-					evt.Cmdline = cmdline
-				}
+			evt.ProcessName = ""
+			evt.ProcessImage = ""
+			evt.ParentProcessID = 0
+			evt.Ancestors = nil
+			if p, ok := e.processTree.Get(uint32(num)); ok {
+				evt.ProcessName = p.Name
+				evt.ProcessImage = p.ImageName
+				evt.ParentProcessID = int(p.PPID)
+				evt.Cmdline = p.Cmdline
+				evt.Ancestors = ancestors(e.processTree.Ancestors(uint32(num)))
 			}
 			evt.ProcessID = int(num)
 			tid := dataRaw.EventData["ThreadID"]
@@ -85,6 +87,8 @@ func (e *Eolh) decodeEvents(outerCtx context.Context, sourceChan chan etw.Event)
 				num, _ = strconv.ParseUint(tid.(string), 10, 64)
 			}
 			evt.ThreadID = int(num)
+			decodeDefinition(evt, dataRaw)
+			e.config.Stats.EventCount.Add(1)
 			select {
 			case out <- evt:
 			case <-outerCtx.Done():
@@ -95,6 +99,61 @@ func (e *Eolh) decodeEvents(outerCtx context.Context, sourceChan chan etw.Event)
 	return out, errc
 }
 
+// headerPIDEvents are the events which only carry the ID of their process in their header
+var headerPIDEvents = map[events.ID]bool{
+	events.FileCreate:          true,
+	events.FileCreateNew:       true,
+	events.FileClose:           true,
+	events.FileRead:            true,
+	events.FileWrite:           true,
+	events.FileDelete:          true,
+	events.FileRename:          true,
+	events.DnsRequest:          true,
+	events.DnsResponse:         true,
+	events.RegistryCreateKey:   true,
+	events.RegistryDeleteKey:   true,
+	events.RegistrySetValue:    true,
+	events.RegistryDeleteValue: true,
+	events.PowershellScript:    true,
+	events.PowershellModule:    true,
+}
+
+// eventProcessID returns the ID of the process of an ETW event, which the events are filtered by. It is false for the
+// events which don't tell it.
+func eventProcessID(dataRaw etw.Event) (uint32, bool) {
+	if pid, ok := eventDataUint(dataRaw, "ProcessID"); ok {
+		return pid, true
+	}
+	// the owner of network events, which are reported in the context of any process
+	if pid, ok := eventDataUint(dataRaw, "PID"); ok {
+		return pid, true
+	}
+	if def, ok := events.Lookup(dataRaw.System.Provider.Name, dataRaw.System.EventID); ok && headerPIDEvents[def.ID32Bit] {
+		return dataRaw.System.Execution.ProcessID, true
+	}
+	return 0, false
+}
+
+// decodeDefinition names the event after its definition and extracts its arguments from the ETW event data
+func decodeDefinition(evt *trace.Event, dataRaw etw.Event) {
+	def, ok := events.Lookup(dataRaw.System.Provider.Name, dataRaw.System.EventID)
+	if !ok {
+		evt.EventID = 0
+		evt.EventName = ""
+		evt.Args = nil
+		return
+	}
+	evt.EventID = int(def.ID32Bit)
+	evt.EventName = def.Name
+	evt.Args = make([]trace.Argument, 0, len(def.Params))
+	for _, param := range def.Params {
+		evt.Args = append(evt.Args, trace.Argument{
+			ArgMeta: param,
+			Value:   dataRaw.EventData[param.Name],
+		})
+	}
+}
+
 func (e *Eolh) handleEvents(ctx context.Context) {
 	var errcList []<-chan error
 
@@ -103,6 +162,10 @@ func (e *Eolh) handleEvents(ctx context.Context) {
 	errcList = append(errcList, errc)
 
 	eventsChan, errc = e.processEvents(ctx, eventsChan)
+	if e.config.NetFlowWindow > 0 {
+		eventsChan, errc = e.aggregateFlows(ctx, eventsChan)
+		errcList = append(errcList, errc)
+	}
 	if e.config.EngineConfig.Enabled {
 		eventsChan, errc = e.engineEvents(ctx, eventsChan)
 		errcList = append(errcList, errc)
@@ -112,12 +175,26 @@ func (e *Eolh) handleEvents(ctx context.Context) {
 	// TODO:error handling!
 }
 
+// enrichWindow bounds the events being enriched, or waiting for the events before them to be, past the processors
+const enrichWindow = 10000
+
+// pendingEvent is a processed event waiting for its enrichment, enriched is nil when it has none
+type pendingEvent struct {
+	evt      *trace.Event
+	enriched chan struct{}
+}
+
 func (e *Eolh) processEvents(ctx context.Context, in <-chan *trace.Event) (<-chan *trace.Event, <-chan error) {
 	out := make(chan *trace.Event, 10000)
+	metrics.TrackChannel(e.config.Channels, "process", out)
 	errc := make(chan error, 1)
+	// the processors run in order on a single goroutine, the enrichments they defer run concurrently and the events
+	// are passed along in order once enriched
+	pending := make(chan pendingEvent, enrichWindow)
+	go passEnriched(ctx, pending, out)
 
 	go func() {
-		defer close(out)
+		defer close(pending)
 		defer close(errc)
 
 		for event := range in {
@@ -127,27 +204,110 @@ func (e *Eolh) processEvents(ctx context.Context, in <-chan *trace.Event) (<-cha
 			}
 
 			errs := e.processEvent(event)
+			if !e.sendEmitted(ctx, pending) {
+				return
+			}
+			if len(errs) == 1 && errors.Is(errs[0], errSkipEvent) {
+				e.config.Stats.FilteredCount.Add(1)
+				e.eventsPool.Put(event)
+				continue
+			}
 			if len(errs) > 0 {
+				e.config.Stats.ErrorCount.Add(1)
 				logger.Debugw("process Event err")
 				// todo: error handling
 				continue
 			}
 			select {
-			case out <- event:
+			case pending <- e.enrich(event):
 			case <-ctx.Done():
 				return
 			}
 		}
+		e.flushScriptBlocks()
+		e.sendEmitted(ctx, pending)
 	}()
 	return out, errc
 }
 
+// passEnriched passes the processed events along in order, each once it is enriched
+func passEnriched(ctx context.Context, pending <-chan pendingEvent, out chan<- *trace.Event) {
+	defer close(out)
+	for p := range pending {
+		if p.enriched != nil {
+			select {
+			case <-p.enriched:
+			case <-ctx.Done():
+				return
+			}
+		}
+		select {
+		case out <- p.evt:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// enrichLater defers an enrichment of the event being processed, such as reading the command line of a started
+// process, so that the processing of the next events doesn't wait for it. The enrichments of an event run in turn,
+// only on the event.
+func (e *Eolh) enrichLater(enrich func()) {
+	e.enrichments = append(e.enrichments, enrich)
+}
+
+// enrich starts the enrichments deferred by the processors of an event
+func (e *Eolh) enrich(evt *trace.Event) pendingEvent {
+	p := pendingEvent{evt: evt}
+	if len(e.enrichments) == 0 {
+		return p
+	}
+	enrichments := e.enrichments
+	e.enrichments = nil
+	p.enriched = make(chan struct{})
+	go func() {
+		defer close(p.enriched)
+		for _, enrich := range enrichments {
+			enrich()
+		}
+	}()
+	return p
+}
+
+// emit passes along an event made by a processor, before the event being processed
+func (e *Eolh) emit(evt *trace.Event) {
+	e.emitted = append(e.emitted, evt)
+}
+
+// sendEmitted sends the events made by the processors, it returns false if the context is done
+func (e *Eolh) sendEmitted(ctx context.Context, pending chan<- pendingEvent) bool {
+	for i, evt := range e.emitted {
+		select {
+		case pending <- pendingEvent{evt: evt}:
+			e.emitted[i] = nil
+		case <-ctx.Done():
+			return false
+		}
+	}
+	e.emitted = e.emitted[:0]
+	return true
+}
+
+// errSkipEvent is returned by the processors which consumed an event, e.g. a part of a script block, so that it is not
+// passed along. The following processors of the event are not run.
+var errSkipEvent = errors.New("skip event")
+
 func (e *Eolh) processEvent(event *trace.Event) []error {
+	// the enrichments deferred for a previous event which wasn't passed along
+	e.enrichments = e.enrichments[:0]
 	eventId := events.ID(event.EventID)
 	processors := e.eventProcessor[eventId]
 	errs := []error{}
 	for _, procFunc := range processors {
 		err := procFunc(event)
+		if errors.Is(err, errSkipEvent) {
+			return []error{err}
+		}
 		if err != nil {
 			logger.Errorw("Error processing event", "event", event.EventName, "error", err)
 			errs = append(errs, err)
@@ -171,11 +331,29 @@ func (e *Eolh) registerEventProcessors() {
 	if e.eventProcessor == nil {
 		e.eventProcessor = make(map[events.ID][]func(evt *trace.Event) error)
 	}
-
+	if err := e.RegisterEventProcessor(events.ProcessStart, e.completeProcessStart); err != nil {
+		logger.Errorw("Registering event processors", "error", err)
+	}
+	if err := e.registerEnrichment(); err != nil {
+		logger.Errorw("Registering event processors", "error", err)
+	}
+	if err := e.RegisterEventProcessor(events.DnsResponse, e.decodeDnsResponse); err != nil {
+		logger.Errorw("Registering event processors", "error", err)
+	}
+	e.scriptBlocks = make(map[string]*scriptBlock)
+	if err := e.RegisterEventProcessor(events.PowershellScript, e.assembleScriptBlock); err != nil {
+		logger.Errorw("Registering event processors", "error", err)
+	}
+	for _, id := range []events.ID{events.RegistryCreateKey, events.RegistryDeleteKey, events.RegistrySetValue, events.RegistryDeleteValue} {
+		if err := e.RegisterEventProcessor(id, e.decodeRegistryEvent); err != nil {
+			logger.Errorw("Registering event processors", "error", err)
+		}
+	}
 }
 
 func (e *Eolh) sinkEvents(ctx context.Context, in <-chan *trace.Event) <-chan error {
 	errc := make(chan error, 1)
+	metrics.TrackChannel(e.config.Channels, "sink", e.config.ChanEvents)
 
 	go func() {
 		defer close(errc)
@@ -184,6 +362,9 @@ func (e *Eolh) sinkEvents(ctx context.Context, in <-chan *trace.Event) <-chan er
 			if event == nil {
 				continue // might happen during initialization (ctrl+c seg faults)
 			}
+			if e.config.Streams != nil {
+				e.config.Streams.Publish(event)
+			}
 			// Send the event to the printers.
 			if e.config.EngineConfig.Enabled && event.Message == "" {
 				continue
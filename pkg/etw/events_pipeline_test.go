@@ -0,0 +1,141 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package etw
+
+import (
+	"context"
+	"eolh/pkg/events"
+	"eolh/pkg/trace"
+	"testing"
+	"time"
+
+	"local.packages/golang-etw/etw"
+)
+
+func TestDecodeDefinition(t *testing.T) {
+	var dataRaw etw.Event
+	dataRaw.System.Provider.Name = "Microsoft-Windows-Kernel-Network"
+	dataRaw.System.EventID = 12
+	dataRaw.EventData = map[string]interface{}{"PID": "300", "daddr": "10.0.0.1", "dport": "443"}
+
+	evt := &trace.Event{}
+	decodeDefinition(evt, dataRaw)
+	if evt.EventName != "tcp_connect" || evt.EventID != int(events.TcpConnect) {
+		t.Fatalf("event = %d %q, want %d tcp_connect", evt.EventID, evt.EventName, events.TcpConnect)
+	}
+	args := make(map[string]interface{}, len(evt.Args))
+	for _, arg := range evt.Args {
+		args[arg.Name] = arg.Value
+	}
+	if len(evt.Args) != 6 || args["PID"] != "300" || args["daddr"] != "10.0.0.1" || args["dport"] != "443" {
+		t.Errorf("args = %+v", evt.Args)
+	}
+	if v, ok := args["saddr"]; !ok || v != nil {
+		t.Errorf("missing saddr = %v, %v, want nil argument", v, ok)
+	}
+
+	dataRaw.System.Provider.Name = "Microsoft-Windows-Kernel-Memory"
+	decodeDefinition(evt, dataRaw)
+	if evt.EventName != "" || evt.EventID != 0 || evt.Args != nil {
+		t.Errorf("unknown event decoded as %d %q %+v", evt.EventID, evt.EventName, evt.Args)
+	}
+}
+
+func TestEventProcessID(t *testing.T) {
+	tests := []struct {
+		name      string
+		provider  string
+		eventID   uint16
+		eventData map[string]interface{}
+		want      uint32
+		wantOK    bool
+	}{
+		{name: "process start", provider: "Microsoft-Windows-Kernel-Process", eventID: 1, eventData: map[string]interface{}{"ProcessID": "200"}, want: 200, wantOK: true},
+		{name: "network", provider: "Microsoft-Windows-Kernel-Network", eventID: 12, eventData: map[string]interface{}{"PID": "300"}, want: 300, wantOK: true},
+		{name: "file close", provider: "Microsoft-Windows-Kernel-File", eventID: 14, eventData: map[string]interface{}{"FileObject": "0xffff"}, want: 100, wantOK: true},
+		{name: "unknown file event", provider: "Microsoft-Windows-Kernel-File", eventID: 10, eventData: map[string]interface{}{"FileName": `\Device\file`}},
+		{name: "other provider", provider: "Microsoft-Windows-Kernel-Memory", eventID: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dataRaw etw.Event
+			dataRaw.System.Provider.Name = tt.provider
+			dataRaw.System.EventID = tt.eventID
+			dataRaw.System.Execution.ProcessID = 100
+			dataRaw.EventData = tt.eventData
+			pid, ok := eventProcessID(dataRaw)
+			if pid != tt.want || ok != tt.wantOK {
+				t.Errorf("eventProcessID() = %d, %v, want %d, %v", pid, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestEnrichKeepsOrder(t *testing.T) {
+	e := &Eolh{}
+	pending := make(chan pendingEvent, 3)
+	out := make(chan *trace.Event, 3)
+
+	release := make(chan struct{})
+	slow := &trace.Event{EventName: "slow"}
+	e.enrichLater(func() {
+		<-release
+		slow.Cmdline = "slow.exe"
+	})
+	pending <- e.enrich(slow)
+	fastEnriched := make(chan struct{})
+	fast := &trace.Event{EventName: "fast"}
+	e.enrichLater(func() {
+		fast.Cmdline = "fast.exe"
+		close(fastEnriched)
+	})
+	pending <- e.enrich(fast)
+	plain := &trace.Event{EventName: "plain"}
+	pending <- e.enrich(plain)
+	close(pending)
+
+	go passEnriched(context.Background(), pending, out)
+	// the events are enriched concurrently, but not passed along before the events before them
+	select {
+	case <-fastEnriched:
+	case <-time.After(time.Second):
+		t.Fatal("the enrichment of an event waited for the one of the previous event")
+	}
+	select {
+	case evt := <-out:
+		t.Fatalf("%s passed along before the previous event was enriched", evt.EventName)
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(release)
+	for _, want := range []*trace.Event{slow, fast, plain} {
+		select {
+		case evt := <-out:
+			if evt != want {
+				t.Fatalf("passed along %s, want %s", evt.EventName, want.EventName)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s not passed along", want.EventName)
+		}
+	}
+	if slow.Cmdline != "slow.exe" || fast.Cmdline != "fast.exe" {
+		t.Errorf("command lines = %q, %q, want the enriched ones", slow.Cmdline, fast.Cmdline)
+	}
+	if _, ok := <-out; ok {
+		t.Error("out not closed once the pending events are passed along")
+	}
+}
+
+// the enrichments deferred for an event which isn't passed along aren't run for the next one
+func TestProcessEventDropsEnrichments(t *testing.T) {
+	e := &Eolh{}
+	e.enrichLater(func() {
+		t.Error("ran the enrichment of a dropped event")
+	})
+	e.processEvent(&trace.Event{})
+	if p := e.enrich(&trace.Event{}); p.enriched != nil {
+		t.Error("the next event waits for an enrichment")
+	}
+}
@@ -0,0 +1,40 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package etw
+
+import (
+	"eolh/pkg/exclusions"
+)
+
+// excluded tells whether the events of a process are excluded, counting them by rule.
+// The processes are matched once and again after they start or stop, so that restarted services are excluded as well.
+func (e *Eolh) excluded(pid uint32) bool {
+	rule, ok := e.exclusions.Match(pid, func() exclusions.Process {
+		return e.excludableProcess(pid)
+	})
+	if !ok {
+		return false
+	}
+	e.config.Stats.ExcludedEvents.Add(rule, 1)
+	e.config.Stats.FilteredCount.Add(1)
+	return true
+}
+
+// excludableProcess gathers what exclusion rules match, for a process which may be unknown or gone
+func (e *Eolh) excludableProcess(pid uint32) exclusions.Process {
+	p := exclusions.Process{PID: pid}
+	if proc, ok := e.processTree.Get(pid); ok {
+		p.Image = proc.ImageName
+		if p.Image == "" {
+			p.Image = proc.Name
+		}
+	}
+	if metadata, err := e.containers.Enrich(int(pid)); err == nil {
+		p.ContainerID = metadata.ContainerId
+		p.ContainerName = metadata.Name
+	}
+	return p
+}
@@ -0,0 +1,176 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package etw
+
+import (
+	"context"
+	"eolh/pkg/events"
+	"eolh/pkg/metrics"
+	"eolh/pkg/netflow"
+	"eolh/pkg/trace"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+var flowKinds = map[events.ID]netflow.Kind{
+	events.TcpSend:           netflow.Send,
+	events.TcpRecv:           netflow.Recv,
+	events.TcpConnect:        netflow.Connect,
+	events.TcpDisconnect:     netflow.Disconnect,
+	events.TcpAccept:         netflow.Accept,
+	events.TcpSendIPv6:       netflow.Send,
+	events.TcpRecvIPv6:       netflow.Recv,
+	events.TcpConnectIPv6:    netflow.Connect,
+	events.TcpDisconnectIPv6: netflow.Disconnect,
+	events.TcpAcceptIPv6:     netflow.Accept,
+	events.UdpSend:           netflow.Send,
+	events.UdpRecv:           netflow.Recv,
+	events.UdpSendIPv6:       netflow.Send,
+	events.UdpRecvIPv6:       netflow.Recv,
+}
+
+func argUint(evt *trace.Event, name string, bitSize int) uint64 {
+	arg, ok := evt.Arg(name)
+	if !ok {
+		return 0
+	}
+	num, _ := strconv.ParseUint(fmt.Sprint(arg.Value), 10, bitSize)
+	return num
+}
+
+// toPacket reads a Kernel-Network event
+func toPacket(evt *trace.Event) (netflow.Packet, bool) {
+	id := events.ID(evt.EventID)
+	kind, ok := flowKinds[id]
+	if !ok {
+		return netflow.Packet{}, false
+	}
+	protocol := netflow.TCP
+	if id >= events.UdpSend && id <= events.UdpRecvIPv6 {
+		protocol = netflow.UDP
+	}
+	return netflow.Packet{
+		Key: netflow.Key{
+			ContainerID: evt.ContainerID,
+			ProcessID:   evt.ProcessID,
+			Protocol:    protocol,
+			SrcAddr:     argString(evt, "saddr"),
+			SrcPort:     uint16(argUint(evt, "sport", 16)),
+			DstAddr:     argString(evt, "daddr"),
+			DstPort:     uint16(argUint(evt, "dport", 16)),
+		},
+		Kind: kind,
+		Size: argUint(evt, "size", 32),
+		Time: evt.Timestamp,
+	}, true
+}
+
+// flowProcess keeps what describes the process of an event, to report it along with the flows of the process
+func flowProcess(evt *trace.Event) trace.Event {
+	return trace.Event{
+		ProcessID:       evt.ProcessID,
+		ParentProcessID: evt.ParentProcessID,
+		IsHost:          evt.IsHost,
+		ProcessName:     evt.ProcessName,
+		ProcessImage:    evt.ProcessImage,
+		Cmdline:         evt.Cmdline,
+		Ancestors:       evt.Ancestors,
+		HostName:        evt.HostName,
+		ContainerID:     evt.ContainerID,
+		Container:       evt.Container,
+		Kubernetes:      evt.Kubernetes,
+	}
+}
+
+func flowEvent(f netflow.Flow, process trace.Event) *trace.Event {
+	def := events.Definitions[events.NetFlow]
+	evt := process
+	evt.Timestamp = f.End
+	evt.EventID = int(events.NetFlow)
+	evt.EventName = def.Name
+	values := []interface{}{
+		f.Protocol, f.SrcAddr, f.SrcPort, f.DstAddr, f.DstPort, f.Direction,
+		f.BytesSent, f.BytesReceived, f.Packets, f.Start, f.End, f.Closed,
+	}
+	evt.Args = make([]trace.Argument, 0, len(def.Params))
+	for i, param := range def.Params {
+		evt.Args = append(evt.Args, trace.Argument{ArgMeta: param, Value: values[i]})
+	}
+	return &evt
+}
+
+// aggregateFlows replaces the send and receive events by a net_flow event per flow and window. The other network events
+// are passed along, and account for the flows as well.
+func (e *Eolh) aggregateFlows(ctx context.Context, in <-chan *trace.Event) (<-chan *trace.Event, <-chan error) {
+	out := make(chan *trace.Event, 10000)
+	metrics.TrackChannel(e.config.Channels, "net_flow", out)
+	errc := make(chan error, 1)
+
+	go func() {
+		defer close(out)
+		defer close(errc)
+
+		aggregator := netflow.NewAggregator()
+		processes := make(map[netflow.Key]trace.Event)
+		ticker := time.NewTicker(e.config.NetFlowWindow)
+		defer ticker.Stop()
+		flush := func() bool {
+			for _, f := range aggregator.Flush() {
+				select {
+				case out <- flowEvent(f, processes[f.Key]):
+				case <-ctx.Done():
+					return false
+				}
+			}
+			processes = make(map[netflow.Key]trace.Event)
+			return true
+		}
+
+		for {
+			select {
+			case event, ok := <-in:
+				if !ok {
+					flush()
+					return
+				}
+				if event == nil {
+					continue
+				}
+				packet, ok := toPacket(event)
+				if !ok {
+					select {
+					case out <- event:
+					case <-ctx.Done():
+						return
+					}
+					continue
+				}
+				aggregator.Add(packet)
+				if _, ok := processes[packet.Key]; !ok {
+					processes[packet.Key] = flowProcess(event)
+				}
+				if packet.Kind == netflow.Send || packet.Kind == netflow.Recv {
+					e.config.Stats.FilteredCount.Add(1)
+					e.eventsPool.Put(event)
+					continue
+				}
+				select {
+				case out <- event:
+				case <-ctx.Done():
+					return
+				}
+			case <-ticker.C:
+				if !flush() {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, errc
+}
@@ -0,0 +1,166 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package etw
+
+import (
+	"eolh/pkg/logger"
+	"eolh/pkg/trace"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// scriptBlockTimeout is how long the parts of a script block are kept waiting for the others
+	scriptBlockTimeout = time.Minute
+	// maxPendingScriptBlocks bounds the script blocks being reassembled
+	maxPendingScriptBlocks = 1024
+	// maxScriptBlockParts bounds the parts of a script block, those of more parts are reported part by part
+	maxScriptBlockParts = 1024
+	// maxScriptBlockSize bounds the text buffered for a script block, past it the parts are reported as they come
+	maxScriptBlockSize = 4 << 20
+	// maxScriptBlocksSize bounds the text buffered for all the script blocks
+	maxScriptBlocksSize = 64 << 20
+)
+
+type scriptBlock struct {
+	parts    []string
+	received int
+	size     int
+	first    time.Time
+	// event is the first part received, the parts of a block given up are reported in its context
+	event trace.Event
+	// oversized blocks were too large to reassemble, their remaining parts are reported as they come
+	oversized bool
+}
+
+// setArg replaces the value of an argument
+func setArg(evt *trace.Event, name string, value interface{}) {
+	for i := range evt.Args {
+		if evt.Args[i].Name == name {
+			evt.Args[i].Value = value
+			return
+		}
+	}
+}
+
+// setPartial flags whether a script block event carries only some of the parts of the block
+func setPartial(evt *trace.Event, partial bool) {
+	if _, ok := evt.Arg("partial"); ok {
+		setArg(evt, "partial", partial)
+		return
+	}
+	evt.Args = append(evt.Args, trace.Argument{ArgMeta: trace.ArgMeta{Name: "partial", Type: "bool"}, Value: partial})
+}
+
+// assembleScriptBlock reassembles the script blocks which PowerShell logs in several parts, the last part received is
+// reported with the whole text and the others are skipped. The parts of the blocks given up, because they are too large
+// or their other parts were lost, are reported as partial events.
+func (e *Eolh) assembleScriptBlock(evt *trace.Event) error {
+	setPartial(evt, false)
+	number, _ := strconv.Atoi(argString(evt, "MessageNumber"))
+	total, _ := strconv.Atoi(argString(evt, "MessageTotal"))
+	if total <= 1 || number < 1 || number > total {
+		return nil
+	}
+	id := argString(evt, "ScriptBlockId")
+	if total > maxScriptBlockParts {
+		logger.Debugw("Not reassembling a script block of too many parts", "id", id, "total", total)
+		setPartial(evt, true)
+		return nil
+	}
+	block, ok := e.scriptBlocks[id]
+	if ok && block.oversized {
+		if number == total {
+			e.dropScriptBlock(id)
+		}
+		setPartial(evt, true)
+		return nil
+	}
+	if !ok {
+		e.pruneScriptBlocks(evt.Timestamp)
+	} else if len(block.parts) != total || block.parts[number-1] != "" {
+		logger.Debugw("Restarting a script block on a duplicate part", "id", id, "number", number, "total", total)
+		// a duplicate part or a reused ID, start over
+		e.giveUpScriptBlock(id)
+		ok = false
+	}
+	if !ok {
+		block = &scriptBlock{parts: make([]string, total), first: evt.Timestamp, event: *evt}
+		block.event.Args = append([]trace.Argument(nil), evt.Args...)
+		e.scriptBlocks[id] = block
+	}
+	text := argString(evt, "ScriptBlockText")
+	if block.size+len(text) > maxScriptBlockSize || e.scriptBlocksSize+len(text) > maxScriptBlocksSize {
+		logger.Debugw("Not reassembling a script block too large", "id", id, "received", block.received, "total", total)
+		// the parts already received are reported, the size of their text is released but the block is kept to pass
+		// the next parts through
+		if block.received > 0 {
+			e.emit(e.partialScriptBlock(block))
+		}
+		e.scriptBlocksSize -= block.size
+		block.parts, block.received, block.size, block.oversized = nil, 0, 0, true
+		if number == total {
+			e.dropScriptBlock(id)
+		}
+		setPartial(evt, true)
+		return nil
+	}
+	block.parts[number-1] = text
+	block.received++
+	block.size += len(text)
+	e.scriptBlocksSize += len(text)
+	if block.received < total {
+		return errSkipEvent
+	}
+	e.dropScriptBlock(id)
+	setArg(evt, "ScriptBlockText", strings.Join(block.parts, ""))
+	setArg(evt, "MessageNumber", strconv.Itoa(total))
+	return nil
+}
+
+// partialScriptBlock makes an event of the parts received of a script block, in the context of its first part
+func (e *Eolh) partialScriptBlock(block *scriptBlock) *trace.Event {
+	evt := e.eventsPool.Get().(*trace.Event)
+	*evt = block.event
+	evt.Args = append([]trace.Argument(nil), block.event.Args...)
+	setArg(evt, "ScriptBlockText", strings.Join(block.parts, ""))
+	setPartial(evt, true)
+	return evt
+}
+
+// pruneScriptBlocks gives up the script blocks whose parts were lost
+func (e *Eolh) pruneScriptBlocks(now time.Time) {
+	for id, block := range e.scriptBlocks {
+		if now.Sub(block.first) > scriptBlockTimeout || len(e.scriptBlocks) >= maxPendingScriptBlocks {
+			logger.Debugw("Giving up an incomplete script block", "id", id, "received", block.received, "total", len(block.parts))
+			e.giveUpScriptBlock(id)
+		}
+	}
+}
+
+// flushScriptBlocks gives up all the script blocks being reassembled
+func (e *Eolh) flushScriptBlocks() {
+	for id := range e.scriptBlocks {
+		e.giveUpScriptBlock(id)
+	}
+}
+
+// giveUpScriptBlock forgets a script block and reports the parts received as a partial event
+func (e *Eolh) giveUpScriptBlock(id string) {
+	if block, ok := e.scriptBlocks[id]; ok && block.received > 0 {
+		e.emit(e.partialScriptBlock(block))
+	}
+	e.dropScriptBlock(id)
+}
+
+// dropScriptBlock forgets a script block and the size of its text
+func (e *Eolh) dropScriptBlock(id string) {
+	if block, ok := e.scriptBlocks[id]; ok {
+		e.scriptBlocksSize -= block.size
+		delete(e.scriptBlocks, id)
+	}
+}
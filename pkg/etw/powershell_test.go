@@ -0,0 +1,177 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package etw
+
+import (
+	"context"
+	"eolh/pkg/events"
+	"eolh/pkg/metrics"
+	"eolh/pkg/trace"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type scriptPart struct {
+	id     string
+	number int
+	total  int
+	text   string
+	time   time.Time
+}
+
+type scriptResult struct {
+	id      string
+	text    string
+	partial bool
+}
+
+// processScriptParts passes the parts of script blocks through processEvents and returns the events reported
+func processScriptParts(t *testing.T, parts []scriptPart) ([]scriptResult, *Eolh) {
+	t.Helper()
+	e := &Eolh{
+		config:       Config{Stats: &metrics.Stats{}, Channels: &metrics.Channels{}},
+		scriptBlocks: make(map[string]*scriptBlock),
+		eventsPool:   &sync.Pool{New: func() interface{} { return &trace.Event{} }},
+	}
+	e.eventProcessor = map[events.ID][]func(evt *trace.Event) error{
+		events.PowershellScript: {e.assembleScriptBlock},
+	}
+	in := make(chan *trace.Event, len(parts))
+	for _, p := range parts {
+		in <- &trace.Event{
+			EventID:   int(events.PowershellScript),
+			EventName: "powershell_script",
+			Timestamp: p.time,
+			Args: []trace.Argument{
+				{ArgMeta: trace.ArgMeta{Name: "MessageNumber", Type: "uint32"}, Value: strconv.Itoa(p.number)},
+				{ArgMeta: trace.ArgMeta{Name: "MessageTotal", Type: "uint32"}, Value: strconv.Itoa(p.total)},
+				{ArgMeta: trace.ArgMeta{Name: "ScriptBlockText", Type: "string"}, Value: p.text},
+				{ArgMeta: trace.ArgMeta{Name: "ScriptBlockId", Type: "string"}, Value: p.id},
+				{ArgMeta: trace.ArgMeta{Name: "Path", Type: "string"}, Value: ""},
+			},
+		}
+	}
+	close(in)
+	out, _ := e.processEvents(context.Background(), in)
+	var res []scriptResult
+	for evt := range out {
+		arg, ok := evt.Arg("partial")
+		if !ok {
+			t.Fatalf("event %s has no partial argument", argString(evt, "ScriptBlockId"))
+		}
+		res = append(res, scriptResult{
+			id:      argString(evt, "ScriptBlockId"),
+			text:    argString(evt, "ScriptBlockText"),
+			partial: arg.Value.(bool),
+		})
+	}
+	return res, e
+}
+
+func checkScriptResults(t *testing.T, got, want []scriptResult) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d events %+v, want %+v", len(got), got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("event %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestAssembleScriptBlock(t *testing.T) {
+	now := time.Now()
+	got, e := processScriptParts(t, []scriptPart{
+		{id: "a", number: 2, total: 3, text: "two ", time: now},
+		{id: "single", number: 1, total: 1, text: "whole", time: now},
+		{id: "a", number: 1, total: 3, text: "one ", time: now},
+		{id: "a", number: 3, total: 3, text: "three", time: now},
+	})
+	checkScriptResults(t, got, []scriptResult{
+		{id: "single", text: "whole"},
+		{id: "a", text: "one two three"},
+	})
+	if len(e.scriptBlocks) != 0 || e.scriptBlocksSize != 0 {
+		t.Errorf("%d blocks of %d bytes left", len(e.scriptBlocks), e.scriptBlocksSize)
+	}
+}
+
+func TestAssembleScriptBlockDuplicate(t *testing.T) {
+	now := time.Now()
+	got, _ := processScriptParts(t, []scriptPart{
+		{id: "a", number: 1, total: 2, text: "lost ", time: now},
+		{id: "a", number: 1, total: 2, text: "one ", time: now},
+		{id: "a", number: 2, total: 2, text: "two", time: now},
+	})
+	checkScriptResults(t, got, []scriptResult{
+		{id: "a", text: "lost ", partial: true},
+		{id: "a", text: "one two"},
+	})
+}
+
+func TestAssembleScriptBlockOversized(t *testing.T) {
+	now := time.Now()
+	large := strings.Repeat("x", maxScriptBlockSize)
+	got, e := processScriptParts(t, []scriptPart{
+		{id: "a", number: 1, total: 3, text: "one ", time: now},
+		{id: "a", number: 2, total: 3, text: large, time: now},
+		{id: "a", number: 3, total: 3, text: "three", time: now},
+		{id: "b", number: 1, total: 2, text: "one ", time: now},
+		{id: "b", number: 2, total: 2, text: "two", time: now},
+	})
+	checkScriptResults(t, got, []scriptResult{
+		{id: "a", text: "one ", partial: true},
+		{id: "a", text: large, partial: true},
+		{id: "a", text: "three", partial: true},
+		{id: "b", text: "one two"},
+	})
+	if len(e.scriptBlocks) != 0 || e.scriptBlocksSize != 0 {
+		t.Errorf("%d blocks of %d bytes left", len(e.scriptBlocks), e.scriptBlocksSize)
+	}
+}
+
+func TestAssembleScriptBlockTimeout(t *testing.T) {
+	now := time.Now()
+	got, _ := processScriptParts(t, []scriptPart{
+		{id: "a", number: 1, total: 3, text: "one ", time: now},
+		{id: "a", number: 3, total: 3, text: "three", time: now},
+		{id: "b", number: 1, total: 2, text: "one ", time: now.Add(scriptBlockTimeout / 2)},
+		{id: "c", number: 1, total: 2, text: "one ", time: now.Add(scriptBlockTimeout + time.Second)},
+		{id: "c", number: 2, total: 2, text: "two", time: now.Add(scriptBlockTimeout + time.Second)},
+	})
+	// b is still pending when c starts and is reported once the events end
+	checkScriptResults(t, got, []scriptResult{
+		{id: "a", text: "one three", partial: true},
+		{id: "c", text: "one two"},
+		{id: "b", text: "one ", partial: true},
+	})
+}
+
+func TestAssembleScriptBlockEvicted(t *testing.T) {
+	now := time.Now()
+	var parts []scriptPart
+	for i := 0; i <= maxPendingScriptBlocks; i++ {
+		parts = append(parts, scriptPart{id: fmt.Sprint(i), number: 1, total: 2, text: "one", time: now})
+	}
+	got, _ := processScriptParts(t, parts)
+	if len(got) != maxPendingScriptBlocks+1 {
+		t.Fatalf("got %d events, want %d", len(got), maxPendingScriptBlocks+1)
+	}
+	// the block evicted to make room for the last one is reported first, the others once the events end
+	if got[0].id == fmt.Sprint(maxPendingScriptBlocks) {
+		t.Errorf("the last block was evicted")
+	}
+	for _, r := range got {
+		if !r.partial || r.text != "one" {
+			t.Errorf("event %+v, want a partial one", r)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package etw
+
+import (
+	"context"
+	"eolh/pkg/events"
+	"eolh/pkg/logger"
+	"eolh/pkg/proctree"
+	"eolh/pkg/trace"
+	"strconv"
+	"sync"
+	"time"
+
+	"local.packages/golang-etw/etw"
+)
+
+const (
+	// processTreePruneInterval is how often the process tree is pruned
+	processTreePruneInterval = time.Minute
+	// processEnrichers bounds the concurrent reads of the command lines and containers of the started processes
+	processEnrichers = 4
+	// processEnrichQueue bounds the started processes waiting to be read, the others only have what their ETW event tells
+	processEnrichQueue = 1000
+	// processEnrichWait bounds how long a process start event waits for the command line of its process
+	processEnrichWait = time.Second
+)
+
+// processEnricher reads what the ETW events of the started processes don't tell from the system, off the decoding of
+// the events
+type processEnricher struct {
+	queue   chan enrichedProcess
+	mtx     sync.Mutex
+	pending map[uint32]chan struct{}
+}
+
+// enrichedProcess is a started process to be read, done is closed once it was
+type enrichedProcess struct {
+	pid       uint32
+	startTime time.Time
+	done      chan struct{}
+}
+
+func newProcessEnricher() *processEnricher {
+	return &processEnricher{
+		queue:   make(chan enrichedProcess, processEnrichQueue),
+		pending: make(map[uint32]chan struct{}),
+	}
+}
+
+// enqueue queues a started process to be read, it is left as is when the queue is full
+func (pe *processEnricher) enqueue(pid uint32, startTime time.Time) {
+	p := enrichedProcess{pid: pid, startTime: startTime, done: make(chan struct{})}
+	pe.mtx.Lock()
+	defer pe.mtx.Unlock()
+	select {
+	case pe.queue <- p:
+		pe.pending[pid] = p.done
+	default:
+		logger.Debugw("Too many started processes to read their command line", "pid", pid)
+	}
+}
+
+// finish marks a process as read
+func (pe *processEnricher) finish(p enrichedProcess) {
+	close(p.done)
+	pe.mtx.Lock()
+	defer pe.mtx.Unlock()
+	if pe.pending[p.pid] == p.done {
+		delete(pe.pending, p.pid)
+	}
+}
+
+// wait waits for a started process to be read, up to processEnrichWait or until done is closed
+func (pe *processEnricher) wait(done <-chan struct{}, pid uint32) {
+	pe.mtx.Lock()
+	read, ok := pe.pending[pid]
+	pe.mtx.Unlock()
+	if !ok {
+		return
+	}
+	timer := time.NewTimer(processEnrichWait)
+	defer timer.Stop()
+	select {
+	case <-read:
+	case <-timer.C:
+		logger.Debugw("Timed out reading the command line of a started process", "pid", pid)
+	case <-done:
+	}
+}
+
+// enrichProcesses reads the command lines and containers of the started processes until ctx is done
+func (e *Eolh) enrichProcesses(ctx context.Context) {
+	for i := 0; i < processEnrichers; i++ {
+		go func() {
+			for {
+				select {
+				case p := <-e.processEnricher.queue:
+					e.enrichProcess(p)
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+}
+
+func (e *Eolh) enrichProcess(p enrichedProcess) {
+	defer e.processEnricher.finish(p)
+	// the command line is not part of the event, read it while the process is alive
+	cmdline, err := proctree.Cmdline(p.pid)
+	if err != nil {
+		logger.Debugw("Reading the command line of a started process", "pid", p.pid, "error", err)
+	}
+	var containerID string
+	if metadata, err := e.containers.Enrich(int(p.pid)); err == nil {
+		containerID = metadata.ContainerId
+	}
+	e.processTree.Update(p.pid, p.startTime, func(tp *proctree.Process) {
+		tp.Cmdline = cmdline
+		tp.ContainerID = containerID
+	})
+}
+
+// completeProcessStart adds the command line of the started process to its event once it is read. The event waits for
+// it past the processors, the processing of the next events goes on.
+func (e *Eolh) completeProcessStart(evt *trace.Event) error {
+	// the event is reported in the context of the creator of the process, the payload tells the started one
+	pid, ok := eventDataUint(evt.RawEvent, "ProcessID")
+	if !ok {
+		return nil
+	}
+	e.enrichLater(func() {
+		e.processEnricher.wait(e.done, pid)
+		if p, ok := e.processTree.Get(pid); ok && p.StartTime.Equal(evt.Timestamp) {
+			evt.Cmdline = p.Cmdline
+		}
+	})
+	return nil
+}
+
+// eventDataUint parses a numeric field of the ETW event data
+func eventDataUint(dataRaw etw.Event, name string) (uint32, bool) {
+	value, ok := dataRaw.EventData[name].(string)
+	if !ok {
+		return 0, false
+	}
+	num, err := strconv.ParseUint(value, 0, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint32(num), true
+}
+
+// updateProcessTree adds the started processes to the tree and marks the stopped ones, before any event is filtered out
+// so that the tree knows the parents of the processes eolh reports
+func (e *Eolh) updateProcessTree(dataRaw etw.Event) {
+	def, ok := events.Lookup(dataRaw.System.Provider.Name, dataRaw.System.EventID)
+	if !ok {
+		return
+	}
+	switch def.ID32Bit {
+	case events.ProcessStart:
+		pid, ok := eventDataUint(dataRaw, "ProcessID")
+		if !ok {
+			return
+		}
+		ppid, _ := eventDataUint(dataRaw, "ParentProcessID")
+		sessionID, _ := eventDataUint(dataRaw, "SessionID")
+		imageName, _ := dataRaw.EventData["ImageName"].(string)
+		p := proctree.Process{
+			PID:       pid,
+			PPID:      ppid,
+			ImageName: imageName,
+			StartTime: dataRaw.System.TimeCreated.SystemTime,
+			SessionID: sessionID,
+		}
+		// only what the event tells is added inline, the rest is read from the system by the process enrichers
+		e.processTree.Start(p)
+		e.processEnricher.enqueue(pid, p.StartTime)
+		e.exclusions.Forget(pid)
+	case events.ProcessStop:
+		pid, ok := eventDataUint(dataRaw, "ProcessID")
+		if !ok {
+			return
+		}
+		e.processTree.Exit(pid, dataRaw.System.TimeCreated.SystemTime)
+		e.exclusions.Forget(pid)
+	}
+}
+
+// pruneProcessTree prunes the process tree periodically, it is otherwise only pruned as processes start
+func (e *Eolh) pruneProcessTree(ctx context.Context) {
+	ticker := time.NewTicker(processTreePruneInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			e.processTree.Prune(now)
+		}
+	}
+}
+
+// ancestors converts the ancestry of a process for events
+func ancestors(processes []proctree.Process) []trace.Ancestor {
+	if len(processes) == 0 {
+		return nil
+	}
+	res := make([]trace.Ancestor, 0, len(processes))
+	for _, p := range processes {
+		res = append(res, trace.Ancestor{
+			ProcessID:    int(p.PID),
+			ProcessName:  p.Name,
+			ProcessImage: p.ImageName,
+			Cmdline:      p.Cmdline,
+		})
+	}
+	return res
+}
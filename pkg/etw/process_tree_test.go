@@ -0,0 +1,147 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package etw
+
+import (
+	"context"
+	"eolh/pkg/containers"
+	cruntime "eolh/pkg/containers/runtime"
+	"eolh/pkg/events"
+	"eolh/pkg/exclusions"
+	"eolh/pkg/metrics"
+	"eolh/pkg/proctree"
+	"eolh/pkg/trace"
+	"sync"
+	"testing"
+	"time"
+
+	"local.packages/golang-etw/etw"
+)
+
+func TestProcessEnricherWait(t *testing.T) {
+	pe := newProcessEnricher()
+	start := time.Now()
+	pe.enqueue(10, start)
+	p := <-pe.queue
+
+	read := make(chan struct{})
+	go func() {
+		defer close(read)
+		pe.wait(nil, 10)
+	}()
+	select {
+	case <-read:
+		t.Fatal("didn't wait for the process to be read")
+	case <-time.After(10 * time.Millisecond):
+	}
+	pe.finish(p)
+	select {
+	case <-read:
+	case <-time.After(processEnrichWait / 2):
+		t.Fatal("still waiting for a process which was read")
+	}
+	if len(pe.pending) != 0 {
+		t.Errorf("%d processes still pending", len(pe.pending))
+	}
+
+	// processes which aren't pending aren't waited for
+	began := time.Now()
+	pe.wait(nil, 11)
+	if time.Since(began) >= processEnrichWait {
+		t.Error("waited for a process which wasn't queued")
+	}
+}
+
+func TestProcessEnricherFullQueue(t *testing.T) {
+	pe := newProcessEnricher()
+	for pid := uint32(1); pid <= processEnrichQueue+1; pid++ {
+		pe.enqueue(pid, time.Now())
+	}
+	if len(pe.pending) != processEnrichQueue {
+		t.Errorf("%d processes pending, want the %d queued", len(pe.pending), processEnrichQueue)
+	}
+	if _, ok := pe.pending[processEnrichQueue+1]; ok {
+		t.Error("the process beyond the queue is waited for")
+	}
+}
+
+func TestProcessEnricherWaitIsCancelled(t *testing.T) {
+	pe := newProcessEnricher()
+	pe.enqueue(10, time.Now())
+	done := make(chan struct{})
+	close(done)
+	began := time.Now()
+	pe.wait(done, 10)
+	if time.Since(began) >= processEnrichWait {
+		t.Error("kept waiting once done")
+	}
+}
+
+// a process start is reported in the context of the creator of the process, its command line is the started one's
+func TestProcessStartCommandLine(t *testing.T) {
+	c, err := containers.New(cruntime.Sockets{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	set, err := exclusions.New(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := &Eolh{
+		config:          Config{Stats: &metrics.Stats{}, Channels: &metrics.Channels{}},
+		containers:      c,
+		exclusions:      set,
+		processTree:     proctree.New(nil),
+		processEnricher: newProcessEnricher(),
+		eventsPool:      &sync.Pool{New: func() interface{} { return &trace.Event{} }},
+	}
+	e.eventProcessor = map[events.ID][]func(evt *trace.Event) error{
+		events.ProcessStart: {e.completeProcessStart},
+	}
+	start := time.Now()
+	e.processTree.Start(proctree.Process{PID: 1000, ImageName: `\Device\HarddiskVolume3\Windows\explorer.exe`, StartTime: start.Add(-time.Hour), Cmdline: "explorer.exe"})
+
+	var dataRaw etw.Event
+	dataRaw.System.Provider.Name = "Microsoft-Windows-Kernel-Process"
+	dataRaw.System.EventID = 1
+	dataRaw.System.Execution.ProcessID = 1000
+	dataRaw.System.TimeCreated.SystemTime = start
+	dataRaw.EventData = map[string]interface{}{
+		"ProcessID":       "2000",
+		"ParentProcessID": "1000",
+		"SessionID":       "1",
+		"ImageName":       `\Device\HarddiskVolume3\Windows\System32\cmd.exe`,
+	}
+	source := make(chan etw.Event, 1)
+	source <- dataRaw
+	close(source)
+	decoded, _ := e.decodeEvents(context.Background(), source)
+	out, _ := e.processEvents(context.Background(), decoded)
+
+	// the process enricher reads the command line of the started process
+	var p enrichedProcess
+	select {
+	case p = <-e.processEnricher.queue:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the started process wasn't queued to be read")
+	}
+	if p.pid != 2000 {
+		t.Errorf("read the command line of %d, want the started process 2000", p.pid)
+	}
+	e.processTree.Update(p.pid, p.startTime, func(tp *proctree.Process) {
+		tp.Cmdline = "cmd.exe /c whoami"
+	})
+	e.processEnricher.finish(p)
+
+	select {
+	case evt := <-out:
+		if evt.ProcessID != 1000 || evt.Cmdline != "cmd.exe /c whoami" {
+			t.Errorf("process start of %d with %q, want the one of 1000 with the command line of the started process", evt.ProcessID, evt.Cmdline)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the process start wasn't passed along")
+	}
+}
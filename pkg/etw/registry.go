@@ -0,0 +1,76 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package etw
+
+import (
+	"eolh/pkg/events"
+	"eolh/pkg/trace"
+	"fmt"
+	"strings"
+)
+
+// registryRoots map the kernel names of the registry roots to their usual abbreviation
+var registryRoots = []struct {
+	kernel string
+	root   string
+}{
+	{`\REGISTRY\MACHINE`, "HKLM"},
+	{`\REGISTRY\USER`, "HKU"},
+	{`\REGISTRY\A`, "HKA"},
+}
+
+// normalizeRegistryPath turns a kernel key path such as \REGISTRY\MACHINE\SOFTWARE into HKLM\SOFTWARE. The keys of
+// the interactive users, \REGISTRY\USER\S-1-5-21-...\ and their classes, are reported under HKCU.
+func normalizeRegistryPath(path string) string {
+	upper := strings.ToUpper(path)
+	for _, r := range registryRoots {
+		if upper != r.kernel && !strings.HasPrefix(upper, r.kernel+`\`) {
+			continue
+		}
+		rest := path[len(r.kernel):]
+		if r.root != "HKU" {
+			return r.root + rest
+		}
+		sid, key, _ := strings.Cut(strings.TrimPrefix(rest, `\`), `\`)
+		if !strings.HasPrefix(strings.ToUpper(sid), "S-1-5-21-") {
+			return r.root + rest
+		}
+		if strings.HasSuffix(strings.ToUpper(sid), "_CLASSES") {
+			key = strings.TrimSuffix(`Software\Classes\`+key, `\`)
+		}
+		if key == "" {
+			return "HKCU"
+		}
+		return `HKCU\` + key
+	}
+	return path
+}
+
+// decodeRegistryEvent adds the normalized key path to a registry event, and the path of the value to value events
+func (e *Eolh) decodeRegistryEvent(evt *trace.Event) error {
+	var keyPath string
+	if events.ID(evt.EventID) == events.RegistryCreateKey {
+		keyPath = argString(evt, "RelativeName")
+		// the created key is relative to an opened key unless it is absolute
+		if base := argString(evt, "BaseName"); base != "" && !strings.HasPrefix(keyPath, `\`) {
+			keyPath = strings.TrimSuffix(base, `\`) + `\` + keyPath
+		}
+	} else {
+		keyPath = argString(evt, "KeyName")
+	}
+	if keyPath == "" {
+		return nil
+	}
+	keyPath = normalizeRegistryPath(keyPath)
+	evt.Args = append(evt.Args, trace.Argument{ArgMeta: trace.ArgMeta{Name: "key_path", Type: "string"}, Value: keyPath})
+	if valueName, ok := evt.Arg("ValueName"); ok {
+		evt.Args = append(evt.Args, trace.Argument{
+			ArgMeta: trace.ArgMeta{Name: "target_object", Type: "string"},
+			Value:   keyPath + `\` + fmt.Sprint(valueName.Value),
+		})
+	}
+	return nil
+}
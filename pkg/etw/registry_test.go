@@ -0,0 +1,40 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package etw
+
+import "testing"
+
+func TestNormalizeRegistryPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: `\REGISTRY\MACHINE\SOFTWARE\Microsoft`, want: `HKLM\SOFTWARE\Microsoft`},
+		{path: `\Registry\Machine\System\CurrentControlSet`, want: `HKLM\System\CurrentControlSet`},
+		{path: `\REGISTRY\MACHINE`, want: `HKLM`},
+		{path: `\REGISTRY\MACHINEX\SOFTWARE`, want: `\REGISTRY\MACHINEX\SOFTWARE`},
+		{path: `\REGISTRY\A\{5d3e-app}\Settings`, want: `HKA\{5d3e-app}\Settings`},
+		{
+			path: `\REGISTRY\USER\S-1-5-21-1004336348-1177238915-682003330-1001\Software\Microsoft\Windows\CurrentVersion\Run`,
+			want: `HKCU\Software\Microsoft\Windows\CurrentVersion\Run`,
+		},
+		{path: `\REGISTRY\USER\S-1-5-21-1004336348-1177238915-682003330-1001`, want: `HKCU`},
+		{
+			path: `\REGISTRY\USER\S-1-5-21-1004336348-1177238915-682003330-1001_Classes\CLSID\{0000}`,
+			want: `HKCU\Software\Classes\CLSID\{0000}`,
+		},
+		{path: `\REGISTRY\USER\S-1-5-21-1004336348-1177238915-682003330-1001_Classes`, want: `HKCU\Software\Classes`},
+		{path: `\REGISTRY\USER\S-1-5-18\Software`, want: `HKU\S-1-5-18\Software`},
+		{path: `\REGISTRY\USER\.DEFAULT`, want: `HKU\.DEFAULT`},
+		{path: `HKLM\SOFTWARE`, want: `HKLM\SOFTWARE`},
+		{path: ``, want: ``},
+	}
+	for _, tt := range tests {
+		if got := normalizeRegistryPath(tt.path); got != tt.want {
+			t.Errorf("normalizeRegistryPath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package etw
+
+import (
+	"context"
+	"eolh/pkg/logger"
+	"errors"
+	"fmt"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/windows"
+	getw "local.packages/golang-etw/etw"
+)
+
+// Session controls the real-time ETW session the events are consumed from, so that it can be faked
+type Session interface {
+	// Name is the name of the session, consumers attach to it by name
+	Name() string
+	// Start creates the session, stopping an orphaned session of the same name, and enables the providers
+	Start() error
+	// Stop stops the session, it is not an error when the session doesn't exist
+	Stop() error
+	// Stats queries the counters of the running session, it fails with ErrSessionNotFound once the session is gone
+	Stats() (SessionStats, error)
+}
+
+// Consumer reads the events of a session into the pipeline, so that it can be faked
+type Consumer interface {
+	// Err returns the error which stopped the consumer, nil while it is consuming
+	Err() error
+	Stop() error
+}
+
+// SessionStats are the counters of an ETW session, they start over with every session
+type SessionStats struct {
+	Buffers             uint32 `json:"buffers"`
+	FreeBuffers         uint32 `json:"freeBuffers"`
+	EventsLost          uint32 `json:"eventsLost"`
+	BuffersWritten      uint32 `json:"buffersWritten"`
+	LogBuffersLost      uint32 `json:"logBuffersLost"`
+	RealTimeBuffersLost uint32 `json:"realTimeBuffersLost"`
+}
+
+// SessionConfig configures the ETW session
+type SessionConfig struct {
+	Name string
+	// BufferSize is the size of the buffers of the session in KB, DefaultBufferSize when 0
+	BufferSize uint32
+	// MinimumBuffers and MaximumBuffers bound the number of buffers of the session, ETW picks them when 0. Raise them
+	// when the session loses buffers under load.
+	MinimumBuffers uint32
+	MaximumBuffers uint32
+}
+
+const (
+	// DefaultSessionName is the name of the session when none is configured
+	DefaultSessionName = "EolhEtw"
+	// DefaultBufferSize is the buffer size of golang-etw sessions, in KB
+	DefaultBufferSize = 64
+	// maxBufferSize is the largest buffer size ETW accepts, in KB
+	maxBufferSize = 1024
+)
+
+// Validate checks the buffers of the config against the limits of ETW
+func (c SessionConfig) Validate() error {
+	if c.BufferSize > maxBufferSize {
+		return fmt.Errorf("ETW buffer size %d KB is over %d KB", c.BufferSize, maxBufferSize)
+	}
+	if c.MaximumBuffers != 0 && c.MaximumBuffers < c.MinimumBuffers {
+		return fmt.Errorf("ETW maximum buffers %d are fewer than the minimum buffers %d", c.MaximumBuffers, c.MinimumBuffers)
+	}
+	return nil
+}
+
+// ErrSessionNotFound is returned for a session which doesn't exist
+var ErrSessionNotFound = errors.New("ETW session not found")
+
+// realTimeSession is a real-time ETW session. It is started with the ETW API rather than with golang-etw, whose
+// sessions don't let the buffers be configured.
+type realTimeSession struct {
+	config    SessionConfig
+	providers []Provider
+	handle    syscall.Handle
+}
+
+// NewSession creates a real-time session enabling the providers once started
+func NewSession(config SessionConfig, providers []Provider) Session {
+	if config.Name == "" {
+		config.Name = DefaultSessionName
+	}
+	if config.BufferSize == 0 {
+		config.BufferSize = DefaultBufferSize
+	}
+	return &realTimeSession{config: config, providers: providers}
+}
+
+func (s *realTimeSession) Name() string {
+	return s.config.Name
+}
+
+func (s *realTimeSession) Start() error {
+	err := s.start()
+	if errors.Is(err, windows.ERROR_ALREADY_EXISTS) {
+		// a previous eolh didn't stop its session, e.g. as it crashed
+		if err := s.Stop(); err != nil {
+			return fmt.Errorf("stopping the orphaned ETW session %s: %w", s.config.Name, err)
+		}
+		err = s.start()
+	}
+	if err != nil {
+		return fmt.Errorf("starting the ETW session %s: %w", s.config.Name, err)
+	}
+	for _, p := range s.providers {
+		if err := s.enable(p); err != nil {
+			s.Stop()
+			return fmt.Errorf("enabling provider %s: %w", p.Name, err)
+		}
+	}
+	return nil
+}
+
+// start starts the session with the buffers of the config
+func (s *realTimeSession) start() error {
+	name, err := windows.UTF16PtrFromString(s.config.Name)
+	if err != nil {
+		return err
+	}
+	props := getw.NewRealTimeEventTraceSessionProperties(s.config.Name)
+	props.BufferSize = s.config.BufferSize
+	props.MinimumBuffers = s.config.MinimumBuffers
+	props.MaximumBuffers = s.config.MaximumBuffers
+	return getw.StartTrace(&s.handle, name, props)
+}
+
+// enable enables the provider in the session as golang-etw does, filtering its event IDs
+func (s *realTimeSession) enable(p Provider) error {
+	guid, err := getw.ParseGUID(p.GUID)
+	if err != nil {
+		return err
+	}
+	params := getw.EnableTraceParameters{Version: 2}
+	if len(p.Filter) > 0 {
+		fds := p.BuildFilterDesc()
+		params.EnableFilterDesc = &fds[0]
+		params.FilterDescCount = uint32(len(fds))
+	}
+	return getw.EnableTraceEx2(
+		s.handle,
+		guid,
+		getw.EVENT_CONTROL_CODE_ENABLE_PROVIDER,
+		p.EnableLevel,
+		p.MatchAnyKeyword,
+		p.MatchAllKeyword,
+		0,
+		&params,
+	)
+}
+
+// control controls the session by name, so that orphaned sessions are controlled as well
+func (s *realTimeSession) control(code uint32) (*getw.EventTraceProperties, error) {
+	name, err := windows.UTF16PtrFromString(s.config.Name)
+	if err != nil {
+		return nil, err
+	}
+	props := getw.NewRealTimeEventTraceSessionProperties(s.config.Name)
+	err = getw.ControlTrace(0, name, props, code)
+	switch {
+	case err == nil:
+		return props, nil
+	case errors.Is(err, windows.ERROR_WMI_INSTANCE_NOT_FOUND):
+		return nil, ErrSessionNotFound
+	default:
+		return nil, err
+	}
+}
+
+func (s *realTimeSession) Stop() error {
+	_, err := s.control(getw.EVENT_TRACE_CONTROL_STOP)
+	if errors.Is(err, ErrSessionNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (s *realTimeSession) Stats() (SessionStats, error) {
+	props, err := s.control(getw.EVENT_TRACE_CONTROL_QUERY)
+	if err != nil {
+		return SessionStats{}, err
+	}
+	return SessionStats{
+		Buffers:             props.NumberOfBuffers,
+		FreeBuffers:         props.FreeBuffers,
+		EventsLost:          props.EventsLost,
+		BuffersWritten:      props.BuffersWritten,
+		LogBuffersLost:      props.LogBuffersLost,
+		RealTimeBuffersLost: props.RealTimeBuffersLost,
+	}, nil
+}
+
+// variables rather than constants for the tests
+var (
+	// sessionCheckInterval is how often the session is queried for its counters and checked to be alive
+	sessionCheckInterval = 5 * time.Second
+	minRestartBackoff    = time.Second
+	maxRestartBackoff    = time.Minute
+)
+
+// consume starts a consumer of the session forwarding its events to the pipeline
+func (e *Eolh) consume(ctx context.Context) (Consumer, error) {
+	c := getw.NewRealTimeConsumer(ctx)
+	c.FromTraceNames(e.session.Name())
+	go func() {
+		for ee := range c.Events {
+			e.eventsChannel <- *ee
+		}
+	}()
+	if err := c.Start(); err != nil {
+		c.Stop()
+		return nil, err
+	}
+	return c, nil
+}
+
+// watchSession reports the lost events of the session and re-creates the session and its consumer, with backoff,
+// when either of them stops, e.g. as the session was stopped by another tool. It returns once ctx is done, with the
+// error of the consumer, or the last error re-creating them when they couldn't be.
+func (e *Eolh) watchSession(ctx context.Context, c Consumer) error {
+	ticker := time.NewTicker(sessionCheckInterval)
+	defer ticker.Stop()
+	var last SessionStats
+	backoff := minRestartBackoff
+	restarted := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			c.Stop()
+			return c.Err()
+		case <-ticker.C:
+		}
+		stats, err := e.session.Stats()
+		if err == nil && c.Err() == nil {
+			e.recordLost(last, stats)
+			last = stats
+			if time.Since(restarted) > maxRestartBackoff {
+				backoff = minRestartBackoff
+			}
+			continue
+		}
+		if err == nil {
+			err = c.Err()
+		}
+		logger.Warnw("ETW session stopped, re-creating it", "session", e.session.Name(), "error", err)
+		e.running.Store(false)
+		c.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return err
+			case <-time.After(backoff):
+			}
+			if backoff *= 2; backoff > maxRestartBackoff {
+				backoff = maxRestartBackoff
+			}
+			if err = e.session.Start(); err == nil {
+				var restartedConsumer Consumer
+				if restartedConsumer, err = e.newConsumer(ctx); err == nil {
+					c = restartedConsumer
+					break
+				}
+				e.session.Stop()
+			}
+			logger.Errorw("Re-creating the ETW session", "session", e.session.Name(), "error", err, "retry", backoff)
+		}
+		e.config.Stats.SessionRestarts.Add(1)
+		e.running.Store(true)
+		restarted = time.Now()
+		last = SessionStats{}
+	}
+}
+
+// recordLost adds what was lost since the previous query of the session to the stats
+func (e *Eolh) recordLost(prev, cur SessionStats) {
+	if cur.EventsLost > prev.EventsLost {
+		e.config.Stats.ETWEventsLost.Add(uint64(cur.EventsLost - prev.EventsLost))
+	}
+	lost := cur.LogBuffersLost + cur.RealTimeBuffersLost
+	if prevLost := prev.LogBuffersLost + prev.RealTimeBuffersLost; lost > prevLost {
+		e.config.Stats.ETWBuffersLost.Add(uint64(lost - prevLost))
+	}
+}
@@ -0,0 +1,225 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package etw
+
+import (
+	"context"
+	"eolh/pkg/metrics"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSession is gone until it is started again, its starts fail with the errors of startErrs in turn
+type fakeSession struct {
+	mutex     sync.Mutex
+	startErrs []error
+	starts    []time.Time
+	gone      bool
+}
+
+func (s *fakeSession) Name() string { return "EolhTest" }
+
+func (s *fakeSession) Start() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.starts = append(s.starts, time.Now())
+	if len(s.startErrs) > 0 {
+		err := s.startErrs[0]
+		s.startErrs = s.startErrs[1:]
+		if err != nil {
+			return err
+		}
+	}
+	s.gone = false
+	return nil
+}
+
+func (s *fakeSession) Stop() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.gone = true
+	return nil
+}
+
+func (s *fakeSession) Stats() (SessionStats, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.gone {
+		return SessionStats{}, ErrSessionNotFound
+	}
+	return SessionStats{EventsLost: 3}, nil
+}
+
+// fakeConsumer fails with stopErr once stopped
+type fakeConsumer struct {
+	mutex   sync.Mutex
+	err     error
+	stopErr error
+	stopped bool
+}
+
+func (c *fakeConsumer) Err() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.err
+}
+
+func (c *fakeConsumer) Stop() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.stopped = true
+	if c.stopErr != nil {
+		c.err = c.stopErr
+	}
+	return nil
+}
+
+// fastWatch shortens the intervals of watchSession for the test
+func fastWatch(t *testing.T) {
+	interval, minBackoff, maxBackoff := sessionCheckInterval, minRestartBackoff, maxRestartBackoff
+	sessionCheckInterval, minRestartBackoff, maxRestartBackoff = 5*time.Millisecond, 20*time.Millisecond, 60*time.Millisecond
+	t.Cleanup(func() {
+		sessionCheckInterval, minRestartBackoff, maxRestartBackoff = interval, minBackoff, maxBackoff
+	})
+}
+
+// watch runs watchSession until the condition holds
+func watch(t *testing.T, e *Eolh, c Consumer, until func() bool) error {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		errc <- e.watchSession(ctx, c)
+	}()
+	deadline := time.After(5 * time.Second)
+	for !until() {
+		select {
+		case <-deadline:
+			cancel()
+			t.Fatal("timed out waiting for the watchdog")
+		case <-time.After(time.Millisecond):
+		}
+	}
+	cancel()
+	return <-errc
+}
+
+func TestWatchSessionRestartsWithBackoff(t *testing.T) {
+	fastWatch(t)
+	startErr := errors.New("access denied")
+	session := &fakeSession{gone: true, startErrs: []error{startErr, startErr, startErr, nil}}
+	first := &fakeConsumer{}
+	var consumers []*fakeConsumer
+	var mutex sync.Mutex
+	e := &Eolh{
+		session: session,
+		config:  Config{Stats: &metrics.Stats{}},
+		newConsumer: func(ctx context.Context) (Consumer, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			c := &fakeConsumer{}
+			consumers = append(consumers, c)
+			return c, nil
+		},
+	}
+	e.running.Store(true)
+	err := watch(t, e, first, func() bool {
+		return e.config.Stats.SessionRestarts.Load() == 1 && e.config.Stats.ETWEventsLost.Load() == 3
+	})
+	if err != nil {
+		t.Errorf("watchSession() = %v, want nil", err)
+	}
+	if !first.stopped {
+		t.Error("the consumer of the stopped session was not stopped")
+	}
+	if len(consumers) != 1 || !consumers[0].stopped {
+		t.Errorf("want a single consumer of the re-created session, stopped on return, got %d", len(consumers))
+	}
+	if !e.running.Load() {
+		t.Error("not running after the session was re-created")
+	}
+	// the backoff doubles between the failed starts, up to the maximum
+	if len(session.starts) != 4 {
+		t.Fatalf("session started %d times, want 4", len(session.starts))
+	}
+	for i, want := range []time.Duration{40 * time.Millisecond, 60 * time.Millisecond, 60 * time.Millisecond} {
+		if got := session.starts[i+1].Sub(session.starts[i]); got < want {
+			t.Errorf("start %d came %v after the previous one, want at least %v", i+1, got, want)
+		}
+	}
+}
+
+func TestWatchSessionRestartsStoppedConsumers(t *testing.T) {
+	fastWatch(t)
+	c := &fakeConsumer{err: errors.New("ProcessTrace failed")}
+	e := &Eolh{
+		session: &fakeSession{},
+		config:  Config{Stats: &metrics.Stats{}},
+		newConsumer: func(ctx context.Context) (Consumer, error) {
+			return &fakeConsumer{}, nil
+		},
+	}
+	err := watch(t, e, c, func() bool { return e.config.Stats.SessionRestarts.Load() == 1 })
+	if err != nil {
+		t.Errorf("watchSession() = %v, want nil", err)
+	}
+	if !c.stopped {
+		t.Error("the failed consumer was not stopped")
+	}
+}
+
+func TestWatchSessionReturnsErrors(t *testing.T) {
+	fastWatch(t)
+	startErr := errors.New("access denied")
+	session := &fakeSession{gone: true, startErrs: []error{startErr, startErr, startErr, startErr, startErr}}
+	e := &Eolh{
+		session: session,
+		config:  Config{Stats: &metrics.Stats{}},
+		newConsumer: func(ctx context.Context) (Consumer, error) {
+			t.Error("consumer created for a session which couldn't be started")
+			return &fakeConsumer{}, nil
+		},
+	}
+	err := watch(t, e, &fakeConsumer{}, func() bool {
+		session.mutex.Lock()
+		defer session.mutex.Unlock()
+		return len(session.starts) >= 2
+	})
+	if !errors.Is(err, startErr) {
+		t.Errorf("watchSession() = %v, want %v", err, startErr)
+	}
+
+	// the error of the consumer is returned on shutdown
+	consumerErr := errors.New("ProcessTrace failed")
+	e.session = &fakeSession{}
+	err = watch(t, e, &fakeConsumer{stopErr: consumerErr}, func() bool { return true })
+	if !errors.Is(err, consumerErr) {
+		t.Errorf("watchSession() = %v, want %v", err, consumerErr)
+	}
+}
+
+func TestSessionConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  SessionConfig
+		wantErr bool
+	}{
+		{name: "defaults"},
+		{name: "buffers", config: SessionConfig{BufferSize: 256, MinimumBuffers: 64, MaximumBuffers: 128}},
+		{name: "only minimum buffers", config: SessionConfig{MinimumBuffers: 64}},
+		{name: "buffer size over 1 MB", config: SessionConfig{BufferSize: 2048}, wantErr: true},
+		{name: "maximum below minimum", config: SessionConfig{MinimumBuffers: 64, MaximumBuffers: 32}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,253 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package events
+
+import "eolh/pkg/trace"
+
+const (
+	kernelProcess = "Microsoft-Windows-Kernel-Process"
+	kernelFile    = "Microsoft-Windows-Kernel-File"
+	kernelNetwork = "Microsoft-Windows-Kernel-Network"
+	dnsClient     = "Microsoft-Windows-DNS-Client"
+	kernelReg     = "Microsoft-Windows-Kernel-Registry"
+	powerShell    = "Microsoft-Windows-PowerShell"
+)
+
+const (
+	ProcessStart ID = iota + 1
+	ProcessStop
+	ThreadStart
+	ThreadStop
+	ImageLoad
+	ImageUnload
+	FileCreate
+	FileCreateNew
+	FileClose
+	FileRead
+	FileWrite
+	FileDelete
+	FileRename
+	TcpSend
+	TcpRecv
+	TcpConnect
+	TcpDisconnect
+	TcpAccept
+	TcpSendIPv6
+	TcpRecvIPv6
+	TcpConnectIPv6
+	TcpDisconnectIPv6
+	TcpAcceptIPv6
+	UdpSend
+	UdpRecv
+	UdpSendIPv6
+	UdpRecvIPv6
+	// NetFlow is not an ETW event, it aggregates the network events of a flow
+	NetFlow
+	DnsRequest
+	DnsResponse
+	RegistryCreateKey
+	RegistryDeleteKey
+	RegistrySetValue
+	RegistryDeleteValue
+	PowershellScript
+	PowershellModule
+)
+
+var processParams = []trace.ArgMeta{
+	{Name: "ProcessID", Type: "uint32"},
+	{Name: "ParentProcessID", Type: "uint32"},
+	{Name: "SessionID", Type: "uint32"},
+	{Name: "ImageName", Type: "string"},
+}
+
+var processStopParams = []trace.ArgMeta{
+	{Name: "ProcessID", Type: "uint32"},
+	{Name: "ExitCode", Type: "uint32"},
+	{Name: "ImageName", Type: "string"},
+}
+
+var threadParams = []trace.ArgMeta{
+	{Name: "ProcessID", Type: "uint32"},
+	{Name: "ThreadID", Type: "uint32"},
+}
+
+var imageParams = []trace.ArgMeta{
+	{Name: "ImageBase", Type: "pointer"},
+	{Name: "ImageSize", Type: "pointer"},
+	{Name: "ProcessID", Type: "uint32"},
+	{Name: "ImageName", Type: "string"},
+}
+
+var fileParams = []trace.ArgMeta{
+	{Name: "FileObject", Type: "pointer"},
+	{Name: "FileName", Type: "string"},
+}
+
+var fileCreateParams = []trace.ArgMeta{
+	{Name: "FileObject", Type: "pointer"},
+	{Name: "CreateOptions", Type: "uint32"},
+	{Name: "ShareAccess", Type: "uint32"},
+	{Name: "FileName", Type: "string"},
+}
+
+var fileCloseParams = []trace.ArgMeta{
+	{Name: "FileObject", Type: "pointer"},
+}
+
+var fileIOParams = []trace.ArgMeta{
+	{Name: "FileObject", Type: "pointer"},
+	{Name: "ByteOffset", Type: "uint64"},
+	{Name: "IOSize", Type: "uint32"},
+}
+
+var tcpParams = []trace.ArgMeta{
+	{Name: "PID", Type: "uint32"},
+	{Name: "size", Type: "uint32"},
+	{Name: "daddr", Type: "string"},
+	{Name: "saddr", Type: "string"},
+	{Name: "dport", Type: "uint16"},
+	{Name: "sport", Type: "uint16"},
+}
+
+var udpParams = tcpParams
+
+var dnsRequestParams = []trace.ArgMeta{
+	{Name: "QueryName", Type: "string"},
+	{Name: "QueryType", Type: "uint32"},
+	{Name: "QueryOptions", Type: "uint64"},
+	{Name: "ServerList", Type: "string"},
+	{Name: "InterfaceIndex", Type: "uint32"},
+}
+
+var dnsResponseParams = []trace.ArgMeta{
+	{Name: "QueryName", Type: "string"},
+	{Name: "QueryType", Type: "uint32"},
+	{Name: "QueryOptions", Type: "uint64"},
+	{Name: "QueryStatus", Type: "uint32"},
+	{Name: "QueryResults", Type: "string"},
+}
+
+var registryCreateKeyParams = []trace.ArgMeta{
+	{Name: "BaseName", Type: "string"},
+	{Name: "RelativeName", Type: "string"},
+	{Name: "Status", Type: "uint32"},
+	{Name: "Disposition", Type: "uint32"},
+}
+
+var registryKeyParams = []trace.ArgMeta{
+	{Name: "KeyName", Type: "string"},
+	{Name: "Status", Type: "uint32"},
+}
+
+var registrySetValueParams = []trace.ArgMeta{
+	{Name: "KeyName", Type: "string"},
+	{Name: "ValueName", Type: "string"},
+	{Name: "Type", Type: "uint32"},
+	{Name: "DataSize", Type: "uint32"},
+	{Name: "Status", Type: "uint32"},
+}
+
+var registryValueParams = []trace.ArgMeta{
+	{Name: "KeyName", Type: "string"},
+	{Name: "ValueName", Type: "string"},
+	{Name: "Status", Type: "uint32"},
+}
+
+// powershellScriptParams are the arguments of the script blocks, which are reported once all their parts are logged.
+// The blocks given up before are reported in parts flagged by a "partial" argument.
+var powershellScriptParams = []trace.ArgMeta{
+	{Name: "MessageNumber", Type: "uint32"},
+	{Name: "MessageTotal", Type: "uint32"},
+	{Name: "ScriptBlockText", Type: "string"},
+	{Name: "ScriptBlockId", Type: "string"},
+	{Name: "Path", Type: "string"},
+}
+
+var powershellModuleParams = []trace.ArgMeta{
+	{Name: "ContextInfo", Type: "string"},
+	{Name: "UserData", Type: "string"},
+	{Name: "Payload", Type: "string"},
+}
+
+var netFlowParams = []trace.ArgMeta{
+	{Name: "protocol", Type: "string"},
+	{Name: "saddr", Type: "string"},
+	{Name: "sport", Type: "uint16"},
+	{Name: "daddr", Type: "string"},
+	{Name: "dport", Type: "uint16"},
+	{Name: "direction", Type: "string"},
+	{Name: "bytes_sent", Type: "uint64"},
+	{Name: "bytes_received", Type: "uint64"},
+	{Name: "packets", Type: "uint64"},
+	{Name: "start_time", Type: "time.Time"},
+	{Name: "end_time", Type: "time.Time"},
+	{Name: "closed", Type: "bool"},
+}
+
+// Definitions are the events decoded from the ETW events of the default providers
+var Definitions = map[ID]Event{
+	ProcessStart:        {ID32Bit: ProcessStart, Name: "process_start", Provider: kernelProcess, EtwID: 1, Sets: []string{"process"}, Params: processParams},
+	ProcessStop:         {ID32Bit: ProcessStop, Name: "process_stop", Provider: kernelProcess, EtwID: 2, Sets: []string{"process"}, Params: processStopParams},
+	ThreadStart:         {ID32Bit: ThreadStart, Name: "thread_start", Provider: kernelProcess, EtwID: 3, Sets: []string{"process"}, Params: threadParams},
+	ThreadStop:          {ID32Bit: ThreadStop, Name: "thread_stop", Provider: kernelProcess, EtwID: 4, Sets: []string{"process"}, Params: threadParams},
+	ImageLoad:           {ID32Bit: ImageLoad, Name: "image_load", Provider: kernelProcess, EtwID: 5, Sets: []string{"process"}, Params: imageParams},
+	ImageUnload:         {ID32Bit: ImageUnload, Name: "image_unload", Provider: kernelProcess, EtwID: 6, Sets: []string{"process"}, Params: imageParams},
+	FileCreate:          {ID32Bit: FileCreate, Name: "file_create", Provider: kernelFile, EtwID: 12, Sets: []string{"file"}, Params: fileCreateParams},
+	FileCreateNew:       {ID32Bit: FileCreateNew, Name: "file_create_new", Provider: kernelFile, EtwID: 30, Sets: []string{"file"}, Params: fileParams},
+	FileClose:           {ID32Bit: FileClose, Name: "file_close", Provider: kernelFile, EtwID: 14, Sets: []string{"file"}, Params: fileCloseParams},
+	FileRead:            {ID32Bit: FileRead, Name: "file_read", Provider: kernelFile, EtwID: 15, Sets: []string{"file"}, Params: fileIOParams},
+	FileWrite:           {ID32Bit: FileWrite, Name: "file_write", Provider: kernelFile, EtwID: 16, Sets: []string{"file"}, Params: fileIOParams},
+	FileDelete:          {ID32Bit: FileDelete, Name: "file_delete", Provider: kernelFile, EtwID: 26, Sets: []string{"file"}, Params: fileParams},
+	FileRename:          {ID32Bit: FileRename, Name: "file_rename", Provider: kernelFile, EtwID: 27, Sets: []string{"file"}, Params: fileParams},
+	TcpSend:             {ID32Bit: TcpSend, Name: "tcp_send", Provider: kernelNetwork, EtwID: 10, Sets: []string{"network"}, Params: tcpParams},
+	TcpRecv:             {ID32Bit: TcpRecv, Name: "tcp_recv", Provider: kernelNetwork, EtwID: 11, Sets: []string{"network"}, Params: tcpParams},
+	TcpConnect:          {ID32Bit: TcpConnect, Name: "tcp_connect", Provider: kernelNetwork, EtwID: 12, Sets: []string{"network"}, Params: tcpParams},
+	TcpDisconnect:       {ID32Bit: TcpDisconnect, Name: "tcp_disconnect", Provider: kernelNetwork, EtwID: 13, Sets: []string{"network"}, Params: tcpParams},
+	TcpAccept:           {ID32Bit: TcpAccept, Name: "tcp_accept", Provider: kernelNetwork, EtwID: 15, Sets: []string{"network"}, Params: tcpParams},
+	TcpSendIPv6:         {ID32Bit: TcpSendIPv6, Name: "tcp_send_ipv6", Provider: kernelNetwork, EtwID: 26, Sets: []string{"network"}, Params: tcpParams},
+	TcpRecvIPv6:         {ID32Bit: TcpRecvIPv6, Name: "tcp_recv_ipv6", Provider: kernelNetwork, EtwID: 27, Sets: []string{"network"}, Params: tcpParams},
+	TcpConnectIPv6:      {ID32Bit: TcpConnectIPv6, Name: "tcp_connect_ipv6", Provider: kernelNetwork, EtwID: 28, Sets: []string{"network"}, Params: tcpParams},
+	TcpDisconnectIPv6:   {ID32Bit: TcpDisconnectIPv6, Name: "tcp_disconnect_ipv6", Provider: kernelNetwork, EtwID: 29, Sets: []string{"network"}, Params: tcpParams},
+	TcpAcceptIPv6:       {ID32Bit: TcpAcceptIPv6, Name: "tcp_accept_ipv6", Provider: kernelNetwork, EtwID: 31, Sets: []string{"network"}, Params: tcpParams},
+	UdpSend:             {ID32Bit: UdpSend, Name: "udp_send", Provider: kernelNetwork, EtwID: 42, Sets: []string{"network"}, Params: udpParams},
+	UdpRecv:             {ID32Bit: UdpRecv, Name: "udp_recv", Provider: kernelNetwork, EtwID: 43, Sets: []string{"network"}, Params: udpParams},
+	UdpSendIPv6:         {ID32Bit: UdpSendIPv6, Name: "udp_send_ipv6", Provider: kernelNetwork, EtwID: 58, Sets: []string{"network"}, Params: udpParams},
+	UdpRecvIPv6:         {ID32Bit: UdpRecvIPv6, Name: "udp_recv_ipv6", Provider: kernelNetwork, EtwID: 59, Sets: []string{"network"}, Params: udpParams},
+	NetFlow:             {ID32Bit: NetFlow, Name: "net_flow", Sets: []string{"network"}, Params: netFlowParams},
+	DnsRequest:          {ID32Bit: DnsRequest, Name: "dns_request", Provider: dnsClient, EtwID: 3006, Sets: []string{"network", "dns"}, Params: dnsRequestParams},
+	DnsResponse:         {ID32Bit: DnsResponse, Name: "dns_response", Provider: dnsClient, EtwID: 3008, Sets: []string{"network", "dns"}, Params: dnsResponseParams},
+	RegistryCreateKey:   {ID32Bit: RegistryCreateKey, Name: "registry_create_key", Provider: kernelReg, EtwID: 1, Sets: []string{"registry"}, Params: registryCreateKeyParams},
+	RegistryDeleteKey:   {ID32Bit: RegistryDeleteKey, Name: "registry_delete_key", Provider: kernelReg, EtwID: 3, Sets: []string{"registry"}, Params: registryKeyParams},
+	RegistrySetValue:    {ID32Bit: RegistrySetValue, Name: "registry_set_value", Provider: kernelReg, EtwID: 5, Sets: []string{"registry"}, Params: registrySetValueParams},
+	RegistryDeleteValue: {ID32Bit: RegistryDeleteValue, Name: "registry_delete_value", Provider: kernelReg, EtwID: 6, Sets: []string{"registry"}, Params: registryValueParams},
+	PowershellScript:    {ID32Bit: PowershellScript, Name: "powershell_script", Provider: powerShell, EtwID: 4104, Sets: []string{"powershell"}, Params: powershellScriptParams},
+	PowershellModule:    {ID32Bit: PowershellModule, Name: "powershell_module", Provider: powerShell, EtwID: 4103, Sets: []string{"powershell"}, Params: powershellModuleParams},
+}
+
+type etwKey struct {
+	provider string
+	id       uint16
+}
+
+var byEtwID = func() map[etwKey]ID {
+	m := make(map[etwKey]ID, len(Definitions))
+	for id, def := range Definitions {
+		if def.Provider == "" {
+			continue
+		}
+		m[etwKey{def.Provider, def.EtwID}] = id
+	}
+	return m
+}()
+
+// Lookup returns the definition of the event decoded from an ETW event
+func Lookup(provider string, etwID uint16) (Event, bool) {
+	id, ok := byEtwID[etwKey{provider, etwID}]
+	if !ok {
+		return Event{}, false
+	}
+	return Definitions[id], true
+}
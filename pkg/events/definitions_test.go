@@ -0,0 +1,51 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package events
+
+import "testing"
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		provider string
+		etwID    uint16
+		want     string
+		wantOK   bool
+	}{
+		{provider: "Microsoft-Windows-Kernel-Process", etwID: 1, want: "process_start", wantOK: true},
+		{provider: "Microsoft-Windows-Kernel-File", etwID: 12, want: "file_create", wantOK: true},
+		{provider: "Microsoft-Windows-Kernel-Network", etwID: 12, want: "tcp_connect", wantOK: true},
+		{provider: "Microsoft-Windows-Kernel-File", etwID: 1},
+		{provider: "Microsoft-Windows-Kernel-Memory", etwID: 1},
+	}
+	for _, tt := range tests {
+		def, ok := Lookup(tt.provider, tt.etwID)
+		if ok != tt.wantOK || def.Name != tt.want {
+			t.Errorf("Lookup(%s, %d) = %q, %v, want %q, %v", tt.provider, tt.etwID, def.Name, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+// names and ETW events must identify a single definition
+func TestDefinitionsUnique(t *testing.T) {
+	names := make(map[string]ID)
+	etwEvents := 0
+	for id, def := range Definitions {
+		if def.ID32Bit != id {
+			t.Errorf("%s: ID32Bit = %d, want %d", def.Name, def.ID32Bit, id)
+		}
+		if other, ok := names[def.Name]; ok {
+			t.Errorf("%s: name used by events %d and %d", def.Name, other, id)
+		}
+		names[def.Name] = id
+		if def.Provider == "" {
+			continue
+		}
+		etwEvents++
+	}
+	if len(byEtwID) != etwEvents {
+		t.Errorf("%d ETW events decoded into %d definitions", len(byEtwID), etwEvents)
+	}
+}
@@ -21,4 +21,6 @@ type Event struct {
 	Syscall  bool
 	Sets     []string
 	Params   []trace.ArgMeta
+	Provider string // ETW provider of the event
+	EtwID    uint16 // ID of the event in the ETW provider manifest
 }
@@ -0,0 +1,258 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+// Package exclusions decides which processes eolh doesn't report, such as the container runtime or the antivirus,
+// whose events are plentiful and benign.
+package exclusions
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const (
+	// maxCached bounds the processes and the signers cached, they are forgotten all at once past it
+	maxCached = 1 << 16
+	// maxResolving bounds the signatures being verified at once
+	maxResolving = 4
+)
+
+// Rule excludes the events of the processes matching all of its criteria, at least one of them must be set
+type Rule struct {
+	// Name identifies the rule in the counters, it is derived from the criteria when empty
+	Name string `mapstructure:"name"`
+	// Image is the file name of the image of the process, e.g. MsMpEng.exe
+	Image string `mapstructure:"image"`
+	// Path is a pattern of the path of the image, matched case insensitively, where * matches any characters
+	// including separators, e.g. *\Windows Defender\*. Paths may be NT paths such as
+	// \Device\HarddiskVolume3\Program Files\..., patterns should rather not start with the drive.
+	Path string `mapstructure:"path"`
+	// PIDs are process IDs, e.g. 4 for the System process
+	PIDs []uint32 `mapstructure:"pids"`
+	// Container is the ID or the name of the container of the process
+	Container string `mapstructure:"container"`
+	// Signer is the subject of the certificate signing the image, e.g. Microsoft Corporation
+	Signer string `mapstructure:"signer"`
+}
+
+// Defaults are the rules used when none are configured: the idle and system processes, the container runtime,
+// kubelet and Defender. Rules by image match any number of processes, including none.
+var Defaults = []Rule{
+	{Name: "system", PIDs: []uint32{0, 4}},
+	{Name: "containerd", Image: "containerd.exe"},
+	{Name: "kubelet", Image: "kubelet.exe"},
+	{Name: "defender", Image: "MsMpEng.exe"},
+}
+
+// Process is what rules are matched against
+type Process struct {
+	PID uint32
+	// Image is the path of the image of the process
+	Image         string
+	ContainerID   string
+	ContainerName string
+}
+
+// Validate checks the rule has criteria
+func (r Rule) Validate() error {
+	if r.Image == "" && r.Path == "" && len(r.PIDs) == 0 && r.Container == "" && r.Signer == "" {
+		return errors.New("exclusion rule without any criteria")
+	}
+	return nil
+}
+
+func (r Rule) name() string {
+	switch {
+	case r.Name != "":
+		return r.Name
+	case r.Image != "":
+		return "image=" + r.Image
+	case r.Path != "":
+		return "path=" + r.Path
+	case len(r.PIDs) > 0:
+		return fmt.Sprintf("pids=%v", r.PIDs)
+	case r.Container != "":
+		return "container=" + r.Container
+	default:
+		return "signer=" + r.Signer
+	}
+}
+
+// compilePattern turns a path pattern into a case insensitive regular expression, * and ? matching separators
+func compilePattern(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("(?i)^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+func baseName(p string) string {
+	if i := strings.LastIndexAny(p, `\/`); i >= 0 {
+		return p[i+1:]
+	}
+	return p
+}
+
+// Set matches processes against rules, the results are cached by PID until the process is forgotten.
+// Signers are resolved in the background, as verifying a signature may take long, processes aren't matched by signer
+// until the signer of their image is resolved.
+// It is safe for concurrent use.
+type Set struct {
+	rules    []Rule
+	names    []string
+	patterns []*regexp.Regexp
+	signer   func(path string) (string, error)
+	mtx      sync.Mutex
+	// processes caches the name of the rule excluding a process, empty when none does
+	processes map[uint32]string
+	signers   map[string]string
+	// resolving are the images whose signer is being resolved
+	resolving map[string]struct{}
+	sem       chan struct{}
+}
+
+// New creates a set of rules, signer returns the subject of the verified signature of an image
+func New(rules []Rule, signer func(path string) (string, error)) (*Set, error) {
+	s := &Set{
+		rules:     rules,
+		names:     make([]string, 0, len(rules)),
+		patterns:  make([]*regexp.Regexp, 0, len(rules)),
+		signer:    signer,
+		processes: make(map[uint32]string),
+		signers:   make(map[string]string),
+		resolving: make(map[string]struct{}),
+		sem:       make(chan struct{}, maxResolving),
+	}
+	for _, r := range rules {
+		if err := r.Validate(); err != nil {
+			return nil, err
+		}
+		s.names = append(s.names, r.name())
+		var pattern *regexp.Regexp
+		if r.Path != "" {
+			pattern = compilePattern(r.Path)
+		}
+		s.patterns = append(s.patterns, pattern)
+	}
+	return s, nil
+}
+
+// Match returns the name of the first rule excluding the process of the PID, lookup is only called when the result
+// isn't cached
+func (s *Set) Match(pid uint32, lookup func() Process) (string, bool) {
+	s.mtx.Lock()
+	name, ok := s.processes[pid]
+	s.mtx.Unlock()
+	if ok {
+		return name, name != ""
+	}
+	p := lookup()
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	name, pending := s.match(p)
+	// the result may change once the signer is resolved
+	if !pending {
+		if len(s.processes) >= maxCached {
+			s.processes = make(map[uint32]string)
+		}
+		s.processes[pid] = name
+	}
+	return name, name != ""
+}
+
+// Forget drops the cached result of a PID, when the process started or stopped
+func (s *Set) Forget(pid uint32) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	delete(s.processes, pid)
+}
+
+// match returns the name of the first rule matching the process, pending is set when a rule couldn't be matched as
+// the signer of the image is being resolved
+func (s *Set) match(p Process) (name string, pending bool) {
+	for i, r := range s.rules {
+		matches, rulePending := s.matches(r, s.patterns[i], p)
+		if matches {
+			return s.names[i], pending
+		}
+		pending = pending || rulePending
+	}
+	return "", pending
+}
+
+func (s *Set) matches(r Rule, pattern *regexp.Regexp, p Process) (bool, bool) {
+	if len(r.PIDs) > 0 && !containsPID(r.PIDs, p.PID) {
+		return false, false
+	}
+	if r.Image != "" && !strings.EqualFold(r.Image, baseName(p.Image)) {
+		return false, false
+	}
+	if pattern != nil && !pattern.MatchString(p.Image) {
+		return false, false
+	}
+	if r.Container != "" && (p.ContainerID == "" || r.Container != p.ContainerID && r.Container != p.ContainerName) {
+		return false, false
+	}
+	if r.Signer != "" {
+		subject, ok := s.signerOf(p.Image)
+		if !ok {
+			return false, true
+		}
+		return strings.EqualFold(r.Signer, subject), false
+	}
+	return true, false
+}
+
+// signerOf returns the signer of an image, empty when it isn't signed. It is not ok while the signer is being resolved,
+// which it starts when the signer isn't cached. s.mtx must be held.
+func (s *Set) signerOf(image string) (string, bool) {
+	if image == "" || s.signer == nil {
+		return "", true
+	}
+	if subject, ok := s.signers[image]; ok {
+		return subject, true
+	}
+	if _, ok := s.resolving[image]; !ok {
+		s.resolving[image] = struct{}{}
+		go s.resolve(image)
+	}
+	return "", false
+}
+
+// resolve verifies the signature of an image and caches its signer
+func (s *Set) resolve(image string) {
+	s.sem <- struct{}{}
+	subject, _ := s.signer(image)
+	<-s.sem
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	delete(s.resolving, image)
+	if len(s.signers) >= maxCached {
+		s.signers = make(map[string]string)
+	}
+	s.signers[image] = subject
+}
+
+func containsPID(pids []uint32, pid uint32) bool {
+	for _, p := range pids {
+		if p == pid {
+			return true
+		}
+	}
+	return false
+}
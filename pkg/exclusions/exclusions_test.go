@@ -0,0 +1,150 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package exclusions
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSetMatch(t *testing.T) {
+	rules := append([]Rule{
+		{Path: `*\Windows Defender\*`},
+		{Name: "sidecar", Container: "istio-proxy"},
+		{Name: "vendor", Image: "agent.exe", Container: "0123abcd"},
+	}, Defaults...)
+	tests := []struct {
+		name    string
+		process Process
+		want    string
+	}{
+		{name: "system pid", process: Process{PID: 4}, want: "system"},
+		{name: "idle pid", process: Process{PID: 0}, want: "system"},
+		{name: "image case insensitive", process: Process{PID: 100, Image: `C:\Program Files\containerd\CONTAINERD.EXE`}, want: "containerd"},
+		{name: "image by base name only", process: Process{PID: 100, Image: `C:\kubelet.exe\other.exe`}, want: ""},
+		{
+			name:    "path across separators",
+			process: Process{PID: 100, Image: `\Device\HarddiskVolume3\ProgramData\Microsoft\Windows Defender\Platform\MpCmdRun.exe`},
+			want:    `path=*\Windows Defender\*`,
+		},
+		{name: "container by name", process: Process{PID: 100, ContainerID: "ffff", ContainerName: "istio-proxy"}, want: "sidecar"},
+		{name: "container by ID", process: Process{PID: 100, Image: `C:\agent.exe`, ContainerID: "0123abcd"}, want: "vendor"},
+		{name: "all criteria must match", process: Process{PID: 100, Image: `C:\agent.exe`, ContainerID: "ffff"}, want: ""},
+		{name: "host process", process: Process{PID: 100, Image: `C:\Windows\System32\cmd.exe`}, want: ""},
+	}
+	s, err := New(rules, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.Forget(tt.process.PID)
+			name, ok := s.Match(tt.process.PID, func() Process { return tt.process })
+			if name != tt.want || ok != (tt.want != "") {
+				t.Errorf("Match() = %q, %t, want %q", name, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetCaches(t *testing.T) {
+	s, err := New([]Rule{{Image: "a.exe"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lookups := 0
+	lookup := func(image string) func() Process {
+		return func() Process {
+			lookups++
+			return Process{PID: 100, Image: image}
+		}
+	}
+	s.Match(100, lookup("a.exe"))
+	if _, ok := s.Match(100, lookup("b.exe")); !ok || lookups != 1 {
+		t.Errorf("the result wasn't cached, %d lookups", lookups)
+	}
+	// the PID was reused
+	s.Forget(100)
+	if _, ok := s.Match(100, lookup("b.exe")); ok || lookups != 2 {
+		t.Errorf("the result wasn't forgotten, %d lookups", lookups)
+	}
+}
+
+func TestSetSigner(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	s, err := New([]Rule{{Name: "microsoft", Signer: "Microsoft Corporation"}}, func(path string) (string, error) {
+		calls.Add(1)
+		<-release
+		if path == `C:\Windows\notepad.exe` {
+			return "MICROSOFT CORPORATION", nil
+		}
+		return "", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	notepad := func() Process { return Process{PID: 100, Image: `C:\Windows\notepad.exe`} }
+	// the signer is resolved in the background, without blocking the events
+	if _, ok := s.Match(100, notepad); ok {
+		t.Error("matched before the signer was resolved")
+	}
+	if _, ok := s.Match(100, notepad); ok {
+		t.Error("matched before the signer was resolved")
+	}
+	close(release)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if name, ok := s.Match(100, notepad); ok {
+			if name != "microsoft" {
+				t.Errorf("Match() = %q, want microsoft", name)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the signer was never resolved")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("the signature was verified %d times, want 1", n)
+	}
+
+	s.Match(200, func() Process { return Process{PID: 200, Image: `C:\unsigned.exe`} })
+	deadline = time.Now().Add(5 * time.Second)
+	for calls.Load() < 2 || !s.resolved(`C:\unsigned.exe`) {
+		if time.Now().After(deadline) {
+			t.Fatal("the signer was never resolved")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if _, ok := s.Match(200, func() Process { return Process{PID: 200, Image: `C:\unsigned.exe`} }); ok {
+		t.Error("matched an unsigned image")
+	}
+}
+
+// resolved tells whether the signer of an image is cached
+func (s *Set) resolved(image string) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	_, ok := s.signers[image]
+	return ok
+}
+
+func TestRuleValidate(t *testing.T) {
+	if err := (Rule{Name: "empty"}).Validate(); err == nil {
+		t.Error("a rule without criteria is valid")
+	}
+	if _, err := New([]Rule{{Name: "empty"}}, nil); err == nil {
+		t.Error("New accepted a rule without criteria")
+	}
+	for _, r := range Defaults {
+		if err := r.Validate(); err != nil {
+			t.Errorf("default rule %s: %v", r.Name, err)
+		}
+	}
+}
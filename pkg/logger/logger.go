@@ -64,15 +64,34 @@ type Logger struct {
 	logCount *logCounter // updated only on debug level and cfg.Aggregate == true
 }
 
+// level is shared by the loggers created by NewLogger, so that SetLevel changes it at runtime
+var level = zap.NewAtomicLevelAt(DefaultLevel)
+
 // NewLogger function
 func NewLogger(cfg LoggerConfig) LoggerInterface {
+	level.SetLevel(cfg.Level)
 	return zap.New(zapcore.NewCore(
 		cfg.Encoder,
 		zapcore.AddSync(cfg.Writer),
-		zapcore.Level(cfg.Level),
+		level,
 	)).Sugar()
 }
 
+// SetLevel changes the level of the loggers created by NewLogger
+func SetLevel(l Level) {
+	level.SetLevel(l)
+}
+
+// GetLevel returns the level of the loggers created by NewLogger
+func GetLevel() Level {
+	return level.Level()
+}
+
+// ParseLevel parses a level name, e.g. debug or info
+func ParseLevel(text string) (Level, error) {
+	return zapcore.ParseLevel(text)
+}
+
 const (
 	DefaultLevel         = InfoLevel
 	DefaultFlushInterval = time.Duration(3) * time.Second
@@ -0,0 +1,43 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package metrics
+
+import (
+	"sync"
+)
+
+// Channel is the occupancy of a channel of the pipeline
+type Channel struct {
+	Name string `json:"name"`
+	Len  int    `json:"len"`
+	Cap  int    `json:"cap"`
+}
+
+// Channels tracks the channels of the pipeline to report their occupancy, safe for concurrent use
+type Channels struct {
+	mutex    sync.Mutex
+	channels []func() Channel
+}
+
+// TrackChannel adds a channel to the tracked ones, in the order of the pipeline stages
+func TrackChannel[T any](c *Channels, name string, ch chan T) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.channels = append(c.channels, func() Channel {
+		return Channel{Name: name, Len: len(ch), Cap: cap(ch)}
+	})
+}
+
+// Snapshot returns the current occupancy of the tracked channels
+func (c *Channels) Snapshot() []Channel {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	res := make([]Channel, 0, len(c.channels))
+	for _, f := range c.channels {
+		res = append(res, f())
+	}
+	return res
+}
@@ -0,0 +1,85 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "eolh"
+
+var (
+	providerEventsDesc    = prometheus.NewDesc(namespace+"_etw_events_received_total", "ETW events received, by provider", []string{"provider"}, nil)
+	eventsDecodedDesc     = prometheus.NewDesc(namespace+"_events_decoded_total", "Events decoded from ETW", nil, nil)
+	eventsFilteredDesc    = prometheus.NewDesc(namespace+"_events_filtered_total", "ETW events filtered out", nil, nil)
+	eventsExcludedDesc    = prometheus.NewDesc(namespace+"_events_excluded_total", "ETW events of excluded processes, by exclusion rule", []string{"rule"}, nil)
+	eventsDroppedDesc     = prometheus.NewDesc(namespace+"_events_dropped_total", "Events and findings dropped, by reason", []string{"reason"}, nil)
+	eventErrorsDesc       = prometheus.NewDesc(namespace+"_event_errors_total", "Events failing to be processed", nil, nil)
+	findingsDesc          = prometheus.NewDesc(namespace+"_findings_total", "Findings reported, by signature", []string{"signature"}, nil)
+	printerErrorsDesc     = prometheus.NewDesc(namespace+"_printer_errors_total", "Events which printers failed to print", nil, nil)
+	etwEventsLostDesc     = prometheus.NewDesc(namespace+"_etw_events_lost_total", "Events lost by ETW", nil, nil)
+	etwBuffersLostDesc    = prometheus.NewDesc(namespace+"_etw_buffers_lost_total", "Buffers lost by ETW", nil, nil)
+	sessionRestartsDesc   = prometheus.NewDesc(namespace+"_etw_session_restarts_total", "Re-creations of the ETW session", nil, nil)
+	containerCacheDesc    = prometheus.NewDesc(namespace+"_container_cache_size", "Containers known to eolh", nil, nil)
+	streamSubscribersDesc = prometheus.NewDesc(namespace+"_stream_subscribers", "Subscribers of the gRPC event streams", nil, nil)
+)
+
+// Collector exposes the stats to Prometheus, reading them on every scrape
+type Collector struct {
+	stats *Stats
+	// ContainerCount and Subscribers report gauges, they are left out when nil
+	ContainerCount func() int
+	Subscribers    func() int
+}
+
+func NewCollector(stats *Stats) *Collector {
+	return &Collector{stats: stats}
+}
+
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- providerEventsDesc
+	ch <- eventsDecodedDesc
+	ch <- eventsFilteredDesc
+	ch <- eventsExcludedDesc
+	ch <- eventsDroppedDesc
+	ch <- eventErrorsDesc
+	ch <- findingsDesc
+	ch <- printerErrorsDesc
+	ch <- etwEventsLostDesc
+	ch <- etwBuffersLostDesc
+	ch <- sessionRestartsDesc
+	ch <- containerCacheDesc
+	ch <- streamSubscribersDesc
+}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	s := c.stats.Snapshot()
+	for provider, n := range s.ProviderEvents {
+		ch <- prometheus.MustNewConstMetric(providerEventsDesc, prometheus.CounterValue, float64(n), provider)
+	}
+	ch <- prometheus.MustNewConstMetric(eventsDecodedDesc, prometheus.CounterValue, float64(s.EventCount))
+	ch <- prometheus.MustNewConstMetric(eventsFilteredDesc, prometheus.CounterValue, float64(s.FilteredCount))
+	for rule, n := range s.ExcludedEvents {
+		ch <- prometheus.MustNewConstMetric(eventsExcludedDesc, prometheus.CounterValue, float64(n), rule)
+	}
+	ch <- prometheus.MustNewConstMetric(eventsDroppedDesc, prometheus.CounterValue, float64(s.DroppedCount), "shutdown")
+	ch <- prometheus.MustNewConstMetric(eventsDroppedDesc, prometheus.CounterValue, float64(s.StreamDroppedCount), "stream")
+	ch <- prometheus.MustNewConstMetric(eventsDroppedDesc, prometheus.CounterValue, float64(s.PluginDroppedCount), "plugin")
+	ch <- prometheus.MustNewConstMetric(eventErrorsDesc, prometheus.CounterValue, float64(s.ErrorCount))
+	for signature, n := range s.SignatureFindings {
+		ch <- prometheus.MustNewConstMetric(findingsDesc, prometheus.CounterValue, float64(n), signature)
+	}
+	ch <- prometheus.MustNewConstMetric(printerErrorsDesc, prometheus.CounterValue, float64(s.PrinterErrorCount))
+	ch <- prometheus.MustNewConstMetric(etwEventsLostDesc, prometheus.CounterValue, float64(s.ETWEventsLost))
+	ch <- prometheus.MustNewConstMetric(etwBuffersLostDesc, prometheus.CounterValue, float64(s.ETWBuffersLost))
+	ch <- prometheus.MustNewConstMetric(sessionRestartsDesc, prometheus.CounterValue, float64(s.SessionRestarts))
+	if c.ContainerCount != nil {
+		ch <- prometheus.MustNewConstMetric(containerCacheDesc, prometheus.GaugeValue, float64(c.ContainerCount()))
+	}
+	if c.Subscribers != nil {
+		ch <- prometheus.MustNewConstMetric(streamSubscribersDesc, prometheus.GaugeValue, float64(c.Subscribers()))
+	}
+}
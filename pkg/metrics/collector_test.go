@@ -0,0 +1,95 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollector(t *testing.T) {
+	stats := &Stats{}
+	stats.ProviderEvents.Add("Microsoft-Windows-Kernel-Process", 3)
+	stats.ProviderEvents.Add("Microsoft-Windows-Kernel-File", 2)
+	stats.EventCount.Add(5)
+	stats.FilteredCount.Add(4)
+	stats.ExcludedEvents.Add("defender", 1)
+	stats.DroppedCount.Add(1)
+	stats.StreamDroppedCount.Add(2)
+	stats.SignatureFindings.Add("EOLH-1", 2)
+	stats.ErrorCount.Add(1)
+	stats.PrinterErrorCount.Add(3)
+	stats.ETWEventsLost.Add(6)
+	stats.ETWBuffersLost.Add(1)
+	stats.SessionRestarts.Add(2)
+	collector := NewCollector(stats)
+	collector.ContainerCount = func() int { return 4 }
+
+	// the subscribers gauge is left out without a stream manager
+	want := `
+# HELP eolh_container_cache_size Containers known to eolh
+# TYPE eolh_container_cache_size gauge
+eolh_container_cache_size 4
+# HELP eolh_etw_buffers_lost_total Buffers lost by ETW
+# TYPE eolh_etw_buffers_lost_total counter
+eolh_etw_buffers_lost_total 1
+# HELP eolh_etw_events_lost_total Events lost by ETW
+# TYPE eolh_etw_events_lost_total counter
+eolh_etw_events_lost_total 6
+# HELP eolh_etw_events_received_total ETW events received, by provider
+# TYPE eolh_etw_events_received_total counter
+eolh_etw_events_received_total{provider="Microsoft-Windows-Kernel-File"} 2
+eolh_etw_events_received_total{provider="Microsoft-Windows-Kernel-Process"} 3
+# HELP eolh_etw_session_restarts_total Re-creations of the ETW session
+# TYPE eolh_etw_session_restarts_total counter
+eolh_etw_session_restarts_total 2
+# HELP eolh_event_errors_total Events failing to be processed
+# TYPE eolh_event_errors_total counter
+eolh_event_errors_total 1
+# HELP eolh_events_decoded_total Events decoded from ETW
+# TYPE eolh_events_decoded_total counter
+eolh_events_decoded_total 5
+# HELP eolh_events_dropped_total Events and findings dropped, by reason
+# TYPE eolh_events_dropped_total counter
+eolh_events_dropped_total{reason="plugin"} 0
+eolh_events_dropped_total{reason="shutdown"} 1
+eolh_events_dropped_total{reason="stream"} 2
+# HELP eolh_events_excluded_total ETW events of excluded processes, by exclusion rule
+# TYPE eolh_events_excluded_total counter
+eolh_events_excluded_total{rule="defender"} 1
+# HELP eolh_events_filtered_total ETW events filtered out
+# TYPE eolh_events_filtered_total counter
+eolh_events_filtered_total 4
+# HELP eolh_findings_total Findings reported, by signature
+# TYPE eolh_findings_total counter
+eolh_findings_total{signature="EOLH-1"} 2
+# HELP eolh_printer_errors_total Events which printers failed to print
+# TYPE eolh_printer_errors_total counter
+eolh_printer_errors_total 3
+`
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+
+	// the counters are read on every scrape
+	stats.SignatureFindings.Add("EOLH-1", 1)
+	stats.SignatureFindings.Add("EOLH-2", 1)
+	collector.Subscribers = func() int { return 2 }
+	want = `
+# HELP eolh_findings_total Findings reported, by signature
+# TYPE eolh_findings_total counter
+eolh_findings_total{signature="EOLH-1"} 3
+eolh_findings_total{signature="EOLH-2"} 1
+# HELP eolh_stream_subscribers Subscribers of the gRPC event streams
+# TYPE eolh_stream_subscribers gauge
+eolh_stream_subscribers 2
+`
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(want), "eolh_findings_total", "eolh_stream_subscribers"); err != nil {
+		t.Error(err)
+	}
+}
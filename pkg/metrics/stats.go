@@ -0,0 +1,104 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+// Package metrics counts what goes through the eolh pipeline.
+package metrics
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// CounterMap counts by key, e.g. by provider, safe for concurrent use
+type CounterMap struct {
+	counters sync.Map
+}
+
+func (m *CounterMap) Add(key string, n uint64) {
+	c, ok := m.counters.Load(key)
+	if !ok {
+		c, _ = m.counters.LoadOrStore(key, new(atomic.Uint64))
+	}
+	c.(*atomic.Uint64).Add(n)
+}
+
+// Snapshot returns a copy of the counters
+func (m *CounterMap) Snapshot() map[string]uint64 {
+	res := make(map[string]uint64)
+	m.counters.Range(func(key, value any) bool {
+		res[key.(string)] = value.(*atomic.Uint64).Load()
+		return true
+	})
+	return res
+}
+
+// Stats are the counters of a running eolh, safe for concurrent use
+type Stats struct {
+	// ProviderEvents counts the ETW events received, by provider
+	ProviderEvents CounterMap
+	// EventCount counts the events decoded from ETW
+	EventCount atomic.Uint64
+	// FilteredCount counts the ETW events filtered out, e.g. the events of eolh or of the container runtime
+	FilteredCount atomic.Uint64
+	// ExcludedEvents counts the events of the excluded processes, by exclusion rule, they are part of FilteredCount
+	ExcludedEvents CounterMap
+	// FindingCount counts the findings reported by signatures
+	FindingCount atomic.Uint64
+	// SignatureFindings counts the findings, by signature ID
+	SignatureFindings CounterMap
+	// ErrorCount counts the events failing to be processed
+	ErrorCount atomic.Uint64
+	// DroppedCount counts the findings dropped on shutdown, as the pipeline was closed
+	DroppedCount atomic.Uint64
+	// StreamDroppedCount counts the events dropped because a stream subscriber was too slow
+	StreamDroppedCount atomic.Uint64
+	// PluginDroppedCount counts the events dropped because a plugin signature was too slow
+	PluginDroppedCount atomic.Uint64
+	// PrinterErrorCount counts the events which printers failed to print
+	PrinterErrorCount atomic.Uint64
+	// ETWEventsLost counts the events ETW lost, e.g. as the buffers of the session were full
+	ETWEventsLost atomic.Uint64
+	// ETWBuffersLost counts the buffers ETW failed to write or to deliver to eolh
+	ETWBuffersLost atomic.Uint64
+	// SessionRestarts counts the times the ETW session was re-created
+	SessionRestarts atomic.Uint64
+}
+
+// Snapshot is a copy of the counters
+type Snapshot struct {
+	ProviderEvents     map[string]uint64 `json:"providerEvents"`
+	EventCount         uint64            `json:"eventCount"`
+	FilteredCount      uint64            `json:"filteredCount"`
+	ExcludedEvents     map[string]uint64 `json:"excludedEvents"`
+	FindingCount       uint64            `json:"findingCount"`
+	SignatureFindings  map[string]uint64 `json:"signatureFindings"`
+	ErrorCount         uint64            `json:"errorCount"`
+	DroppedCount       uint64            `json:"droppedCount"`
+	StreamDroppedCount uint64            `json:"streamDroppedCount"`
+	PluginDroppedCount uint64            `json:"pluginDroppedCount"`
+	PrinterErrorCount  uint64            `json:"printerErrorCount"`
+	ETWEventsLost      uint64            `json:"etwEventsLost"`
+	ETWBuffersLost     uint64            `json:"etwBuffersLost"`
+	SessionRestarts    uint64            `json:"sessionRestarts"`
+}
+
+func (s *Stats) Snapshot() Snapshot {
+	return Snapshot{
+		ProviderEvents:     s.ProviderEvents.Snapshot(),
+		EventCount:         s.EventCount.Load(),
+		FilteredCount:      s.FilteredCount.Load(),
+		ExcludedEvents:     s.ExcludedEvents.Snapshot(),
+		FindingCount:       s.FindingCount.Load(),
+		SignatureFindings:  s.SignatureFindings.Snapshot(),
+		ErrorCount:         s.ErrorCount.Load(),
+		DroppedCount:       s.DroppedCount.Load(),
+		StreamDroppedCount: s.StreamDroppedCount.Load(),
+		PluginDroppedCount: s.PluginDroppedCount.Load(),
+		PrinterErrorCount:  s.PrinterErrorCount.Load(),
+		ETWEventsLost:      s.ETWEventsLost.Load(),
+		ETWBuffersLost:     s.ETWBuffersLost.Load(),
+		SessionRestarts:    s.SessionRestarts.Load(),
+	}
+}
@@ -0,0 +1,137 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+// Package netflow aggregates the packets reported by Kernel-Network into flows, so that a connection is reported once
+// per window instead of once per packet.
+package netflow
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	TCP = "tcp"
+	UDP = "udp"
+)
+
+const (
+	// Outbound flows were initiated by the process, by connecting or by sending the first packet
+	Outbound = "outbound"
+	// Inbound flows were initiated by the peer, by being accepted or by receiving the first packet
+	Inbound = "inbound"
+)
+
+// Kind is what a Kernel-Network event tells about a flow
+type Kind int
+
+const (
+	Send Kind = iota
+	Recv
+	Connect
+	Accept
+	Disconnect
+)
+
+// Key identifies a flow of a process, the source is the local end and the destination the remote one
+type Key struct {
+	ContainerID string
+	ProcessID   int
+	Protocol    string
+	SrcAddr     string
+	SrcPort     uint16
+	DstAddr     string
+	DstPort     uint16
+}
+
+// Packet is a Kernel-Network event
+type Packet struct {
+	Key  Key
+	Kind Kind
+	Size uint64
+	Time time.Time
+}
+
+type Flow struct {
+	Key
+	Direction     string
+	BytesSent     uint64
+	BytesReceived uint64
+	// Packets counts the send and receive events
+	Packets uint64
+	Start   time.Time
+	End     time.Time
+	// Closed tells whether the connection was disconnected during the window
+	Closed bool
+}
+
+// Aggregator sums the packets of every flow until they are flushed, safe for concurrent use
+type Aggregator struct {
+	mtx   sync.Mutex
+	flows map[Key]*Flow
+}
+
+func NewAggregator() *Aggregator {
+	return &Aggregator{flows: make(map[Key]*Flow)}
+}
+
+// Add accounts a packet to its flow
+func (a *Aggregator) Add(p Packet) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	f, ok := a.flows[p.Key]
+	if !ok {
+		f = &Flow{Key: p.Key, Start: p.Time}
+		a.flows[p.Key] = f
+	}
+	if f.Direction == "" || p.Kind == Connect || p.Kind == Accept {
+		switch p.Kind {
+		case Send, Connect:
+			f.Direction = Outbound
+		case Recv, Accept:
+			f.Direction = Inbound
+		}
+	}
+	switch p.Kind {
+	case Send:
+		f.BytesSent += p.Size
+		f.Packets++
+	case Recv:
+		f.BytesReceived += p.Size
+		f.Packets++
+	case Disconnect:
+		f.Closed = true
+	}
+	if p.Time.Before(f.Start) {
+		f.Start = p.Time
+	}
+	if p.Time.After(f.End) {
+		f.End = p.Time
+	}
+}
+
+// Flush returns the flows aggregated since the previous flush, ordered by start time, and forgets them
+func (a *Aggregator) Flush() []Flow {
+	a.mtx.Lock()
+	flows := a.flows
+	a.flows = make(map[Key]*Flow)
+	a.mtx.Unlock()
+	res := make([]Flow, 0, len(flows))
+	for _, f := range flows {
+		res = append(res, *f)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Start.Before(res[j].Start)
+	})
+	return res
+}
+
+// Len returns the number of flows being aggregated
+func (a *Aggregator) Len() int {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	return len(a.flows)
+}
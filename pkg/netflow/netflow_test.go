@@ -0,0 +1,88 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package netflow
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAggregator(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(s int) time.Time { return start.Add(time.Duration(s) * time.Second) }
+	web := Key{ProcessID: 100, Protocol: TCP, SrcAddr: "10.0.0.2", SrcPort: 50000, DstAddr: "93.184.216.34", DstPort: 443}
+	dns := Key{ProcessID: 200, Protocol: UDP, SrcAddr: "10.0.0.2", SrcPort: 50001, DstAddr: "10.0.0.1", DstPort: 53}
+
+	tests := []struct {
+		name    string
+		packets []Packet
+		want    []Flow
+	}{
+		{
+			name: "outbound connection",
+			packets: []Packet{
+				{Key: web, Kind: Connect, Time: at(0)},
+				{Key: web, Kind: Send, Size: 100, Time: at(1)},
+				{Key: web, Kind: Recv, Size: 1000, Time: at(2)},
+				{Key: web, Kind: Recv, Size: 500, Time: at(3)},
+				{Key: web, Kind: Disconnect, Time: at(4)},
+			},
+			want: []Flow{
+				{Key: web, Direction: Outbound, BytesSent: 100, BytesReceived: 1500, Packets: 3, Start: at(0), End: at(4), Closed: true},
+			},
+		},
+		{
+			name: "accepted connection which sent first",
+			packets: []Packet{
+				{Key: web, Kind: Send, Size: 10, Time: at(1)},
+				{Key: web, Kind: Accept, Time: at(0)},
+			},
+			want: []Flow{
+				{Key: web, Direction: Inbound, BytesSent: 10, Packets: 1, Start: at(0), End: at(1)},
+			},
+		},
+		{
+			name: "received first",
+			packets: []Packet{
+				{Key: dns, Kind: Recv, Size: 60, Time: at(0)},
+				{Key: dns, Kind: Send, Size: 40, Time: at(1)},
+			},
+			want: []Flow{
+				{Key: dns, Direction: Inbound, BytesSent: 40, BytesReceived: 60, Packets: 2, Start: at(0), End: at(1)},
+			},
+		},
+		{
+			name: "flows by start time",
+			packets: []Packet{
+				{Key: web, Kind: Send, Size: 1, Time: at(5)},
+				{Key: dns, Kind: Send, Size: 2, Time: at(3)},
+			},
+			want: []Flow{
+				{Key: dns, Direction: Outbound, BytesSent: 2, Packets: 1, Start: at(3), End: at(3)},
+				{Key: web, Direction: Outbound, BytesSent: 1, Packets: 1, Start: at(5), End: at(5)},
+			},
+		},
+		{name: "no packet", want: []Flow{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := NewAggregator()
+			for _, p := range tt.packets {
+				a.Add(p)
+			}
+			if n := a.Len(); n != len(tt.want) {
+				t.Errorf("Len() = %d, want %d", n, len(tt.want))
+			}
+			if got := a.Flush(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Flush() = %+v, want %+v", got, tt.want)
+			}
+			if n := a.Len(); n != 0 {
+				t.Errorf("Len() = %d after Flush, want 0", n)
+			}
+		})
+	}
+}
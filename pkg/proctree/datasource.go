@@ -0,0 +1,109 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package proctree
+
+import (
+	"encoding/json"
+	"eolh/pkg/detect"
+	"strconv"
+)
+
+// DataSource exposes the tree to signatures as eolh/process_tree, keyed by PID
+type DataSource struct {
+	tree *Tree
+}
+
+func NewDataSource(tree *Tree) *DataSource {
+	return &DataSource{tree: tree}
+}
+
+func toPID(key interface{}) (uint32, bool) {
+	switch k := key.(type) {
+	case int:
+		return uint32(k), k >= 0
+	case int32:
+		return uint32(k), k >= 0
+	case int64:
+		return uint32(k), k >= 0
+	case uint32:
+		return k, true
+	case float64:
+		return uint32(k), k >= 0
+	case json.Number:
+		pid, err := strconv.ParseUint(string(k), 10, 32)
+		return uint32(pid), err == nil
+	case string:
+		pid, err := strconv.ParseUint(k, 10, 32)
+		return uint32(pid), err == nil
+	}
+	return 0, false
+}
+
+func processData(p Process) map[string]interface{} {
+	return map[string]interface{}{
+		"pid":          p.PID,
+		"ppid":         p.PPID,
+		"name":         p.Name,
+		"image_name":   p.ImageName,
+		"cmdline":      p.Cmdline,
+		"start_time":   p.StartTime.UnixNano(),
+		"exited":       p.Exited(),
+		"session_id":   p.SessionID,
+		"container_id": p.ContainerID,
+	}
+}
+
+func (ds *DataSource) Get(key interface{}) (map[string]interface{}, error) {
+	pid, ok := toPID(key)
+	if !ok {
+		return nil, detect.ErrKeyNotSupported
+	}
+	p, ok := ds.tree.Get(pid)
+	if !ok {
+		return nil, detect.ErrDataNotFound
+	}
+	result := processData(p)
+	ancestors := ds.tree.Ancestors(pid)
+	ancestorsData := make([]interface{}, 0, len(ancestors))
+	for _, ancestor := range ancestors {
+		ancestorsData = append(ancestorsData, processData(ancestor))
+	}
+	result["ancestors"] = ancestorsData
+	return result, nil
+}
+
+func (ds *DataSource) Schema() string {
+	schemaMap := map[string]string{
+		"pid":          "uint32",
+		"ppid":         "uint32",
+		"name":         "string",
+		"image_name":   "string",
+		"cmdline":      "string",
+		"start_time":   "int64",
+		"exited":       "bool",
+		"session_id":   "uint32",
+		"container_id": "string",
+		"ancestors":    "[]object, the parent first",
+	}
+	schema, _ := json.Marshal(schemaMap)
+	return string(schema)
+}
+
+func (ds *DataSource) Keys() []string {
+	return []string{"int"}
+}
+
+func (ds *DataSource) Version() uint {
+	return 1
+}
+
+func (ds *DataSource) Namespace() string {
+	return "eolh"
+}
+
+func (ds *DataSource) ID() string {
+	return "process_tree"
+}
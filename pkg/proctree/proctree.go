@@ -0,0 +1,273 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+// Package proctree maintains the processes of the host from the process start and stop events, so that events can be
+// enriched and signatures can follow the ancestry of a process without querying the system for every event.
+package proctree
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+const (
+	// exitedRetention is how long exited processes are kept, for their late events and the ancestry of their children
+	exitedRetention = 5 * time.Minute
+	// resolvedRetention is how long the processes resolved on a cache miss are kept, in case their stop was missed
+	resolvedRetention = 10 * time.Minute
+	// missRetry is how long a process the resolver failed to find is not looked up again
+	missRetry = 10 * time.Second
+	// maxAncestors bounds the ancestry of a process, in case of a loop in the parents
+	maxAncestors = 64
+)
+
+type Process struct {
+	PID  uint32 `json:"pid"`
+	PPID uint32 `json:"ppid"`
+	// Name is the file name of the image, e.g. cmd.exe
+	Name string `json:"name"`
+	// ImageName is the path of the image
+	ImageName   string    `json:"imageName"`
+	Cmdline     string    `json:"cmdline"`
+	StartTime   time.Time `json:"startTime"`
+	ExitTime    time.Time `json:"exitTime"`
+	SessionID   uint32    `json:"sessionId"`
+	ContainerID string    `json:"containerId,omitempty"`
+}
+
+// Exited tells whether the process stopped
+func (p *Process) Exited() bool {
+	return !p.ExitTime.IsZero()
+}
+
+// Resolver looks up a process unknown to the tree
+type Resolver func(pid uint32) (*Process, error)
+
+// Tree is the process tree of the host, safe for concurrent use
+type Tree struct {
+	mtx       sync.RWMutex
+	processes map[uint32]*Process
+	exited    []*Process
+	// resolved are the processes resolved on a cache miss, by time of resolution
+	resolved []resolvedProcess
+	misses   map[uint32]time.Time
+	resolve  Resolver
+}
+
+type resolvedProcess struct {
+	process *Process
+	time    time.Time
+}
+
+// New creates a tree falling back to the resolver for the processes it doesn't know, e.g. the ones started before eolh
+func New(resolve Resolver) *Tree {
+	return &Tree{
+		processes: make(map[uint32]*Process),
+		misses:    make(map[uint32]time.Time),
+		resolve:   resolve,
+	}
+}
+
+// Start adds a started process, replacing any process which had the same PID
+func (t *Tree) Start(p Process) {
+	if p.Name == "" {
+		p.Name = BaseName(p.ImageName)
+	}
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.processes[p.PID] = &p
+	delete(t.misses, p.PID)
+	t.prune(p.StartTime)
+}
+
+// Exit marks a process as stopped, it is kept for a while for its late events and its children
+func (t *Tree) Exit(pid uint32, exitTime time.Time) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	p, ok := t.processes[pid]
+	if !ok || p.Exited() {
+		return
+	}
+	// copy on write, Get and Ancestors hand out copies but the pointer is shared with the exited list
+	exited := *p
+	exited.ExitTime = exitTime
+	t.processes[pid] = &exited
+	t.exited = append(t.exited, &exited)
+}
+
+// Update modifies the process which started at startTime, e.g. with what is read from the system after its start. It
+// does nothing when the process was forgotten or its PID reused.
+func (t *Tree) Update(pid uint32, startTime time.Time, update func(p *Process)) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	p, ok := t.processes[pid]
+	if !ok || !p.StartTime.Equal(startTime) {
+		return
+	}
+	// copy on write, like Exit
+	updated := *p
+	update(&updated)
+	t.processes[pid] = &updated
+	if !p.Exited() {
+		return
+	}
+	for i := len(t.exited) - 1; i >= 0; i-- {
+		if t.exited[i] == p {
+			t.exited[i] = &updated
+			break
+		}
+	}
+}
+
+// Prune forgets the processes which exited or were resolved before their retention period. Processes are pruned as
+// others start, Prune is meant to be called periodically for the hosts where none do.
+func (t *Tree) Prune(now time.Time) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.prune(now)
+}
+
+// prune forgets the processes which exited or were resolved before their retention period, unless their PID was reused
+func (t *Tree) prune(now time.Time) {
+	i := 0
+	for ; i < len(t.exited); i++ {
+		p := t.exited[i]
+		if now.Sub(p.ExitTime) < exitedRetention {
+			break
+		}
+		if t.processes[p.PID] == p {
+			delete(t.processes, p.PID)
+		}
+	}
+	t.exited = t.exited[i:]
+	i = 0
+	for ; i < len(t.resolved); i++ {
+		r := t.resolved[i]
+		if now.Sub(r.time) < resolvedRetention {
+			break
+		}
+		// exited processes are pruned with the others, and started ones replaced the resolved one
+		if t.processes[r.process.PID] == r.process {
+			delete(t.processes, r.process.PID)
+		}
+	}
+	t.resolved = t.resolved[i:]
+	for pid, missed := range t.misses {
+		if now.Sub(missed) >= missRetry {
+			delete(t.misses, pid)
+		}
+	}
+}
+
+// Get returns a process, resolving it on a cache miss
+func (t *Tree) Get(pid uint32) (Process, bool) {
+	t.mtx.RLock()
+	p, ok := t.processes[pid]
+	missed, miss := t.misses[pid]
+	t.mtx.RUnlock()
+	if ok {
+		return *p, true
+	}
+	if t.resolve == nil || (miss && time.Since(missed) < missRetry) {
+		return Process{}, false
+	}
+	resolved, err := t.resolve(pid)
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	// the process may have started while it was resolved
+	if p, ok := t.processes[pid]; ok {
+		return *p, true
+	}
+	if err != nil {
+		t.misses[pid] = time.Now()
+		return Process{}, false
+	}
+	t.processes[pid] = resolved
+	t.resolved = append(t.resolved, resolvedProcess{process: resolved, time: time.Now()})
+	return *resolved, true
+}
+
+// Ancestors returns the parent of a process, its grandparent and so on, up to the root of the host or of its container.
+// A parent which started after its child has reused the PID of the actual parent, which ends the ancestry.
+func (t *Tree) Ancestors(pid uint32) []Process {
+	var ancestors []Process
+	child, ok := t.Get(pid)
+	if !ok {
+		return nil
+	}
+	for len(ancestors) < maxAncestors {
+		if child.PPID == 0 || child.PPID == child.PID {
+			break
+		}
+		parent, ok := t.Get(child.PPID)
+		if !ok {
+			break
+		}
+		if !child.StartTime.IsZero() && parent.StartTime.After(child.StartTime) {
+			break
+		}
+		if child.ContainerID != "" && parent.ContainerID != child.ContainerID {
+			break
+		}
+		ancestors = append(ancestors, parent)
+		child = parent
+	}
+	return ancestors
+}
+
+// Len returns the number of processes in the tree, exited ones included
+func (t *Tree) Len() int {
+	t.mtx.RLock()
+	defer t.mtx.RUnlock()
+	return len(t.processes)
+}
+
+// FromSystem resolves a process by querying the system
+func FromSystem(pid uint32) (*Process, error) {
+	p, err := process.NewProcess(int32(pid))
+	if err != nil {
+		return nil, err
+	}
+	res := &Process{PID: pid}
+	if name, err := p.Name(); err == nil {
+		res.Name = name
+	}
+	if exe, err := p.Exe(); err == nil {
+		res.ImageName = exe
+	}
+	if ppid, err := p.Ppid(); err == nil {
+		res.PPID = uint32(ppid)
+	}
+	if cmdline, err := p.Cmdline(); err == nil {
+		res.Cmdline = cmdline
+	}
+	if createTime, err := p.CreateTime(); err == nil {
+		res.StartTime = time.UnixMilli(createTime)
+	}
+	if res.Name == "" {
+		res.Name = BaseName(res.ImageName)
+	}
+	return res, nil
+}
+
+// Cmdline reads the command line of a process from the system
+func Cmdline(pid uint32) (string, error) {
+	p, err := process.NewProcess(int32(pid))
+	if err != nil {
+		return "", err
+	}
+	return p.Cmdline()
+}
+
+// BaseName returns the file name of a Windows or NT path, e.g. cmd.exe for \Device\HarddiskVolume3\Windows\System32\cmd.exe
+func BaseName(path string) string {
+	if i := strings.LastIndexAny(path, `\/`); i >= 0 {
+		return path[i+1:]
+	}
+	return path
+}
@@ -0,0 +1,139 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package proctree
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTreePrune(t *testing.T) {
+	start := time.Now()
+	resolver := func(pid uint32) (*Process, error) {
+		if pid != 20 && pid != 21 {
+			return nil, errors.New("not found")
+		}
+		return &Process{PID: pid, ImageName: `C:\Windows\System32\svchost.exe`}, nil
+	}
+	tree := New(resolver)
+	tree.Start(Process{PID: 10, ImageName: `C:\Windows\System32\cmd.exe`, StartTime: start})
+	tree.Start(Process{PID: 11, StartTime: start})
+	tree.Exit(10, start)
+	if _, ok := tree.Get(20); !ok {
+		t.Fatal("the resolver didn't resolve the process")
+	}
+	if _, ok := tree.Get(30); ok {
+		t.Fatal("resolved a missing process")
+	}
+	// a resolved process whose PID was reused by a started one
+	tree.Get(21)
+	tree.Start(Process{PID: 21, ImageName: "started.exe", StartTime: start})
+
+	tree.Prune(start.Add(exitedRetention))
+	if _, ok := tree.Get(10); ok {
+		t.Error("an exited process was kept past its retention")
+	}
+	if p, ok := tree.Get(11); !ok || p.Exited() {
+		t.Error("a running process was pruned")
+	}
+
+	if n := tree.Len(); n != 3 {
+		t.Errorf("tree has %d processes, want 11, 21 and the resolved 20", n)
+	}
+	tree.Prune(time.Now().Add(resolvedRetention))
+	if n := tree.Len(); n != 2 {
+		t.Errorf("tree has %d processes, want 11 and 21", n)
+	}
+	if _, ok := tree.processes[20]; ok {
+		t.Error("a resolved process was kept past its retention")
+	}
+	if p, ok := tree.Get(21); !ok || p.ImageName != "started.exe" {
+		t.Errorf("the started process replacing a resolved one was pruned, got %+v", p)
+	}
+}
+
+func TestTreeAncestors(t *testing.T) {
+	start := time.Now()
+	tree := New(nil)
+	tree.Start(Process{PID: 1, PPID: 0, ImageName: `C:\Windows\explorer.exe`, StartTime: start})
+	tree.Start(Process{PID: 2, PPID: 1, ImageName: `C:\Windows\System32\cmd.exe`, StartTime: start.Add(time.Second)})
+	tree.Start(Process{PID: 3, PPID: 2, ImageName: `C:\Windows\System32\whoami.exe`, StartTime: start.Add(2 * time.Second)})
+	tree.Start(Process{PID: 4, PPID: 3, ImageName: "in.exe", ContainerID: "abc", StartTime: start.Add(3 * time.Second)})
+	// the parent exited and its PID was reused by a later process
+	tree.Start(Process{PID: 5, PPID: 6, ImageName: "orphan.exe", StartTime: start.Add(4 * time.Second)})
+	tree.Start(Process{PID: 6, PPID: 1, ImageName: "reused.exe", StartTime: start.Add(5 * time.Second)})
+	// a loop in the parents
+	tree.Start(Process{PID: 7, PPID: 8})
+	tree.Start(Process{PID: 8, PPID: 7})
+
+	tests := []struct {
+		pid  uint32
+		want []uint32
+	}{
+		{pid: 3, want: []uint32{2, 1}},
+		{pid: 1, want: nil},
+		{pid: 4, want: nil},
+		{pid: 5, want: nil},
+		{pid: 99, want: nil},
+	}
+	for _, tt := range tests {
+		ancestors := tree.Ancestors(tt.pid)
+		var got []uint32
+		for _, p := range ancestors {
+			got = append(got, p.PID)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("Ancestors(%d) = %v, want %v", tt.pid, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("Ancestors(%d) = %v, want %v", tt.pid, got, tt.want)
+				break
+			}
+		}
+	}
+	if n := len(tree.Ancestors(7)); n != maxAncestors {
+		t.Errorf("Ancestors of a loop = %d processes, want %d", n, maxAncestors)
+	}
+	if p, _ := tree.Get(2); p.Name != "cmd.exe" {
+		t.Errorf("Name = %s, want cmd.exe", p.Name)
+	}
+}
+
+func TestTreeUpdate(t *testing.T) {
+	start := time.Now()
+	tree := New(nil)
+	tree.Start(Process{PID: 10, ImageName: `C:\Windows\System32\cmd.exe`, StartTime: start})
+	tree.Start(Process{PID: 11, StartTime: start})
+	tree.Exit(11, start)
+	setCmdline := func(p *Process) { p.Cmdline = "cmd.exe /c whoami" }
+
+	tree.Update(10, start, setCmdline)
+	if p, _ := tree.Get(10); p.Cmdline != "cmd.exe /c whoami" {
+		t.Errorf("cmdline = %q, want it updated", p.Cmdline)
+	}
+	// the PID was reused by another process
+	tree.Update(10, start.Add(-time.Second), func(p *Process) { p.Cmdline = "stale" })
+	if p, _ := tree.Get(10); p.Cmdline != "cmd.exe /c whoami" {
+		t.Errorf("cmdline = %q, want the update of another process ignored", p.Cmdline)
+	}
+	tree.Update(12, start, setCmdline)
+	if _, ok := tree.Get(12); ok {
+		t.Error("an update added an unknown process")
+	}
+
+	// exited processes are still pruned once updated
+	tree.Update(11, start, setCmdline)
+	if p, _ := tree.Get(11); p.Cmdline != "cmd.exe /c whoami" || !p.Exited() {
+		t.Errorf("exited process = %+v, want its cmdline updated", p)
+	}
+	tree.Prune(start.Add(exitedRetention))
+	if _, ok := tree.Get(11); ok {
+		t.Error("an updated exited process was kept past its retention")
+	}
+}
@@ -30,3 +30,6 @@ type Event struct {
 	Headers EventHeaders
 	Payload interface{}
 }
+
+// FindingsSource is the source of the events made from findings, signatures subscribe to it to build on other signatures
+const FindingsSource = "eolh-findings"
@@ -0,0 +1,71 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+// Package rpc holds what the gRPC services of eolh share.
+//
+// Messages are plain Go structs encoded as JSON, so that services are declared without generated code and can be
+// implemented in any language with a gRPC library supporting custom codecs (content-subtype "json").
+//
+// On the wire, requests and responses are the JSON documents of the messages, in regular uncompressed gRPC frames
+// (a compressed flag byte and a 4-byte big-endian length), with the content-type application/grpc+json. JSON fields
+// are named after the json tags of the message types, empty fields may be omitted and unknown fields are ignored.
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+)
+
+// CodecName is the content-subtype of the messages, i.e. application/grpc+json
+const CodecName = "json"
+
+func init() {
+	encoding.RegisterCodec(codec{})
+}
+
+type codec struct{}
+
+func (codec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (codec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (codec) Name() string {
+	return CodecName
+}
+
+// CallOption makes a client call use the JSON codec
+func CallOption() grpc.CallOption {
+	return grpc.CallContentSubtype(CodecName)
+}
+
+// UnaryMethod describes a unary method of a service, calling the method of its S implementation
+func UnaryMethod[S any, Req any, Res any](service string, method string, call func(S, context.Context, *Req) (*Res, error)) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: method,
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			req := new(Req)
+			if err := dec(req); err != nil {
+				return nil, err
+			}
+			if interceptor == nil {
+				return call(srv.(S), ctx, req)
+			}
+			info := &grpc.UnaryServerInfo{
+				Server:     srv,
+				FullMethod: "/" + service + "/" + method,
+			}
+			return interceptor(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+				return call(srv.(S), ctx, req.(*Req))
+			})
+		},
+	}
+}
@@ -0,0 +1,133 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+// Package http serves the health, readiness, metrics and debugging endpoints of eolh.
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"eolh/pkg/logger"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// shutdownTimeout bounds how long Shutdown waits for the requests in flight
+const shutdownTimeout = 5 * time.Second
+
+// Check returns an error when what it checks is unhealthy
+type Check func() error
+
+type Server struct {
+	mux    *http.ServeMux
+	server *http.Server
+}
+
+func New() *Server {
+	mux := http.NewServeMux()
+	return &Server{
+		mux: mux,
+		server: &http.Server{
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+		},
+	}
+}
+
+// EnableMetricsEndpoint serves /metrics in the Prometheus format, with the given collectors and the Go runtime metrics
+func (s *Server) EnableMetricsEndpoint(cs ...prometheus.Collector) error {
+	registry := prometheus.NewRegistry()
+	cs = append(cs, collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	for _, c := range cs {
+		if err := registry.Register(c); err != nil {
+			return err
+		}
+	}
+	s.mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	return nil
+}
+
+// EnableHealthEndpoints serves /healthz, failing when any liveness check fails, and /readyz, failing when any
+// liveness or readiness check fails
+func (s *Server) EnableHealthEndpoints(liveness map[string]Check, readiness map[string]Check) {
+	s.mux.Handle("/healthz", checksHandler(liveness))
+	all := make(map[string]Check, len(liveness)+len(readiness))
+	for name, check := range liveness {
+		all[name] = check
+	}
+	for name, check := range readiness {
+		all[name] = check
+	}
+	s.mux.Handle("/readyz", checksHandler(all))
+}
+
+// checksHandler runs the checks, answering 200 when they all pass and 503 otherwise, along with their results
+func checksHandler(checks map[string]Check) http.Handler {
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		results := make(map[string]string, len(checks))
+		status := http.StatusOK
+		for _, name := range names {
+			if err := checks[name](); err != nil {
+				results[name] = err.Error()
+				status = http.StatusServiceUnavailable
+				continue
+			}
+			results[name] = "ok"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		if err := json.NewEncoder(w).Encode(results); err != nil {
+			logger.Debugw("Writing health checks", "error", err)
+		}
+	})
+}
+
+// EnablePProfEndpoints serves the profiles of net/http/pprof under /debug/pprof/
+func (s *Server) EnablePProfEndpoints() {
+	s.mux.HandleFunc("/debug/pprof/", pprof.Index)
+	s.mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	s.mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	s.mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	s.mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+}
+
+// EnableDiagEndpoint serves /debug/diag, the JSON encoding of what diag returns
+func (s *Server) EnableDiagEndpoint(diag func() interface{}) {
+	s.mux.HandleFunc("/debug/diag", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(diag()); err != nil {
+			logger.Debugw("Writing diagnostics", "error", err)
+		}
+	})
+}
+
+// Serve serves the connections of the listener until Shutdown is called
+func (s *Server) Serve(lis net.Listener) error {
+	if err := s.server.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) Shutdown() {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := s.server.Shutdown(ctx); err != nil {
+		logger.Errorw("Shutting down the HTTP server", "error", err)
+	}
+}
@@ -0,0 +1,320 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+// Package bundle reads and writes signed signature bundles.
+//
+// A bundle is a tar.gz archive of signature files along with a manifest.json naming the bundle, its version, and the
+// SHA-256 digest of every file. It is signed by a detached signature over the whole archive, made with an Ed25519 or an
+// ECDSA key as `cosign sign-blob` does: the base64 encoding of the Ed25519 signature or of the ASN.1 ECDSA signature of the
+// SHA-256 digest of the archive. The signature is checked before anything in the archive is read.
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ManifestFile is the name of the manifest in the archive
+const ManifestFile = "manifest.json"
+
+// SignatureSuffix is appended to the path of a bundle to find its signature
+const SignatureSuffix = ".sig"
+
+// maxFileSize bounds the size of the files read from an archive
+const maxFileSize = 16 << 20
+
+type Manifest struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	// Files are the SHA-256 digests of the files of the bundle, keyed by their slash separated path
+	Files map[string]string `json:"files"`
+}
+
+// Bundle is a verified bundle
+type Bundle struct {
+	Manifest Manifest
+	// Files are the contents of the files of the bundle, keyed by their slash separated path
+	Files map[string][]byte
+}
+
+func (b *Bundle) String() string {
+	return b.Manifest.Name + "@" + b.Manifest.Version
+}
+
+// Open reads a bundle and its detached signature, and verifies them with the public key
+func Open(bundlePath string, signaturePath string, key crypto.PublicKey) (*Bundle, error) {
+	archive, err := os.ReadFile(bundlePath)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := os.ReadFile(signaturePath)
+	if err != nil {
+		return nil, err
+	}
+	if err := Verify(archive, signature, key); err != nil {
+		return nil, fmt.Errorf("%s: %w", bundlePath, err)
+	}
+	b, err := Read(archive)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", bundlePath, err)
+	}
+	return b, nil
+}
+
+// Verify checks the base64 encoded signature of an archive
+func Verify(archive []byte, signature []byte, key crypto.PublicKey) error {
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil {
+		return fmt.Errorf("decoding signature: %w", err)
+	}
+	switch k := key.(type) {
+	case ed25519.PublicKey:
+		if !ed25519.Verify(k, archive, sig) {
+			return errors.New("invalid bundle signature")
+		}
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(archive)
+		if !ecdsa.VerifyASN1(k, digest[:], sig) {
+			return errors.New("invalid bundle signature")
+		}
+	default:
+		return fmt.Errorf("unsupported public key: %T", key)
+	}
+	return nil
+}
+
+// Read extracts an archive in memory and checks its files against the manifest. It doesn't verify the signature.
+func Read(archive []byte) (*Bundle, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	files := make(map[string][]byte)
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			continue
+		case tar.TypeReg:
+		default:
+			return nil, fmt.Errorf("unsupported entry %s: only regular files are allowed", header.Name)
+		}
+		name := path.Clean(strings.TrimPrefix(header.Name, "./"))
+		if !fs.ValidPath(name) {
+			return nil, fmt.Errorf("invalid entry name: %s", header.Name)
+		}
+		if _, ok := files[name]; ok {
+			return nil, fmt.Errorf("duplicate entry: %s", name)
+		}
+		if header.Size > maxFileSize {
+			return nil, fmt.Errorf("entry %s is too large", name)
+		}
+		content, err := io.ReadAll(io.LimitReader(tr, maxFileSize))
+		if err != nil {
+			return nil, err
+		}
+		files[name] = content
+	}
+
+	manifestData, ok := files[ManifestFile]
+	if !ok {
+		return nil, fmt.Errorf("missing %s", ManifestFile)
+	}
+	delete(files, ManifestFile)
+	var manifest Manifest
+	if err := json.Unmarshal(manifestData, &manifest); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", ManifestFile, err)
+	}
+	if manifest.Name == "" || manifest.Version == "" {
+		return nil, fmt.Errorf("%s must name the bundle and its version", ManifestFile)
+	}
+	for name, content := range files {
+		digest, ok := manifest.Files[name]
+		if !ok {
+			return nil, fmt.Errorf("%s is not listed in %s", name, ManifestFile)
+		}
+		sum := sha256.Sum256(content)
+		if !strings.EqualFold(digest, hex.EncodeToString(sum[:])) {
+			return nil, fmt.Errorf("digest mismatch for %s", name)
+		}
+	}
+	for name := range manifest.Files {
+		if _, ok := files[name]; !ok {
+			return nil, fmt.Errorf("%s is listed in %s but missing", name, ManifestFile)
+		}
+	}
+	return &Bundle{Manifest: manifest, Files: files}, nil
+}
+
+// Create archives the files of dir with the given extensions into a bundle
+func Create(dir string, name string, version string, exts ...string) ([]byte, error) {
+	manifest := Manifest{Name: name, Version: version, Files: make(map[string]string)}
+	files := make(map[string][]byte)
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == ManifestFile || !hasExt(rel, exts) {
+			return nil
+		}
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(content)
+		manifest.Files[rel] = hex.EncodeToString(sum[:])
+		files[rel] = content
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	write := func(name string, content []byte) error {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:    name,
+			Mode:    0644,
+			Size:    int64(len(content)),
+			ModTime: time.Unix(0, 0),
+		}); err != nil {
+			return err
+		}
+		_, err := tw.Write(content)
+		return err
+	}
+	if err := write(ManifestFile, manifestData); err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if err := write(name, files[name]); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func hasExt(name string, exts []string) bool {
+	if len(exts) == 0 {
+		return true
+	}
+	for _, ext := range exts {
+		if path.Ext(name) == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// Sign returns the base64 encoded signature of an archive
+func Sign(archive []byte, key crypto.PrivateKey) ([]byte, error) {
+	var sig []byte
+	var err error
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(k, archive)
+	case *ecdsa.PrivateKey:
+		digest := sha256.Sum256(archive)
+		sig, err = ecdsa.SignASN1(rand.Reader, k, digest[:])
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported private key: %T", key)
+	}
+	return []byte(base64.StdEncoding.EncodeToString(sig) + "\n"), nil
+}
+
+// LoadPublicKey reads a PEM encoded PKIX public key, as written by `cosign generate-key-pair` or `openssl pkey -pubout`
+func LoadPublicKey(path string) (crypto.PublicKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return key, nil
+}
+
+// LoadPrivateKey reads a PEM encoded unencrypted PKCS #8 private key
+func LoadPrivateKey(path string) (crypto.PrivateKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return key, nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", path)
+	}
+	return block, nil
+}
@@ -0,0 +1,274 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type entry struct {
+	name     string
+	typeflag byte
+	content  string
+}
+
+func digest(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func manifest(files map[string]string) string {
+	m := Manifest{Name: "test", Version: "1.0.0", Files: make(map[string]string)}
+	for name, content := range files {
+		m.Files[name] = digest(content)
+	}
+	data, _ := json.Marshal(m)
+	return string(data)
+}
+
+// archive writes the entries into a tar.gz archive
+func archive(t *testing.T, entries ...entry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		typeflag := e.typeflag
+		if typeflag == 0 {
+			typeflag = tar.TypeReg
+		}
+		header := &tar.Header{Name: e.name, Typeflag: typeflag, Mode: 0o644, Size: int64(len(e.content))}
+		if typeflag != tar.TypeReg {
+			header.Size = 0
+			header.Linkname = "target"
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if typeflag == tar.TypeReg {
+			if _, err := tw.Write([]byte(e.content)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestRead(t *testing.T) {
+	const rule = "package eolh.TEST_1\n"
+	files := map[string]string{"rules/test.rego": rule}
+
+	tests := []struct {
+		name      string
+		archive   []byte
+		wantError bool
+	}{
+		{
+			name:    "valid",
+			archive: archive(t, entry{name: ManifestFile, content: manifest(files)}, entry{name: "rules/test.rego", content: rule}),
+		},
+		{
+			name: "directories and dot prefix",
+			archive: archive(t,
+				entry{name: "./", typeflag: tar.TypeDir},
+				entry{name: "./" + ManifestFile, content: manifest(files)},
+				entry{name: "./rules/", typeflag: tar.TypeDir},
+				entry{name: "./rules/test.rego", content: rule},
+			),
+		},
+		{
+			name:      "missing manifest",
+			archive:   archive(t, entry{name: "rules/test.rego", content: rule}),
+			wantError: true,
+		},
+		{
+			name: "unlisted file",
+			archive: archive(t,
+				entry{name: ManifestFile, content: manifest(files)},
+				entry{name: "rules/test.rego", content: rule},
+				entry{name: "rules/other.rego", content: rule},
+			),
+			wantError: true,
+		},
+		{
+			name:      "digest mismatch",
+			archive:   archive(t, entry{name: ManifestFile, content: manifest(files)}, entry{name: "rules/test.rego", content: "package eolh.TEST_2\n"}),
+			wantError: true,
+		},
+		{
+			name:      "listed file missing",
+			archive:   archive(t, entry{name: ManifestFile, content: manifest(files)}),
+			wantError: true,
+		},
+		{
+			name:      "unnamed bundle",
+			archive:   archive(t, entry{name: ManifestFile, content: `{"files": {}}`}),
+			wantError: true,
+		},
+		{
+			name:      "invalid manifest",
+			archive:   archive(t, entry{name: ManifestFile, content: "{"}),
+			wantError: true,
+		},
+		{
+			name: "path traversal",
+			archive: archive(t,
+				entry{name: ManifestFile, content: manifest(map[string]string{"../test.rego": rule})},
+				entry{name: "../test.rego", content: rule},
+			),
+			wantError: true,
+		},
+		{
+			name: "duplicate entry",
+			archive: archive(t,
+				entry{name: ManifestFile, content: manifest(files)},
+				entry{name: "rules/test.rego", content: rule},
+				entry{name: "./rules/test.rego", content: rule},
+			),
+			wantError: true,
+		},
+		{
+			name: "symbolic link",
+			archive: archive(t,
+				entry{name: ManifestFile, content: manifest(files)},
+				entry{name: "rules/test.rego", typeflag: tar.TypeSymlink},
+			),
+			wantError: true,
+		},
+		{name: "not an archive", archive: []byte("not gzip"), wantError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := Read(tt.archive)
+			if tt.wantError {
+				if err == nil {
+					t.Error("Read accepted the archive")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b.String() != "test@1.0.0" {
+				t.Errorf("String() = %s, want test@1.0.0", b)
+			}
+			if len(b.Files) != 1 || string(b.Files["rules/test.rego"]) != rule {
+				t.Errorf("Files = %q, want only rules/test.rego", b.Files)
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPublic, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecPrivate, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("archive")
+	sign := func(key crypto.PrivateKey) []byte {
+		sig, err := Sign(data, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sig
+	}
+
+	tests := []struct {
+		name      string
+		archive   []byte
+		signature []byte
+		key       crypto.PublicKey
+		wantError bool
+	}{
+		{name: "ed25519", archive: data, signature: sign(edPrivate), key: edPublic},
+		{name: "ecdsa", archive: data, signature: sign(ecPrivate), key: &ecPrivate.PublicKey},
+		{name: "ed25519 tampered", archive: []byte("archivE"), signature: sign(edPrivate), key: edPublic, wantError: true},
+		{name: "ecdsa tampered", archive: []byte("archivE"), signature: sign(ecPrivate), key: &ecPrivate.PublicKey, wantError: true},
+		{name: "other key", archive: data, signature: sign(edPrivate), key: otherPublic, wantError: true},
+		{name: "key of another type", archive: data, signature: sign(edPrivate), key: &ecPrivate.PublicKey, wantError: true},
+		{name: "invalid base64", archive: data, signature: []byte("%%%"), key: edPublic, wantError: true},
+		{name: "unsupported key", archive: data, signature: sign(edPrivate), key: "key", wantError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.archive, tt.signature, tt.key)
+			if (err != nil) != tt.wantError {
+				t.Errorf("Verify() = %v, want error %t", err, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestCreateAndOpen(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"rules/test.rego": "package eolh.TEST_1\n",
+		"sigma/test.yml":  "title: test\n",
+		"README.md":       "not a signature\n",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := Create(dir, "test", "1.0.0", ".rego", ".yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := Sign(data, private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := t.TempDir()
+	bundlePath := filepath.Join(out, "test.tar.gz")
+	if err := os.WriteFile(bundlePath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(bundlePath+SignatureSuffix, sig, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	b, err := Open(bundlePath, bundlePath+SignatureSuffix, public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.Files) != 2 || b.Files["rules/test.rego"] == nil || b.Files["sigma/test.yml"] == nil {
+		t.Errorf("Files = %q, want the rego and sigma files", b.Files)
+	}
+}
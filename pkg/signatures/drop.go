@@ -13,7 +13,6 @@ import (
 	"eolh/pkg/protocol"
 	"eolh/pkg/trace"
 	"fmt"
-	"os"
 )
 
 func IsPe(bytesArray []byte) bool {
@@ -48,7 +47,7 @@ func (sig *Drop) GetMetadata() (detect.SignatureMetadata, error) {
 
 func (sig *Drop) GetSelectedEvents() ([]detect.SignatureEventSelector, error) {
 	return []detect.SignatureEventSelector{{
-		Source: "eolh", Name: "*", Origin: "*",
+		Source: "eolh", Name: "file_close", Origin: "*",
 	}}, nil
 }
 
@@ -62,49 +61,31 @@ func (sig *Drop) OnEvent(event protocol.Event) error {
 	if !ok {
 		return fmt.Errorf("failed to cast event's payload")
 	}
-	if ee.IsHost {
+	if ee.IsHost || ee.ContainerID == "" {
 		return nil
 	}
-	e := ee.RawEvent
-	if e.EventData == nil {
+	// written PE images are flagged when they are closed, their hash is left out when they couldn't be hashed in time
+	if _, ok := ee.Arg("is_pe"); !ok {
 		return nil
 	}
-	if e.System.Opcode.Value != 0 || e.System.Task.Value != 30 {
-		return nil
-	}
-	if e.EventData == nil {
-		return nil
-	}
-	f, ok := e.EventData["FileName"]
-	if !ok {
-		return nil
-	}
-	if f.(string) == "" {
-		return nil
-	}
-	id := ee.ContainerID
-	if id == "" {
-		return nil
-	}
-	file, err := os.Open("\\\\?\\GLOBALROOT" + f.(string))
-	if err != nil {
-		return nil // Noisy
-	}
-	b := make([]byte, 2)
-	n, _ := file.Read(b)
-	if !IsPe(b[:n]) {
-		return nil
+	fileName, _ := ee.Arg("FileName")
+	sha256 := ""
+	if arg, ok := ee.Arg("sha256"); ok {
+		sha256, _ = arg.Value.(string)
 	}
 	metadata, err := sig.GetMetadata()
 	if err != nil {
 		return err
 	}
-	message := fmt.Sprintf("New Executable Dropped in container detected: FileName=%s", f.(string))
+	message := fmt.Sprintf("New Executable Dropped in container detected: FileName=%v SHA256=%v", fileName.Value, sha256)
 	sig.cb(detect.Finding{
 		SigMetadata: metadata,
 		Event:       event,
-		Data:        nil,
-		Msg:         message,
+		Data: map[string]interface{}{
+			"FileName": fileName.Value,
+			"sha256":   sha256,
+		},
+		Msg: message,
 	})
 	return nil
 }
@@ -22,6 +22,7 @@ type FakeSignature struct {
 	FakeInit              func(detect.SignatureContext) error
 	FakeOnEvent           func(protocol.Event) error
 	FakeOnSignal          func(signal detect.Signal) error
+	FakeClose             func()
 }
 
 func (fs FakeSignature) GetMetadata() (detect.SignatureMetadata, error) {
@@ -63,4 +64,8 @@ func (fs FakeSignature) OnSignal(signal detect.Signal) error {
 	return nil
 }
 
-func (fs FakeSignature) Close() {}
+func (fs FakeSignature) Close() {
+	if fs.FakeClose != nil {
+		fs.FakeClose()
+	}
+}
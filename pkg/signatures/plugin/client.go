@@ -0,0 +1,270 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package plugin
+
+import (
+	"context"
+	"eolh/pkg/detect"
+	"eolh/pkg/logger"
+	"eolh/pkg/protocol"
+	"eolh/pkg/trace"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// callTimeout bounds the time a plugin takes to handle an event or a signal
+var callTimeout = 10 * time.Second
+
+// ShutdownTimeout bounds the time a plugin takes to flush its findings on shutdown, eolh waits a bit longer for the
+// signature engine to flush so that these findings are printed
+var ShutdownTimeout = 3 * time.Second
+
+const (
+	// queueSize bounds the events waiting for a plugin signature, events are dropped beyond so that a slow plugin
+	// doesn't stall the engine
+	queueSize = 1000
+)
+
+// Load returns the signatures served by a plugin, dropped counts the events they drop
+func Load(cc grpc.ClientConnInterface, dropped *atomic.Uint64) ([]detect.Signature, error) {
+	client := pluginClient{cc: cc}
+	ctx, cancel := context.WithTimeout(context.Background(), callTimeout)
+	defer cancel()
+	res, err := client.ListSignatures(ctx, &ListSignaturesRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("listing plugin signatures: %w", err)
+	}
+	sigs := make([]detect.Signature, 0, len(res.Signatures))
+	for _, s := range res.Signatures {
+		sigs = append(sigs, &remoteSignature{
+			client:         client,
+			metadata:       s.Metadata,
+			selectedEvents: s.SelectedEvents,
+			dropped:        dropped,
+		})
+	}
+	return sigs, nil
+}
+
+// remoteSignature is a signature running in a plugin, it is called asynchronously from a queue
+type remoteSignature struct {
+	client         pluginClient
+	cb             detect.SignatureHandler
+	metadata       detect.SignatureMetadata
+	selectedEvents []detect.SignatureEventSelector
+	calls          chan call
+	done           chan struct{}
+	dropped        *atomic.Uint64
+	// ctx is cancelled once the signature stopped, closed then keeps the findings still coming from being reported
+	ctx    context.Context
+	cancel context.CancelFunc
+	mtx    sync.Mutex
+	closed bool
+}
+
+// call is an event or a signal for the plugin, handled is closed once the plugin answered
+type call struct {
+	event   *EventRequest
+	signal  *SignalRequest
+	handled chan struct{}
+}
+
+func (sig *remoteSignature) GetMetadata() (detect.SignatureMetadata, error) {
+	return sig.metadata, nil
+}
+
+func (sig *remoteSignature) GetSelectedEvents() ([]detect.SignatureEventSelector, error) {
+	return sig.selectedEvents, nil
+}
+
+func (sig *remoteSignature) Init(ctx detect.SignatureContext) error {
+	sig.cb = ctx.Callback
+	sig.calls = make(chan call, queueSize)
+	sig.done = make(chan struct{})
+	sig.ctx, sig.cancel = context.WithCancel(context.Background())
+	go sig.run()
+	return nil
+}
+
+// Close doesn't stop the calls, the engine may deliver the shutdown signal after it, which stops them
+func (sig *remoteSignature) Close() {}
+
+// stop cancels the pending calls, no finding is reported once it returns
+func (sig *remoteSignature) stop() {
+	sig.mtx.Lock()
+	sig.closed = true
+	sig.mtx.Unlock()
+	sig.cancel()
+}
+
+// run calls the plugin with the queued events and signals until the shutdown signal, or until stopped
+func (sig *remoteSignature) run() {
+	defer close(sig.done)
+	for {
+		var c call
+		select {
+		case c = <-sig.calls:
+		case <-sig.ctx.Done():
+			return
+		}
+		if err := sig.call(c); err != nil {
+			logger.Errorw("Calling plugin signature", "signature", sig.metadata.ID, "error", err)
+		}
+		if c.handled != nil {
+			close(c.handled)
+		}
+		if c.signal != nil && c.signal.Signal.Type == "shutdown" {
+			return
+		}
+	}
+}
+
+func (sig *remoteSignature) call(c call) error {
+	timeout := callTimeout
+	if c.signal != nil && c.signal.Signal.Type == "shutdown" {
+		timeout = ShutdownTimeout
+	}
+	ctx, cancel := context.WithTimeout(sig.ctx, timeout)
+	defer cancel()
+	var findings []Finding
+	if c.event != nil {
+		res, err := sig.client.OnEvent(ctx, c.event)
+		if err != nil {
+			return err
+		}
+		findings = res.Findings
+	} else {
+		res, err := sig.client.OnSignal(ctx, c.signal)
+		if err != nil {
+			return err
+		}
+		findings = res.Findings
+	}
+	sig.report(findings)
+	return nil
+}
+
+// OnEvent queues the event for the plugin, it is dropped when the queue is full
+func (sig *remoteSignature) OnEvent(event protocol.Event) error {
+	ee, ok := event.Payload.(trace.Event)
+	if !ok {
+		return fmt.Errorf("failed to cast event's payload")
+	}
+	c := call{event: &EventRequest{
+		SignatureID: sig.metadata.ID,
+		Source:      event.Headers.Selector.Source,
+		Event:       ee,
+	}}
+	select {
+	case sig.calls <- c:
+	case <-sig.done:
+	default:
+		if sig.dropped != nil {
+			sig.dropped.Add(1)
+		}
+		logger.Debugw("Dropping an event for a busy plugin signature", "signature", sig.metadata.ID)
+	}
+	return nil
+}
+
+// OnSignal queues the signal for the plugin, signals aren't dropped and shutdown waits for the plugin to flush its
+// findings, for ShutdownTimeout at most. The signature is stopped once shutdown returns, as the engine doesn't expect
+// any finding after it.
+func (sig *remoteSignature) OnSignal(signal detect.Signal) error {
+	s, ok := toSignal(signal)
+	if !ok {
+		return nil
+	}
+	c := call{signal: &SignalRequest{
+		SignatureID: sig.metadata.ID,
+		Signal:      s,
+	}}
+	timeout := callTimeout
+	if s.Type == "shutdown" {
+		c.handled = make(chan struct{})
+		timeout = ShutdownTimeout
+		defer sig.stop()
+	}
+	deadline := time.After(timeout)
+	select {
+	case sig.calls <- c:
+	case <-sig.done:
+		return nil
+	case <-deadline:
+		return fmt.Errorf("plugin signature %s: timed out queueing signal %s", sig.metadata.ID, s.Type)
+	}
+	if c.handled != nil {
+		select {
+		case <-c.handled:
+		case <-deadline:
+			return fmt.Errorf("plugin signature %s: timed out handling signal %s", sig.metadata.ID, s.Type)
+		}
+	}
+	return nil
+}
+
+// report calls the callback with the findings of the plugin, unless the signature was stopped in the meantime
+func (sig *remoteSignature) report(findings []Finding) {
+	sig.mtx.Lock()
+	defer sig.mtx.Unlock()
+	if sig.closed {
+		return
+	}
+	for _, f := range findings {
+		event := f.Event.ToProtocol()
+		if f.Source == protocol.FindingsSource {
+			event = f.Event.ToFindingProtocol()
+		}
+		sig.cb(detect.Finding{
+			Data:        f.Data,
+			Event:       event,
+			SigMetadata: sig.metadata,
+			Msg:         f.Msg,
+		})
+	}
+}
+
+func toSignal(signal detect.Signal) (Signal, bool) {
+	switch s := signal.(type) {
+	case detect.SignalTick:
+		return Signal{Type: "tick", Time: time.Time(s)}, true
+	case detect.SignalShutdown:
+		return Signal{Type: "shutdown", Time: time.Now()}, true
+	case detect.SignalSourceComplete:
+		return Signal{Type: "source_complete", Time: time.Now(), Source: string(s)}, true
+	case detect.SignalContainerStart:
+		container := detect.SignalContainer(s)
+		return Signal{Type: "container_start", Time: s.Timestamp, Container: &container}, true
+	case detect.SignalContainerStop:
+		container := detect.SignalContainer(s)
+		return Signal{Type: "container_stop", Time: s.Timestamp, Container: &container}, true
+	}
+	return Signal{}, false
+}
+
+func (s Signal) detect() (detect.Signal, bool) {
+	switch s.Type {
+	case "tick":
+		return detect.SignalTick(s.Time), true
+	case "shutdown":
+		return detect.SignalShutdown{}, true
+	case "source_complete":
+		return detect.SignalSourceComplete(s.Source), true
+	case "container_start":
+		if s.Container != nil {
+			return detect.SignalContainerStart(*s.Container), true
+		}
+	case "container_stop":
+		if s.Container != nil {
+			return detect.SignalContainerStop(*s.Container), true
+		}
+	}
+	return nil, false
+}
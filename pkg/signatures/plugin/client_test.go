@@ -0,0 +1,167 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package plugin
+
+import (
+	"eolh/pkg/detect"
+	"eolh/pkg/protocol"
+	"eolh/pkg/trace"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// slowSignature blocks on its first event until released, and reports the events it saw on shutdown
+type slowSignature struct {
+	cb      detect.SignatureHandler
+	started chan struct{}
+	release chan struct{}
+	seen    int
+}
+
+func (s *slowSignature) GetMetadata() (detect.SignatureMetadata, error) {
+	return detect.SignatureMetadata{ID: "TEST-1", Name: "slow", EventName: "slow"}, nil
+}
+
+func (s *slowSignature) GetSelectedEvents() ([]detect.SignatureEventSelector, error) {
+	return []detect.SignatureEventSelector{{Source: "eolh", Name: "process_start"}}, nil
+}
+
+func (s *slowSignature) Init(ctx detect.SignatureContext) error {
+	s.cb = ctx.Callback
+	return nil
+}
+
+func (s *slowSignature) Close() {}
+
+func (s *slowSignature) OnEvent(event protocol.Event) error {
+	s.seen++
+	if s.seen == 1 {
+		close(s.started)
+		<-s.release
+	}
+	return nil
+}
+
+func (s *slowSignature) OnSignal(signal detect.Signal) error {
+	if _, ok := signal.(detect.SignalShutdown); ok {
+		s.cb(detect.Finding{Msg: fmt.Sprintf("seen %d", s.seen)})
+	}
+	return nil
+}
+
+// load serves the signature as a plugin and loads it back
+func load(t *testing.T, slow *slowSignature, dropped *atomic.Uint64) detect.Signature {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go Serve(lis, slow)
+	t.Cleanup(func() { lis.Close() })
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	sigs, err := Load(conn, dropped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sigs) != 1 {
+		t.Fatalf("loaded %d signatures, want 1", len(sigs))
+	}
+	return sigs[0]
+}
+
+func TestRemoteSignatureDropsEventsOfSlowPlugins(t *testing.T) {
+	slow := &slowSignature{started: make(chan struct{}), release: make(chan struct{})}
+	var dropped atomic.Uint64
+	sig := load(t, slow, &dropped)
+	var mtx sync.Mutex
+	var findings []detect.Finding
+	err := sig.Init(detect.SignatureContext{Callback: func(f detect.Finding) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		findings = append(findings, f)
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event := trace.Event{EventName: "process_start", ProcessName: "cmd.exe"}.ToProtocol()
+	if err := sig.OnEvent(event); err != nil {
+		t.Fatal(err)
+	}
+	<-slow.started
+	// the plugin is stuck on the first event, the queue fills up without blocking the caller
+	for i := 0; i < queueSize+5; i++ {
+		if err := sig.OnEvent(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := dropped.Load(); n != 5 {
+		t.Errorf("dropped %d events, want 5", n)
+	}
+
+	close(slow.release)
+	if err := sig.OnSignal(detect.SignalShutdown{}); err != nil {
+		t.Fatal(err)
+	}
+	sig.Close()
+	mtx.Lock()
+	defer mtx.Unlock()
+	want := fmt.Sprintf("seen %d", queueSize+1)
+	if len(findings) != 1 || findings[0].Msg != want || findings[0].SigMetadata.ID != "TEST-1" {
+		t.Errorf("findings = %+v, want the %q finding flushed on shutdown", findings, want)
+	}
+	// the plugin isn't called anymore once it shut down
+	if err := sig.OnEvent(event); err != nil {
+		t.Error(err)
+	}
+	if n := dropped.Load(); n != 5 {
+		t.Errorf("dropped %d events after shutdown, want 5", n)
+	}
+}
+
+func TestRemoteSignatureStopsReportingOnShutdownTimeout(t *testing.T) {
+	defer func(timeout time.Duration) { ShutdownTimeout = timeout }(ShutdownTimeout)
+	ShutdownTimeout = 200 * time.Millisecond
+	slow := &slowSignature{started: make(chan struct{}), release: make(chan struct{})}
+	sig := load(t, slow, nil)
+	var reported atomic.Int32
+	err := sig.Init(detect.SignatureContext{Callback: func(f detect.Finding) {
+		reported.Add(1)
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sig.OnEvent(trace.Event{EventName: "process_start"}.ToProtocol()); err != nil {
+		t.Fatal(err)
+	}
+	<-slow.started
+	// the engine closes its output once the shutdown signal returns, even if it timed out behind the event
+	if err := sig.OnSignal(detect.SignalShutdown{}); err == nil {
+		t.Error("shutdown didn't time out")
+	}
+	close(slow.release)
+	select {
+	case <-sig.(*remoteSignature).done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the plugin is still called after the shutdown timed out")
+	}
+	if n := reported.Load(); n != 0 {
+		t.Errorf("reported %d findings after the shutdown timed out", n)
+	}
+}
@@ -0,0 +1,137 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+// Package plugin runs signatures out of process, behind a gRPC service.
+//
+// A plugin is a process serving the eolh.signatures.v1.Plugin service, which Go plugins implement by passing their
+// detect.Signature values to Serve. Eolh connects to plugins with Load, and drives their signatures like its own:
+// events and signals are sent to the plugin, which answers with the findings they caused.
+// Data sources are not available to plugin signatures.
+//
+// # Wire contract
+//
+// Plugins written in other languages serve the following methods, with the messages encoded as JSON as described in
+// package rpc (content-type application/grpc+json). Field names are the JSON tags of the message types of this file,
+// the detect types have no tags and keep their Go field names.
+//
+//   - /eolh.signatures.v1.Plugin/ListSignatures, called once when loading the plugin with {}, returns
+//     {"signatures": [{"metadata": {"ID": ..., "Version": ..., "Name": ..., "EventName": ..., "Description": ...,
+//     "Tags": [...], "Properties": {...}}, "selectedEvents": [{"Source": ..., "Name": ..., "Origin": ...}]}]}.
+//     Signatures are addressed by their ID in the other calls.
+//   - /eolh.signatures.v1.Plugin/OnEvent is called with {"signatureId": ..., "source": "eolh" or "eolh-findings",
+//     "event": {...}} for every selected event, where event is a trace.Event, and returns the findings it caused as
+//     {"findings": [{"data": {...}, "msg": ..., "source": ..., "event": {...}}]}, source and event being the causal
+//     event of the finding.
+//   - /eolh.signatures.v1.Plugin/OnSignal is called with {"signatureId": ..., "signal": {"type": ..., "time": ...,
+//     "source": ..., "container": {...}}}, type being one of tick, shutdown, source_complete, container_start and
+//     container_stop, time an RFC 3339 timestamp and container a detect.SignalContainer. It returns findings like
+//     OnEvent, shutdown is the last call and its findings are the last ones reported.
+//
+// The calls of a signature are made one at a time, in the order of its events and signals, and each one is bounded
+// by a timeout. Errors are gRPC statuses: NotFound for an unknown signature ID and InvalidArgument for an unknown
+// signal type, eolh logs them and goes on with the next call.
+package plugin
+
+import (
+	"context"
+	"eolh/pkg/detect"
+	"eolh/pkg/rpc"
+	"eolh/pkg/trace"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+const serviceName = "eolh.signatures.v1.Plugin"
+
+type ListSignaturesRequest struct{}
+
+type Signature struct {
+	Metadata       detect.SignatureMetadata        `json:"metadata"`
+	SelectedEvents []detect.SignatureEventSelector `json:"selectedEvents"`
+}
+
+type ListSignaturesResponse struct {
+	Signatures []Signature `json:"signatures"`
+}
+
+type EventRequest struct {
+	SignatureID string `json:"signatureId"`
+	// Source is the source of the event, eolh or eolh-findings
+	Source string      `json:"source"`
+	Event  trace.Event `json:"event"`
+}
+
+// Signal describes a detect.Signal
+type Signal struct {
+	// Type is one of tick, shutdown, source_complete, container_start and container_stop
+	Type      string                  `json:"type"`
+	Time      time.Time               `json:"time"`
+	Source    string                  `json:"source,omitempty"`
+	Container *detect.SignalContainer `json:"container,omitempty"`
+}
+
+type SignalRequest struct {
+	SignatureID string `json:"signatureId"`
+	Signal      Signal `json:"signal"`
+}
+
+type Finding struct {
+	Data map[string]interface{} `json:"data,omitempty"`
+	Msg  string                 `json:"msg,omitempty"`
+	// Source and Event are the causal event of the finding
+	Source string      `json:"source"`
+	Event  trace.Event `json:"event"`
+}
+
+type FindingsResponse struct {
+	Findings []Finding `json:"findings"`
+}
+
+// PluginServer is the service served by plugins
+type PluginServer interface {
+	ListSignatures(context.Context, *ListSignaturesRequest) (*ListSignaturesResponse, error)
+	OnEvent(context.Context, *EventRequest) (*FindingsResponse, error)
+	OnSignal(context.Context, *SignalRequest) (*FindingsResponse, error)
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*PluginServer)(nil),
+	Methods: []grpc.MethodDesc{
+		rpc.UnaryMethod(serviceName, "ListSignatures", PluginServer.ListSignatures),
+		rpc.UnaryMethod(serviceName, "OnEvent", PluginServer.OnEvent),
+		rpc.UnaryMethod(serviceName, "OnSignal", PluginServer.OnSignal),
+	},
+	Metadata: "eolh/signatures/v1/plugin",
+}
+
+// RegisterPluginServer registers a plugin service on a gRPC server
+func RegisterPluginServer(s *grpc.Server, srv PluginServer) {
+	s.RegisterService(&serviceDesc, srv)
+}
+
+type pluginClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func (c pluginClient) invoke(ctx context.Context, method string, req interface{}, res interface{}) error {
+	return c.cc.Invoke(ctx, "/"+serviceName+"/"+method, req, res, rpc.CallOption())
+}
+
+func (c pluginClient) ListSignatures(ctx context.Context, req *ListSignaturesRequest) (*ListSignaturesResponse, error) {
+	res := new(ListSignaturesResponse)
+	return res, c.invoke(ctx, "ListSignatures", req, res)
+}
+
+func (c pluginClient) OnEvent(ctx context.Context, req *EventRequest) (*FindingsResponse, error) {
+	res := new(FindingsResponse)
+	return res, c.invoke(ctx, "OnEvent", req, res)
+}
+
+func (c pluginClient) OnSignal(ctx context.Context, req *SignalRequest) (*FindingsResponse, error) {
+	res := new(FindingsResponse)
+	return res, c.invoke(ctx, "OnSignal", req, res)
+}
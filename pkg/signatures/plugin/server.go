@@ -0,0 +1,166 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package plugin
+
+import (
+	"context"
+	"crypto/tls"
+	"eolh/pkg/detect"
+	"eolh/pkg/protocol"
+	"eolh/pkg/trace"
+	"fmt"
+	"net"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+// Serve serves signatures to eolh until the listener fails.
+// Findings reported outside of OnEvent and OnSignal are returned along with the next call to the signature.
+func Serve(lis net.Listener, sigs ...detect.Signature) error {
+	return serve(lis, nil, sigs)
+}
+
+// ServeTLS serves signatures to eolh over TLS, which eolh requires from the tcp:// plugins not on loopback
+func ServeTLS(lis net.Listener, config *tls.Config, sigs ...detect.Signature) error {
+	return serve(lis, []grpc.ServerOption{grpc.Creds(credentials.NewTLS(config))}, sigs)
+}
+
+func serve(lis net.Listener, opts []grpc.ServerOption, sigs []detect.Signature) error {
+	srv, err := NewServer(sigs...)
+	if err != nil {
+		return err
+	}
+	s := grpc.NewServer(opts...)
+	RegisterPluginServer(s, srv)
+	return s.Serve(lis)
+}
+
+// NewServer initializes the signatures and returns the plugin service serving them
+func NewServer(sigs ...detect.Signature) (PluginServer, error) {
+	srv := &server{signatures: make(map[string]*servedSignature, len(sigs))}
+	for _, sig := range sigs {
+		metadata, err := sig.GetMetadata()
+		if err != nil {
+			return nil, err
+		}
+		selectedEvents, err := sig.GetSelectedEvents()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", metadata.ID, err)
+		}
+		if _, ok := srv.signatures[metadata.ID]; ok {
+			return nil, fmt.Errorf("duplicate signature %s", metadata.ID)
+		}
+		served := &servedSignature{
+			sig: sig,
+			info: Signature{
+				Metadata:       metadata,
+				SelectedEvents: selectedEvents,
+			},
+		}
+		err = sig.Init(detect.SignatureContext{
+			Callback: served.record,
+			GetDataSource: func(namespace string, id string) (detect.DataSource, bool) {
+				return nil, false
+			},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", metadata.ID, err)
+		}
+		srv.order = append(srv.order, metadata.ID)
+		srv.signatures[metadata.ID] = served
+	}
+	return srv, nil
+}
+
+type server struct {
+	order      []string
+	signatures map[string]*servedSignature
+}
+
+// servedSignature serializes the calls to a signature, and buffers its findings
+type servedSignature struct {
+	mutex         sync.Mutex
+	sig           detect.Signature
+	info          Signature
+	findingsMutex sync.Mutex
+	findings      []Finding
+}
+
+func (s *servedSignature) record(f detect.Finding) {
+	finding := Finding{
+		Data:   f.Data,
+		Msg:    f.Msg,
+		Source: f.Event.Headers.Selector.Source,
+	}
+	if ee, ok := f.Event.Payload.(trace.Event); ok {
+		finding.Event = ee
+	}
+	s.findingsMutex.Lock()
+	defer s.findingsMutex.Unlock()
+	s.findings = append(s.findings, finding)
+}
+
+// call runs fn with the signature, and returns the findings buffered so far
+func (s *servedSignature) call(fn func() error) (*FindingsResponse, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := fn(); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	s.findingsMutex.Lock()
+	defer s.findingsMutex.Unlock()
+	res := &FindingsResponse{Findings: s.findings}
+	s.findings = nil
+	return res, nil
+}
+
+func (srv *server) lookup(id string) (*servedSignature, error) {
+	s, ok := srv.signatures[id]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "signature %s not found", id)
+	}
+	return s, nil
+}
+
+func (srv *server) ListSignatures(ctx context.Context, req *ListSignaturesRequest) (*ListSignaturesResponse, error) {
+	res := &ListSignaturesResponse{Signatures: make([]Signature, 0, len(srv.order))}
+	for _, id := range srv.order {
+		res.Signatures = append(res.Signatures, srv.signatures[id].info)
+	}
+	return res, nil
+}
+
+func (srv *server) OnEvent(ctx context.Context, req *EventRequest) (*FindingsResponse, error) {
+	s, err := srv.lookup(req.SignatureID)
+	if err != nil {
+		return nil, err
+	}
+	event := req.Event.ToProtocol()
+	if req.Source == protocol.FindingsSource {
+		event = req.Event.ToFindingProtocol()
+	}
+	return s.call(func() error {
+		return s.sig.OnEvent(event)
+	})
+}
+
+func (srv *server) OnSignal(ctx context.Context, req *SignalRequest) (*FindingsResponse, error) {
+	s, err := srv.lookup(req.SignatureID)
+	if err != nil {
+		return nil, err
+	}
+	signal, ok := req.Signal.detect()
+	if !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown signal %s", req.Signal.Type)
+	}
+	return s.call(func() error {
+		return s.sig.OnSignal(signal)
+	})
+}
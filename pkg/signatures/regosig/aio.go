@@ -0,0 +1,323 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package regosig
+
+import (
+	"context"
+	"encoding/json"
+	"eolh/pkg/detect"
+	"eolh/pkg/logger"
+	"eolh/pkg/protocol"
+	"eolh/pkg/trace"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/rego"
+)
+
+const aioPackage string = "eolh_aio"
+const queryMatchAll string = "data." + aioPackage + ".match_all"
+const allEvents string = "*"
+
+// AIO evaluates many Rego signatures with a single prepared query per event.
+//
+// The generated match_all rule maps the ID of every matching signature to its eolh_match result,
+// its bodies are guarded by the selected event names so that most signatures are skipped
+// without being evaluated. The input is converted once per event, and without the raw ETW
+// event when no signature reads input.raw.
+type AIO struct {
+	cb             detect.SignatureHandler
+	getDataSource  func(namespace string, id string) (detect.DataSource, bool)
+	compiledRego   *ast.Compiler
+	matchAllPQ     rego.PreparedEvalQuery
+	signatures     map[string]aioSignature
+	selectedEvents []detect.SignatureEventSelector
+	needRaw        bool
+}
+
+type aioSignature struct {
+	metadata       detect.SignatureMetadata
+	selectedEvents []detect.SignatureEventSelector
+	source         string
+}
+
+func (sig *RegoSignature) toAIO() aioSignature {
+	return aioSignature{
+		metadata:       sig.metadata,
+		selectedEvents: sig.selectedEvents,
+		source:         sig.source,
+	}
+}
+
+// newAIO compiles the modules along with the match_all rule of the given signatures, keyed by package name
+func newAIO(opts Options, parsed map[string]*ast.Module, sigs map[string]*RegoSignature) (*AIO, error) {
+	var ids []string
+	byID := make(map[string]string, len(sigs))
+	pkgNames := make([]string, 0, len(sigs))
+	for pkgName := range sigs {
+		pkgNames = append(pkgNames, pkgName)
+	}
+	sort.Strings(pkgNames)
+	for _, pkgName := range pkgNames {
+		id := sigs[pkgName].metadata.ID
+		if other, ok := byID[id]; ok {
+			// results are keyed by ID, the first package keeps it
+			logger.Errorw("Skipping rego signature sharing its ID", "id", id, "package", pkgName, "source", sigs[pkgName].source, "kept", other)
+			continue
+		}
+		byID[id] = pkgName
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var code strings.Builder
+	fmt.Fprintf(&code, "package %s\n\n", aioPackage)
+	for _, id := range ids {
+		pkgName := byID[id]
+		quotedID, err := json.Marshal(id)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&code, "match_all[%s] := result {\n", quotedID)
+		if names := eventNames(sigs[pkgName].selectedEvents); len(names) > 0 {
+			quotedNames, err := json.Marshal(names)
+			if err != nil {
+				return nil, err
+			}
+			fmt.Fprintf(&code, "\t%s[_] == input.eventName\n", quotedNames)
+		}
+		fmt.Fprintf(&code, "\tresult := data.%s.eolh_match\n}\n\n", pkgName)
+	}
+	module, err := ast.ParseModule(aioPackage+".rego", code.String())
+	if err != nil {
+		return nil, err
+	}
+
+	modules := make(map[string]*ast.Module, len(parsed)+1)
+	for path, m := range parsed {
+		modules[path] = m.Copy()
+	}
+	modules[module.Package.Location.File] = module
+	compiler := ast.NewCompiler().WithBuiltins(Builtins)
+	compiler.Compile(modules)
+	if compiler.Failed() {
+		return nil, compiler.Errors
+	}
+
+	res := AIO{
+		compiledRego: compiler,
+		signatures:   make(map[string]aioSignature, len(sigs)),
+		needRaw:      readsRaw(parsed),
+	}
+	res.matchAllPQ, err = res.newRego(
+		rego.Target(opts.Target),
+		rego.Query(queryMatchAll),
+	).PrepareForEval(context.Background(), opts.prepareOptions()...)
+	if err != nil {
+		return nil, err
+	}
+	var selected []detect.SignatureEventSelector
+	for _, id := range ids {
+		sig := sigs[byID[id]]
+		res.signatures[id] = sig.toAIO()
+		selected = append(selected, sig.selectedEvents...)
+	}
+	res.selectedEvents = unionSelectors(selected)
+	return &res, nil
+}
+
+// eventNames returns the event names selected by a signature, or nil if it selects any event
+func eventNames(selectedEvents []detect.SignatureEventSelector) []string {
+	var names []string
+	for _, selectedEvent := range selectedEvents {
+		if selectedEvent.Name == "" || selectedEvent.Name == allEvents {
+			return nil
+		}
+		names = append(names, selectedEvent.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// unionSelectors merges selectors so that the engine dispatches any event at most once, origins are checked
+// against the results since a selector per origin would defeat this
+func unionSelectors(selectedEvents []detect.SignatureEventSelector) []detect.SignatureEventSelector {
+	names := make(map[string]map[string]bool)
+	for _, selectedEvent := range selectedEvents {
+		source := selectedEvent.Source
+		if source == "" {
+			continue
+		}
+		if names[source] == nil {
+			names[source] = make(map[string]bool)
+		}
+		name := selectedEvent.Name
+		if name == "" {
+			name = allEvents
+		}
+		names[source][name] = true
+	}
+	var res []detect.SignatureEventSelector
+	for source, sourceNames := range names {
+		if sourceNames[allEvents] {
+			res = append(res, detect.SignatureEventSelector{Source: source, Name: allEvents, Origin: allEvents})
+			continue
+		}
+		for name := range sourceNames {
+			res = append(res, detect.SignatureEventSelector{Source: source, Name: name, Origin: allEvents})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Source != res[j].Source {
+			return res[i].Source < res[j].Source
+		}
+		return res[i].Name < res[j].Name
+	})
+	return res
+}
+
+// readsRaw reports whether a module refers to the raw ETW event of the input
+func readsRaw(modules map[string]*ast.Module) bool {
+	raw := ast.MustParseRef("input.raw")
+	found := false
+	for _, module := range modules {
+		ast.WalkRefs(module, func(ref ast.Ref) bool {
+			if ref.HasPrefix(raw) || raw.HasPrefix(ref) {
+				found = true
+			}
+			return found
+		})
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+// selects reports whether one of the selectors matches the event, the same way as the engine does
+func selects(selectedEvents []detect.SignatureEventSelector, event protocol.Event) bool {
+	for _, selectedEvent := range selectedEvents {
+		if matchSelector(selectedEvent.Source, event.Headers.Selector.Source) &&
+			matchSelector(selectedEvent.Name, event.Headers.Selector.Name) &&
+			matchSelector(selectedEvent.Origin, event.Headers.Selector.Origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchSelector(selected string, value string) bool {
+	return selected == "" || selected == allEvents || selected == value
+}
+
+// newRego creates a query evaluator over the signature modules and the eolh builtins
+func (sig *AIO) newRego(options ...func(*rego.Rego)) *rego.Rego {
+	return rego.New(append([]func(*rego.Rego){
+		rego.Compiler(sig.compiledRego),
+		rego.Function3(datasourceFunction, sig.datasource),
+	}, options...)...)
+}
+
+func (sig *AIO) datasource(bctx rego.BuiltinContext, namespace, id, key *ast.Term) (*ast.Term, error) {
+	return evalDatasource(sig.getDataSource, namespace, id, key)
+}
+
+func (sig *AIO) Init(ctx detect.SignatureContext) error {
+	sig.cb = ctx.Callback
+	sig.getDataSource = ctx.GetDataSource
+	return nil
+}
+
+func (sig *AIO) GetMetadata() (detect.SignatureMetadata, error) {
+	return detect.SignatureMetadata{
+		ID:          "EOLH-REGO-AIO",
+		Version:     "1",
+		Name:        "Rego signatures",
+		Description: fmt.Sprintf("%d Rego signatures evaluated together.", len(sig.signatures)),
+	}, nil
+}
+
+func (sig *AIO) GetSelectedEvents() ([]detect.SignatureEventSelector, error) {
+	return sig.selectedEvents, nil
+}
+
+// Signatures returns the metadata of the aggregated signatures, sorted by ID
+func (sig *AIO) Signatures() []detect.SignatureMetadata {
+	res := make([]detect.SignatureMetadata, 0, len(sig.signatures))
+	for _, s := range sig.signatures {
+		res = append(res, s.metadata)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].ID < res[j].ID
+	})
+	return res
+}
+
+// SelectedEventsOf returns the events selected by one of the aggregated signatures
+func (sig *AIO) SelectedEventsOf(id string) []detect.SignatureEventSelector {
+	return sig.signatures[id].selectedEvents
+}
+
+func (sig *AIO) OnEvent(event protocol.Event) error {
+	ee, ok := event.Payload.(trace.Event)
+	if !ok {
+		return fmt.Errorf("failed to cast event's payload")
+	}
+	if !sig.needRaw {
+		ee.RawEvent = trace.RawEvent{}
+	}
+	input, err := ast.InterfaceToValue(ee)
+	if err != nil {
+		return fmt.Errorf("converting input: %w", err)
+	}
+	results, err := sig.matchAllPQ.Eval(context.TODO(), rego.EvalParsedInput(input))
+	if err != nil {
+		return fmt.Errorf("evaluating rego: %w", err)
+	}
+	if len(results) == 0 || len(results[0].Expressions) == 0 {
+		return nil
+	}
+	matches, ok := results[0].Expressions[0].Value.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	ids := make([]string, 0, len(matches))
+	for id := range matches {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		s, ok := sig.signatures[id]
+		if !ok || !selects(s.selectedEvents, event) {
+			continue
+		}
+		switch v := matches[id].(type) {
+		case bool:
+			if v {
+				sig.cb(detect.Finding{
+					Data:        nil,
+					Event:       event,
+					SigMetadata: s.metadata,
+				})
+			}
+		case map[string]interface{}:
+			sig.cb(detect.Finding{
+				Data:        v,
+				Event:       event,
+				SigMetadata: s.metadata,
+			})
+		}
+	}
+	return nil
+}
+
+func (sig *AIO) OnSignal(signal detect.Signal) error {
+	return nil
+}
+
+func (sig *AIO) Close() {}
@@ -0,0 +1,175 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package regosig
+
+import (
+	"eolh/pkg/detect"
+	"eolh/pkg/protocol"
+	"eolh/pkg/trace"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/open-policy-agent/opa/compile"
+)
+
+// rule returns a signature matching every event it selects, with the given body
+func rule(pkgName, id, eventName, body string) string {
+	return fmt.Sprintf(`package %s
+
+__rego_metadoc__ := {"id": %q, "name": %q, "eventName": %q}
+
+eolh_selected_events := [{"source": "eolh", "name": %q}]
+
+eolh_match {
+	%s
+}
+`, pkgName, id, pkgName, pkgName, eventName, body)
+}
+
+func newAIOSignature(t *testing.T, modules map[string]string) *AIO {
+	t.Helper()
+	sigs, err := NewRegoSignatures(Options{Target: compile.TargetRego, AIO: true}, modules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sigs) != 1 {
+		t.Fatalf("got %d signatures, want the AIO one", len(sigs))
+	}
+	aio, ok := sigs[0].(*AIO)
+	if !ok {
+		t.Fatalf("got %T, want *AIO", sigs[0])
+	}
+	return aio
+}
+
+// matches returns the IDs of the signatures matching the event, in the order they were reported
+func matches(t *testing.T, sig detect.Signature, event protocol.Event) []string {
+	t.Helper()
+	var ids []string
+	err := sig.Init(detect.SignatureContext{Callback: func(f detect.Finding) {
+		ids = append(ids, f.SigMetadata.ID)
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sig.OnEvent(event); err != nil {
+		t.Fatal(err)
+	}
+	return ids
+}
+
+func rawEvent(eventName string) protocol.Event {
+	var raw trace.RawEvent
+	raw.EventData = map[string]interface{}{"Image": `C:\Windows\System32\cmd.exe`}
+	return trace.Event{EventName: eventName, RawEvent: raw}.ToProtocol()
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestAIOSkipsDuplicateIDs(t *testing.T) {
+	aio := newAIOSignature(t, map[string]string{
+		"a.rego": rule("a", "TEST-1", "process_start", "true"),
+		"b.rego": rule("b", "TEST-1", "process_start", "true"),
+		"c.rego": rule("c", "TEST-2", "process_start", "true"),
+	})
+	sigs := aio.Signatures()
+	if len(sigs) != 2 || sigs[0].ID != "TEST-1" || sigs[0].Name != "a" || sigs[1].ID != "TEST-2" {
+		t.Errorf("signatures = %+v, want a as TEST-1 and c as TEST-2", sigs)
+	}
+	if selected := aio.SelectedEventsOf("TEST-2"); len(selected) != 1 || selected[0].Name != "process_start" {
+		t.Errorf("events selected by TEST-2 = %+v, want process_start", selected)
+	}
+	if ids := matches(t, aio, rawEvent("process_start")); !equal(ids, []string{"TEST-1", "TEST-2"}) {
+		t.Errorf("matches = %v, want TEST-1 reported once", ids)
+	}
+}
+
+func TestAIORoutesByEventName(t *testing.T) {
+	aio := newAIOSignature(t, map[string]string{
+		"a.rego": rule("a", "TEST-1", "process_start", "true"),
+		"b.rego": rule("b", "TEST-2", "file_write", "true"),
+		"c.rego": rule("c", "TEST-3", "*", "true"),
+	})
+	selected, err := aio.GetSelectedEvents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(selected) != 1 || selected[0].Name != "*" {
+		t.Errorf("selected events = %+v, want a single selector for any event", selected)
+	}
+	tests := []struct {
+		eventName string
+		want      []string
+	}{
+		{eventName: "process_start", want: []string{"TEST-1", "TEST-3"}},
+		{eventName: "file_write", want: []string{"TEST-2", "TEST-3"}},
+		{eventName: "dns_query", want: []string{"TEST-3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.eventName, func(t *testing.T) {
+			if ids := matches(t, aio, rawEvent(tt.eventName)); !equal(ids, tt.want) {
+				t.Errorf("matches = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestRawEventStripping(t *testing.T) {
+	reads := rule("reads", "TEST-1", "process_start", `input.raw.EventData.Image`)
+	ignores := rule("ignores", "TEST-2", "process_start", `input.eventName == "process_start"`)
+	tests := []struct {
+		name    string
+		modules map[string]string
+		needRaw bool
+	}{
+		{name: "stripped", modules: map[string]string{"ignores.rego": ignores}},
+		// the raw event is kept for every signature as soon as one reads it
+		{name: "kept", modules: map[string]string{"reads.rego": reads, "ignores.rego": ignores}, needRaw: true},
+	}
+	for _, tt := range tests {
+		want := []string{"TEST-2"}
+		if tt.needRaw {
+			want = []string{"TEST-1", "TEST-2"}
+		}
+		t.Run("aio/"+tt.name, func(t *testing.T) {
+			aio := newAIOSignature(t, tt.modules)
+			if aio.needRaw != tt.needRaw {
+				t.Errorf("needRaw = %v, want %v", aio.needRaw, tt.needRaw)
+			}
+			if ids := matches(t, aio, rawEvent("process_start")); !equal(ids, want) {
+				t.Errorf("matches = %v, want %v", ids, want)
+			}
+		})
+		t.Run("signature/"+tt.name, func(t *testing.T) {
+			sigs, err := NewRegoSignatures(Options{Target: compile.TargetRego}, tt.modules)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, sig := range sigs {
+				if needRaw := sig.(*RegoSignature).needRaw; needRaw != tt.needRaw {
+					t.Errorf("needRaw = %v, want %v", needRaw, tt.needRaw)
+				}
+				ids = append(ids, matches(t, sig, rawEvent("process_start"))...)
+			}
+			sort.Strings(ids)
+			if !equal(ids, want) {
+				t.Errorf("matches = %v, want %v", ids, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package regosig
+
+import (
+	"eolh/pkg/detect"
+	"errors"
+	"fmt"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/open-policy-agent/opa/types"
+)
+
+// datasourceFunction lets rules query the engine data sources, e.g. eolh.datasource("eolh", "containers", input.containerId)
+var datasourceFunction = &rego.Function{
+	Name:             "eolh.datasource",
+	Decl:             types.NewFunction(types.Args(types.S, types.S, types.A), types.A),
+	Nondeterministic: true,
+}
+
+// WasmAvailable tells whether eolh was built with the wasm evaluation target, see the opa_wasm build tag
+var WasmAvailable = false
+
+// Builtins are the custom functions available to Rego signatures, modules must be compiled with them
+var Builtins = map[string]*ast.Builtin{
+	datasourceFunction.Name: {
+		Name:             datasourceFunction.Name,
+		Decl:             datasourceFunction.Decl,
+		Nondeterministic: datasourceFunction.Nondeterministic,
+	},
+}
+
+func (sig *RegoSignature) datasource(bctx rego.BuiltinContext, namespace, id, key *ast.Term) (*ast.Term, error) {
+	return evalDatasource(sig.getDataSource, namespace, id, key)
+}
+
+// evalDatasource implements eolh.datasource, an undefined result means the data source or the key was not found
+func evalDatasource(getDataSource func(namespace string, id string) (detect.DataSource, bool), namespace, id, key *ast.Term) (*ast.Term, error) {
+	var ns, dsID string
+	if err := ast.As(namespace.Value, &ns); err != nil {
+		return nil, fmt.Errorf("invalid data source namespace: %w", err)
+	}
+	if err := ast.As(id.Value, &dsID); err != nil {
+		return nil, fmt.Errorf("invalid data source id: %w", err)
+	}
+	if getDataSource == nil {
+		return nil, nil
+	}
+	ds, ok := getDataSource(ns, dsID)
+	if !ok {
+		return nil, nil
+	}
+	k, err := ast.JSON(key.Value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid data source key: %w", err)
+	}
+	result, err := ds.Get(k)
+	if errors.Is(err, detect.ErrDataNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	value, err := ast.InterfaceToValue(result)
+	if err != nil {
+		return nil, err
+	}
+	return ast.NewTerm(value), nil
+}
+
+// builtinCall locates the first call of a module to the eolh builtins, which the wasm target can't evaluate,
+// it returns nil if there is none
+func builtinCall(module *ast.Module) *ast.Location {
+	var location *ast.Location
+	ast.WalkRefs(module, func(ref ast.Ref) bool {
+		if _, ok := Builtins[ref.String()]; ok {
+			location = ref[0].Location
+		}
+		return location != nil
+	})
+	return location
+}
+
+// compileModules compiles rego modules, keyed by their name, with the eolh builtins
+func compileModules(modules map[string]string) (*ast.Compiler, error) {
+	parsed := make(map[string]*ast.Module, len(modules))
+	for name, code := range modules {
+		module, err := ast.ParseModule(name, code)
+		if err != nil {
+			return nil, err
+		}
+		parsed[name] = module
+	}
+	compiler := ast.NewCompiler().WithBuiltins(Builtins)
+	compiler.Compile(parsed)
+	if compiler.Failed() {
+		return nil, compiler.Errors
+	}
+	return compiler, nil
+}
@@ -0,0 +1,132 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package regosig
+
+import (
+	"eolh/pkg/detect"
+	"eolh/pkg/trace"
+	"errors"
+	"testing"
+
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/compile"
+)
+
+// fakeDataSource maps process names to their images
+type fakeDataSource map[string]string
+
+func (ds fakeDataSource) Get(key interface{}) (map[string]interface{}, error) {
+	name, ok := key.(string)
+	if !ok {
+		return nil, detect.ErrKeyNotSupported
+	}
+	image, ok := ds[name]
+	if !ok {
+		return nil, detect.ErrDataNotFound
+	}
+	return map[string]interface{}{"image": image}, nil
+}
+
+func (ds fakeDataSource) Version() uint     { return 1 }
+func (ds fakeDataSource) Keys() []string    { return []string{"string"} }
+func (ds fakeDataSource) Schema() string    { return `{"type": "object"}` }
+func (ds fakeDataSource) Namespace() string { return "test" }
+func (ds fakeDataSource) ID() string        { return "images" }
+
+// datasourceRule first queries a data source which doesn't exist, then falls back to the images
+const datasourceRule = `package eolh.TEST_DATASOURCE
+
+__rego_metadoc__ := {"id": "TEST-DATASOURCE", "name": "datasource", "eventName": "datasource"}
+
+eolh_selected_events := [{"source": "eolh", "name": "process_start"}]
+
+eolh_match := {"image": info.image} {
+	info := eolh.datasource("test", input.processName, input.processName)
+} else := {"image": info.image} {
+	info := eolh.datasource("test", "images", input.processName)
+}
+`
+
+func TestDatasourceBuiltin(t *testing.T) {
+	sig, err := NewRegoSignature(compile.TargetRego, datasourceRule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var findings []detect.Finding
+	err = sig.Init(detect.SignatureContext{
+		Callback: func(f detect.Finding) { findings = append(findings, f) },
+		GetDataSource: func(namespace, id string) (detect.DataSource, bool) {
+			ds := fakeDataSource{"cmd.exe": `C:\Windows\System32\cmd.exe`}
+			if namespace != ds.Namespace() || id != ds.ID() {
+				return nil, false
+			}
+			return ds, true
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		processName string
+		image       string
+	}{
+		{name: "found", processName: "cmd.exe", image: `C:\Windows\System32\cmd.exe`},
+		{name: "key not found", processName: "notepad.exe"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			findings = nil
+			event := trace.Event{EventName: "process_start", ProcessName: tt.processName}.ToProtocol()
+			if err := sig.OnEvent(event); err != nil {
+				t.Fatal(err)
+			}
+			if tt.image == "" {
+				if len(findings) != 0 {
+					t.Errorf("findings = %+v, want none", findings)
+				}
+				return
+			}
+			if len(findings) != 1 || findings[0].Data["image"] != tt.image {
+				t.Errorf("findings = %+v, want one with image %q", findings, tt.image)
+			}
+		})
+	}
+}
+
+func TestDatasourceBuiltinWithoutDataSources(t *testing.T) {
+	sig, err := NewRegoSignature(compile.TargetRego, datasourceRule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var findings []detect.Finding
+	if err := sig.Init(detect.SignatureContext{Callback: func(f detect.Finding) { findings = append(findings, f) }}); err != nil {
+		t.Fatal(err)
+	}
+	event := trace.Event{EventName: "process_start", ProcessName: "cmd.exe"}.ToProtocol()
+	if err := sig.OnEvent(event); err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 0 {
+		t.Errorf("findings = %+v, want none", findings)
+	}
+}
+
+func TestWasmTargetRejectsBuiltinCalls(t *testing.T) {
+	_, err := NewRegoSignatures(Options{Target: compile.TargetWasm}, map[string]string{
+		"datasource.rego": datasourceRule,
+		"plain.rego":      rule("plain", "TEST-PLAIN", "process_start", "true"),
+	})
+	var astErrors ast.Errors
+	if !errors.As(err, &astErrors) {
+		t.Fatalf("error = %v, want compilation errors", err)
+	}
+	// the errors locate the module calling the builtins, so that it alone is left out
+	if len(astErrors) != 1 || astErrors[0].Location == nil || astErrors[0].Location.File != "datasource.rego" {
+		t.Errorf("errors = %v, want one locating datasource.rego", astErrors)
+	}
+}
@@ -15,30 +15,59 @@ import (
 	"eolh/pkg/detect"
 	"eolh/pkg/protocol"
 	"eolh/pkg/trace"
+	"errors"
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/compile"
 	"github.com/open-policy-agent/opa/rego"
 )
 
+// RegoSignature is a detect.Signature written in Rego.
+//
+// Besides the mandatory eolh_match rule, a signature may define:
+//   - eolh_observe: evaluated like eolh_match, but its results are buffered instead of reported
+//   - eolh_on_signal: evaluated on every lifecycle signal with input.signal describing the signal
+//     and input.observations holding the buffered eolh_observe results. Its results are reported
+//     like eolh_match ones, and the buffer is cleared whenever it reports something.
+//
+// Together they allow rules aggregating over time, e.g. summaries on shutdown or timed-out sequences.
 type RegoSignature struct {
 	cb             detect.SignatureHandler
 	compiledRego   *ast.Compiler
 	matchPQ        rego.PreparedEvalQuery
+	observePQ      *rego.PreparedEvalQuery
+	onSignalPQ     *rego.PreparedEvalQuery
+	observations   []observation
+	source         string
+	getDataSource  func(namespace string, id string) (detect.DataSource, bool)
 	metadata       detect.SignatureMetadata
 	selectedEvents []detect.SignatureEventSelector
+	needRaw        bool
+}
+
+type observation struct {
+	Data  interface{}    `json:"data"`
+	Event protocol.Event `json:"-"`
+	Input trace.Event    `json:"event"`
 }
 
 const queryMatch string = "data.%s.eolh_match"
+const queryObserve string = "data.%s.eolh_observe"
+const queryOnSignal string = "data.%s.eolh_on_signal"
 const querySelectedEvents string = "data.%s.eolh_selected_events"
 const queryMetadata string = "data.%s.__rego_metadoc__"
+const metadataRule string = "__rego_metadoc__"
 const packageNameRegex string = `package\s.*`
 
+// maxObservations bounds the eolh_observe results buffered between two reports
+const maxObservations = 1024
+
 func NewRegoSignature(target string, regoCodes ...string) (detect.Signature, error) {
-	var err error
-	res := RegoSignature{}
 	regoMap := make(map[string]string)
 	re := regexp.MustCompile(packageNameRegex)
 
@@ -53,19 +82,182 @@ func NewRegoSignature(target string, regoCodes ...string) (detect.Signature, err
 		pkgName = regoModuleName
 		regoMap[regoModuleName] = regoCode
 	}
-	res.compiledRego, err = ast.CompileModules(regoMap)
+	compiledRego, err := compileModules(regoMap)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := newRegoSignature(Options{Target: target}, compiledRego, pkgName)
+	if err != nil {
+		return nil, err
+	}
+	return sig, nil
+}
+
+// Options configures how Rego signatures are prepared for evaluation
+type Options struct {
+	// Target is the evaluation target, compile.TargetRego or compile.TargetWasm
+	Target string
+	// PartialEval partially evaluates the queries against the signature modules when preparing them
+	PartialEval bool
+	// AIO evaluates the signatures which don't buffer observations with a single query, see AIO
+	AIO bool
+	// Select leaves out the signatures it returns false for, before they are aggregated. All signatures are kept when nil.
+	Select func(detect.SignatureMetadata) bool
+}
+
+func (opts Options) selects(metadata detect.SignatureMetadata) bool {
+	return opts.Select == nil || opts.Select(metadata)
+}
+
+func (opts Options) prepareOptions() []rego.PrepareOption {
+	if opts.PartialEval {
+		return []rego.PrepareOption{rego.WithPartialEval()}
+	}
+	return nil
+}
+
+// NewRegoSignatures compiles rego modules, keyed by file path, with a single compiler so that they can import
+// each other. Every package declaring __rego_metadoc__ becomes a signature, the others are libraries.
+// Compilation errors are returned as ast.Errors, locating the faulty file and line. Otherwise, the signatures which
+// could be created are returned along with the errors of the others.
+func NewRegoSignatures(opts Options, modules map[string]string) ([]detect.Signature, error) {
+	parsed := make(map[string]*ast.Module, len(modules))
+	var parseErrors ast.Errors
+	for path, code := range modules {
+		module, err := ast.ParseModule(path, code)
+		if err != nil {
+			var astErrors ast.Errors
+			if errors.As(err, &astErrors) {
+				parseErrors = append(parseErrors, astErrors...)
+				continue
+			}
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		parsed[path] = module
+	}
+	if len(parseErrors) > 0 {
+		return nil, parseErrors
+	}
+	if opts.Target == compile.TargetWasm {
+		// reported as compilation errors, so that only the modules calling the builtins are left out
+		var wasmErrors ast.Errors
+		for _, path := range sortedKeys(parsed) {
+			if location := builtinCall(parsed[path]); location != nil {
+				wasmErrors = append(wasmErrors, ast.NewError(ast.CompileErr, location, "the eolh builtins are not available to the wasm target"))
+			}
+		}
+		if len(wasmErrors) > 0 {
+			return nil, wasmErrors
+		}
+	}
+	compiler := ast.NewCompiler().WithBuiltins(Builtins)
+	compiler.Compile(parsed)
+	if compiler.Failed() {
+		return nil, compiler.Errors
+	}
+
+	var sigs []detect.Signature
+	var errs []error
+	aggregated := make(map[string]*RegoSignature)
+	seen := make(map[string]bool)
+	for _, path := range sortedKeys(parsed) {
+		module := parsed[path]
+		pkgName := strings.TrimPrefix(module.Package.Path.String(), "data.")
+		if seen[pkgName] || !declaresMetadata(module) {
+			continue
+		}
+		seen[pkgName] = true
+		if opts.AIO && !buffersObservations(compiler, pkgName) {
+			sig, err := describeRegoSignature(compiler, pkgName)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: creating signature %s: %w", path, pkgName, err))
+				continue
+			}
+			if !opts.selects(sig.metadata) {
+				continue
+			}
+			sig.source = path
+			aggregated[pkgName] = sig
+			continue
+		}
+		sig, err := newRegoSignature(opts, compiler, pkgName)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: creating signature %s: %w", path, pkgName, err))
+			continue
+		}
+		if !opts.selects(sig.metadata) {
+			continue
+		}
+		sig.source = path
+		sigs = append(sigs, sig)
+	}
+	if len(aggregated) > 0 {
+		aio, err := newAIO(opts, parsed, aggregated)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("aggregating rego signatures: %w", err))
+		} else {
+			sigs = append(sigs, aio)
+		}
+	}
+	return sigs, errors.Join(errs...)
+}
+
+// buffersObservations reports whether a signature defines eolh_observe or eolh_on_signal, which AIO doesn't support
+func buffersObservations(compiler *ast.Compiler, pkgName string) bool {
+	for _, query := range []string{queryObserve, queryOnSignal} {
+		if len(compiler.GetRulesExact(ast.MustParseRef(fmt.Sprintf(query, pkgName)))) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func declaresMetadata(module *ast.Module) bool {
+	for _, rule := range module.Rules {
+		if rule.Head.Ref().String() == metadataRule {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(m map[string]*ast.Module) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func newRegoSignature(opts Options, compiledRego *ast.Compiler, pkgName string) (*RegoSignature, error) {
+	res, err := describeRegoSignature(compiledRego, pkgName)
 	if err != nil {
 		return nil, err
 	}
-	ctx := context.Background()
-	res.matchPQ, err = rego.New(
-		rego.Target(target),
-		rego.Compiler(res.compiledRego),
+	res.needRaw = readsRaw(compiledRego.Modules)
+	res.matchPQ, err = res.newRego(
+		rego.Target(opts.Target),
 		rego.Query(fmt.Sprintf(queryMatch, pkgName)),
-	).PrepareForEval(ctx)
+	).PrepareForEval(context.Background(), opts.prepareOptions()...)
 	if err != nil {
 		return nil, err
 	}
+	res.observePQ, err = res.prepareOptional(opts, queryObserve, pkgName)
+	if err != nil {
+		return nil, err
+	}
+	res.onSignalPQ, err = res.prepareOptional(opts, queryOnSignal, pkgName)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// describeRegoSignature reads the metadata and the selected events of a signature, without preparing its queries
+func describeRegoSignature(compiledRego *ast.Compiler, pkgName string) (*RegoSignature, error) {
+	var err error
+	res := RegoSignature{compiledRego: compiledRego}
 	res.metadata, err = res.getMetadata(pkgName)
 	if err != nil {
 		return nil, err
@@ -77,8 +269,33 @@ func NewRegoSignature(target string, regoCodes ...string) (detect.Signature, err
 	return &res, nil
 }
 
+// prepareOptional prepares the query of a rule the signature may not define
+func (sig *RegoSignature) prepareOptional(opts Options, query string, pkgName string) (*rego.PreparedEvalQuery, error) {
+	ref := ast.MustParseRef(fmt.Sprintf(query, pkgName))
+	if len(sig.compiledRego.GetRulesExact(ref)) == 0 {
+		return nil, nil
+	}
+	pq, err := sig.newRego(
+		rego.Target(opts.Target),
+		rego.Query(ref.String()),
+	).PrepareForEval(context.Background(), opts.prepareOptions()...)
+	if err != nil {
+		return nil, err
+	}
+	return &pq, nil
+}
+
+// newRego creates a query evaluator over the signature modules and the eolh builtins
+func (sig *RegoSignature) newRego(options ...func(*rego.Rego)) *rego.Rego {
+	return rego.New(append([]func(*rego.Rego){
+		rego.Compiler(sig.compiledRego),
+		rego.Function3(datasourceFunction, sig.datasource),
+	}, options...)...)
+}
+
 func (sig *RegoSignature) Init(ctx detect.SignatureContext) error {
 	sig.cb = ctx.Callback
+	sig.getDataSource = ctx.GetDataSource
 	return nil
 }
 
@@ -86,6 +303,11 @@ func (sig *RegoSignature) GetMetadata() (detect.SignatureMetadata, error) {
 	return sig.metadata, nil
 }
 
+// Source returns the file the signature was loaded from, if any
+func (sig *RegoSignature) Source() string {
+	return sig.source
+}
+
 func (sig *RegoSignature) getMetadata(pkgName string) (detect.SignatureMetadata, error) {
 	evalRes, err := sig.evalQuery(fmt.Sprintf(queryMetadata, pkgName))
 	if err != nil {
@@ -106,14 +328,84 @@ func (sig *RegoSignature) getMetadata(pkgName string) (detect.SignatureMetadata,
 }
 
 func (sig *RegoSignature) OnSignal(signal detect.Signal) error {
-	return fmt.Errorf("function OnSignal is not implemented")
+	if sig.onSignalPQ == nil {
+		return nil
+	}
+	signalInput, cause := signalToInput(signal)
+	if signalInput == nil {
+		return nil
+	}
+	if len(sig.observations) > 0 {
+		cause = sig.observations[len(sig.observations)-1].Event
+	}
+	observations := sig.observations
+	if observations == nil {
+		observations = []observation{}
+	}
+	input := map[string]interface{}{
+		"signal":       signalInput,
+		"observations": observations,
+	}
+	results, err := sig.onSignalPQ.Eval(context.TODO(), rego.EvalInput(input))
+	if err != nil {
+		return fmt.Errorf("evaluating rego: %w", err)
+	}
+	if sig.report(results, cause) {
+		sig.observations = nil
+	}
+	return nil
+}
+
+// signalToInput converts a signal into the input.signal document of eolh_on_signal,
+// along with a synthetic causal event for the findings it may produce
+func signalToInput(signal detect.Signal) (map[string]interface{}, protocol.Event) {
+	now := time.Now()
+	var input map[string]interface{}
+	var event trace.Event
+	switch s := signal.(type) {
+	case detect.SignalTick:
+		now = time.Time(s)
+		input = map[string]interface{}{"type": "tick"}
+	case detect.SignalShutdown:
+		input = map[string]interface{}{"type": "shutdown"}
+	case detect.SignalSourceComplete:
+		input = map[string]interface{}{"type": "source_complete", "source": string(s)}
+	case detect.SignalContainerStart:
+		now = s.Timestamp
+		input = containerSignalToInput("container_start", detect.SignalContainer(s), &event)
+	case detect.SignalContainerStop:
+		now = s.Timestamp
+		input = containerSignalToInput("container_stop", detect.SignalContainer(s), &event)
+	default:
+		return nil, protocol.Event{}
+	}
+	input["time"] = now.Format(time.RFC3339Nano)
+	event.Timestamp = now
+	return input, event.ToProtocol()
+}
+
+func containerSignalToInput(signalType string, container detect.SignalContainer, event *trace.Event) map[string]interface{} {
+	event.ContainerID = container.ContainerID
+	event.Container = trace.Container{
+		ID:        container.ContainerID,
+		Name:      container.Name,
+		ImageName: container.Image,
+	}
+	event.Kubernetes = trace.Kubernetes{
+		PodName:      container.PodName,
+		PodNamespace: container.PodNamespace,
+	}
+	return map[string]interface{}{
+		"type":       signalType,
+		"container":  event.Container,
+		"kubernetes": event.Kubernetes,
+	}
 }
 
 func (sig *RegoSignature) Close() {}
 
 func (sig *RegoSignature) evalQuery(query string) (interface{}, error) {
-	pq, err := rego.New(
-		rego.Compiler(sig.compiledRego),
+	pq, err := sig.newRego(
 		rego.Query(query),
 	).PrepareForEval(context.TODO())
 	if err != nil {
@@ -152,12 +444,37 @@ func (sig *RegoSignature) getSelectedEvents(pkgName string) ([]detect.SignatureE
 }
 
 func (sig *RegoSignature) OnEvent(event protocol.Event) error {
-	input := rego.EvalInput(event.Payload.(trace.Event))
+	ee, ok := event.Payload.(trace.Event)
+	if !ok {
+		return fmt.Errorf("failed to cast event's payload")
+	}
+	// like AIO, the raw ETW event is only converted for the signatures reading it
+	if !sig.needRaw {
+		ee.RawEvent = trace.RawEvent{}
+	}
+	value, err := ast.InterfaceToValue(ee)
+	if err != nil {
+		return fmt.Errorf("converting input: %w", err)
+	}
+	input := rego.EvalParsedInput(value)
 	results, err := sig.matchPQ.Eval(context.TODO(), input)
 	if err != nil {
 		return fmt.Errorf("evaluating rego: %w", err)
 	}
+	sig.report(results, event)
+
+	if sig.observePQ != nil {
+		results, err = sig.observePQ.Eval(context.TODO(), input)
+		if err != nil {
+			return fmt.Errorf("evaluating rego: %w", err)
+		}
+		sig.observe(results, event)
+	}
+	return nil
+}
 
+// report calls the signature callback when the results of a query are truthy, it returns whether a finding was reported
+func (sig *RegoSignature) report(results rego.ResultSet, event protocol.Event) bool {
 	if len(results) > 0 && len(results[0].Expressions) > 0 && results[0].Expressions[0].Value != nil {
 		switch v := results[0].Expressions[0].Value.(type) {
 		case bool:
@@ -167,6 +484,7 @@ func (sig *RegoSignature) OnEvent(event protocol.Event) error {
 					Event:       event,
 					SigMetadata: sig.metadata,
 				})
+				return true
 			}
 		case map[string]interface{}:
 			sig.cb(detect.Finding{
@@ -174,7 +492,28 @@ func (sig *RegoSignature) OnEvent(event protocol.Event) error {
 				Event:       event,
 				SigMetadata: sig.metadata,
 			})
+			return true
 		}
 	}
-	return nil
+	return false
+}
+
+// observe buffers truthy eolh_observe results for eolh_on_signal
+func (sig *RegoSignature) observe(results rego.ResultSet, event protocol.Event) {
+	if len(results) == 0 || len(results[0].Expressions) == 0 {
+		return
+	}
+	value := results[0].Expressions[0].Value
+	if v, ok := value.(bool); value == nil || ok && !v {
+		return
+	}
+	if len(sig.observations) >= maxObservations {
+		sig.observations = sig.observations[1:]
+	}
+	input, _ := event.Payload.(trace.Event)
+	sig.observations = append(sig.observations, observation{
+		Data:  value,
+		Event: event,
+		Input: input,
+	})
 }
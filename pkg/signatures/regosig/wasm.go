@@ -0,0 +1,15 @@
+//go:build opa_wasm
+
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package regosig
+
+// The wasm evaluation target is only available in builds tagged opa_wasm
+import _ "github.com/open-policy-agent/opa/features/wasm"
+
+func init() {
+	WasmAvailable = true
+}
@@ -0,0 +1,17 @@
+# Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+# Licensed under Apache License 2.0, see LICENCE.
+
+package eolh.helpers
+
+# get_arg returns the value of an event argument
+get_arg(name) := arg.value {
+	arg := input.args[_]
+	arg.name == name
+}
+
+# image_name returns the lowercase file name of the ImageName argument, e.g. cmd.exe
+image_name := name {
+	path := lower(get_arg("ImageName"))
+	parts := split(path, "\\")
+	name := parts[count(parts) - 1]
+}
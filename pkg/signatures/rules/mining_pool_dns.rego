@@ -0,0 +1,46 @@
+# Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+# Licensed under Apache License 2.0, see LICENCE.
+
+package eolh.EOLH_REGO_3
+
+import data.eolh.helpers
+
+__rego_metadoc__ := {
+	"id": "EOLH-REGO-3",
+	"version": "1",
+	"name": "DNS Query for a Mining Pool",
+	"eventName": "mining_pool_dns",
+	"description": "A process resolved the domain of a cryptocurrency mining pool, which miners do whatever their command line.",
+	"tags": ["impact"],
+	"properties": {"Severity": 3},
+}
+
+eolh_selected_events[{"source": "eolh", "name": "dns_request"}]
+
+pools := {
+	"minexmr.com",
+	"moneroocean.stream",
+	"nanopool.org",
+	"supportxmr.com",
+	"hashvault.pro",
+	"2miners.com",
+	"f2pool.com",
+	"nicehash.com",
+	"herominers.com",
+	"unmineable.com",
+}
+
+eolh_match := {"query": query} {
+	input.eventName == "dns_request"
+	query := lower(trim_suffix(helpers.get_arg("QueryName"), "."))
+	pool := pools[_]
+	matches_domain(query, pool)
+}
+
+matches_domain(query, domain) {
+	query == domain
+}
+
+matches_domain(query, domain) {
+	endswith(query, concat("", [".", domain]))
+}
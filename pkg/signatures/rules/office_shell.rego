@@ -0,0 +1,28 @@
+# Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+# Licensed under Apache License 2.0, see LICENCE.
+
+package eolh.EOLH_REGO_1
+
+import data.eolh.helpers
+
+__rego_metadoc__ := {
+	"id": "EOLH-REGO-1",
+	"version": "1",
+	"name": "Office Application Spawned a Shell",
+	"eventName": "office_spawned_shell",
+	"description": "An Office application started a shell or a script host, as macro based droppers do.",
+	"tags": ["execution", "initial-access"],
+	"properties": {"Severity": 3},
+}
+
+eolh_selected_events[{"source": "eolh", "name": "process_start"}]
+
+office := {"winword.exe", "excel.exe", "powerpnt.exe", "outlook.exe", "msaccess.exe", "mspub.exe"}
+
+shells := {"cmd.exe", "powershell.exe", "pwsh.exe", "wscript.exe", "cscript.exe", "mshta.exe", "rundll32.exe", "regsvr32.exe"}
+
+eolh_match := {"parent": input.processName, "child": helpers.image_name} {
+	input.eventName == "process_start"
+	office[lower(input.processName)]
+	shells[helpers.image_name]
+}
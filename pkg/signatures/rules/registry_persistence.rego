@@ -0,0 +1,40 @@
+# Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+# Licensed under Apache License 2.0, see LICENCE.
+
+package eolh.EOLH_REGO_4
+
+import data.eolh.helpers
+
+__rego_metadoc__ := {
+	"id": "EOLH-REGO-4",
+	"version": "1",
+	"name": "Registry Persistence",
+	"eventName": "registry_persistence",
+	"description": "A value was set under a Run key or in the configuration of a service, which starts programs at logon or boot.",
+	"tags": ["persistence"],
+	"properties": {"Severity": 3},
+}
+
+eolh_selected_events[{"source": "eolh", "name": "registry_set_value"}]
+
+autostart_keys := {
+	"\\software\\microsoft\\windows\\currentversion\\run\\",
+	"\\software\\microsoft\\windows\\currentversion\\runonce\\",
+	"\\software\\wow6432node\\microsoft\\windows\\currentversion\\run\\",
+	"\\software\\microsoft\\windows nt\\currentversion\\winlogon\\",
+}
+
+service_values := {"imagepath", "servicedll"}
+
+eolh_match := {"target": target} {
+	input.eventName == "registry_set_value"
+	target := helpers.get_arg("target_object")
+	contains(lower(target), autostart_keys[_])
+}
+
+eolh_match := {"target": target} {
+	input.eventName == "registry_set_value"
+	target := helpers.get_arg("target_object")
+	startswith(lower(target), "hklm\\system\\currentcontrolset\\services\\")
+	service_values[lower(helpers.get_arg("ValueName"))]
+}
@@ -0,0 +1,26 @@
+# Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+# Licensed under Apache License 2.0, see LICENCE.
+
+package eolh.EOLH_REGO_2
+
+import data.eolh.helpers
+
+__rego_metadoc__ := {
+	"id": "EOLH-REGO-2",
+	"version": "1",
+	"name": "Process Started from a Temporary Directory",
+	"eventName": "temp_dir_execution",
+	"description": "A process was started from a temporary or download directory, where droppers usually write their payload.",
+	"tags": ["execution"],
+	"properties": {"Severity": 2},
+}
+
+eolh_selected_events[{"source": "eolh", "name": "process_start"}]
+
+directories := {"\\appdata\\local\\temp\\", "\\windows\\temp\\", "\\downloads\\"}
+
+eolh_match := {"image": image} {
+	input.eventName == "process_start"
+	image := helpers.get_arg("ImageName")
+	contains(lower(image), directories[_])
+}
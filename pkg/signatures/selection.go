@@ -0,0 +1,154 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package signatures
+
+import (
+	"eolh/pkg/detect"
+	"slices"
+)
+
+// Override replaces the severity or the tags of a signature
+type Override struct {
+	ID       string   `mapstructure:"id"`
+	Severity *int     `mapstructure:"severity"`
+	Tags     []string `mapstructure:"tags"`
+}
+
+func (o Override) apply(metadata detect.SignatureMetadata) detect.SignatureMetadata {
+	if o.Severity != nil {
+		properties := make(map[string]interface{}, len(metadata.Properties)+1)
+		for k, v := range metadata.Properties {
+			properties[k] = v
+		}
+		properties["Severity"] = *o.Severity
+		metadata.Properties = properties
+	}
+	if o.Tags != nil {
+		metadata.Tags = o.Tags
+	}
+	return metadata
+}
+
+// Selection picks the signatures to load, and overrides their metadata
+type Selection struct {
+	// Include are the IDs, names or tags of the signatures to load, all of them when empty
+	Include []string
+	// Exclude are the IDs, names or tags of the signatures not to load, they take precedence over Include
+	Exclude   []string
+	Overrides []Override
+}
+
+func matches(patterns []string, metadata detect.SignatureMetadata) bool {
+	for _, p := range patterns {
+		if p == metadata.ID || p == metadata.Name || slices.Contains(metadata.Tags, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Selected reports whether a signature is to be loaded. Tags are matched after being overridden.
+func (s Selection) Selected(metadata detect.SignatureMetadata) bool {
+	metadata = s.override(metadata)
+	if matches(s.Exclude, metadata) {
+		return false
+	}
+	return len(s.Include) == 0 || matches(s.Include, metadata)
+}
+
+func (s Selection) override(metadata detect.SignatureMetadata) detect.SignatureMetadata {
+	for _, o := range s.Overrides {
+		if o.ID == metadata.ID {
+			metadata = o.apply(metadata)
+		}
+	}
+	return metadata
+}
+
+// Apply keeps the selected signatures, and wraps them to override their metadata and the metadata of their findings.
+// Signatures aggregating others, such as the Rego AIO signature, are kept: their signatures are selected when loading them.
+func (s Selection) Apply(sigs []detect.Signature) ([]detect.Signature, error) {
+	var selected []detect.Signature
+	for _, sig := range sigs {
+		metadata, err := sig.GetMetadata()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := sig.(aggregating); !ok && !s.Selected(metadata) {
+			continue
+		}
+		if len(s.Overrides) > 0 {
+			o := &overridden{Signature: sig, selection: s}
+			sig = o
+			if a, ok := o.Signature.(aggregating); ok {
+				sig = &overriddenAggregating{overridden: o, aggregating: a}
+			}
+		}
+		selected = append(selected, sig)
+	}
+	return selected, nil
+}
+
+// aggregating is implemented by signatures evaluating several signatures, see regosig.AIO
+type aggregating interface {
+	Signatures() []detect.SignatureMetadata
+	SelectedEventsOf(id string) []detect.SignatureEventSelector
+}
+
+// sourced is implemented by signatures loaded from a file
+type sourced interface {
+	Source() string
+}
+
+// overridden overrides the metadata of a signature, and of its findings as signatures report their own metadata
+type overridden struct {
+	detect.Signature
+	selection Selection
+}
+
+func (o *overridden) GetMetadata() (detect.SignatureMetadata, error) {
+	metadata, err := o.Signature.GetMetadata()
+	if err != nil {
+		return metadata, err
+	}
+	return o.selection.override(metadata), nil
+}
+
+func (o *overridden) Init(ctx detect.SignatureContext) error {
+	cb := ctx.Callback
+	ctx.Callback = func(f detect.Finding) {
+		f.SigMetadata = o.selection.override(f.SigMetadata)
+		cb(f)
+	}
+	return o.Signature.Init(ctx)
+}
+
+// Source returns the file the signature was loaded from, if any
+func (o *overridden) Source() string {
+	if s, ok := o.Signature.(sourced); ok {
+		return s.Source()
+	}
+	return ""
+}
+
+// overriddenAggregating overrides the metadata of an aggregating signature and of its signatures
+type overriddenAggregating struct {
+	*overridden
+	aggregating aggregating
+}
+
+func (o *overriddenAggregating) Signatures() []detect.SignatureMetadata {
+	sigs := o.aggregating.Signatures()
+	res := make([]detect.SignatureMetadata, 0, len(sigs))
+	for _, metadata := range sigs {
+		res = append(res, o.selection.override(metadata))
+	}
+	return res
+}
+
+func (o *overriddenAggregating) SelectedEventsOf(id string) []detect.SignatureEventSelector {
+	return o.aggregating.SelectedEventsOf(id)
+}
@@ -0,0 +1,180 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package signatures
+
+import (
+	"eolh/pkg/detect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func fakeSignature(id, name string, tags ...string) *FakeSignature {
+	var cb detect.SignatureHandler
+	metadata := detect.SignatureMetadata{ID: id, Name: name, Tags: tags, Properties: map[string]interface{}{"Severity": 1}}
+	return &FakeSignature{
+		FakeGetMetadata: func() (detect.SignatureMetadata, error) {
+			return metadata, nil
+		},
+		FakeInit: func(ctx detect.SignatureContext) error {
+			cb = ctx.Callback
+			return nil
+		},
+		FakeOnSignal: func(signal detect.Signal) error {
+			cb(detect.Finding{SigMetadata: metadata})
+			return nil
+		},
+	}
+}
+
+// fileSignature is a signature loaded from a file
+type fileSignature struct {
+	*FakeSignature
+	source string
+}
+
+func (s fileSignature) Source() string {
+	return s.source
+}
+
+// aggregatingSignature evaluates the signatures of its metadata
+type aggregatingSignature struct {
+	*FakeSignature
+	metadata []detect.SignatureMetadata
+}
+
+func (s aggregatingSignature) Signatures() []detect.SignatureMetadata {
+	return s.metadata
+}
+
+func (s aggregatingSignature) SelectedEventsOf(id string) []detect.SignatureEventSelector {
+	return nil
+}
+
+func ids(t *testing.T, sigs []detect.Signature) string {
+	t.Helper()
+	var res []string
+	for _, sig := range sigs {
+		metadata, err := sig.GetMetadata()
+		if err != nil {
+			t.Fatal(err)
+		}
+		res = append(res, metadata.ID)
+	}
+	return strings.Join(res, " ")
+}
+
+func TestSelectionApply(t *testing.T) {
+	sigs := []detect.Signature{
+		fakeSignature("TEST-1", "one", "persistence"),
+		fakeSignature("TEST-2", "two", "network"),
+		fakeSignature("TEST-3", "three", "network", "noisy"),
+	}
+	severity := 5
+	tests := []struct {
+		name      string
+		selection Selection
+		want      string
+	}{
+		{name: "all", want: "TEST-1 TEST-2 TEST-3"},
+		{name: "by id", selection: Selection{Include: []string{"TEST-2"}}, want: "TEST-2"},
+		{name: "by name", selection: Selection{Include: []string{"three"}}, want: "TEST-3"},
+		{name: "by tag", selection: Selection{Include: []string{"network"}}, want: "TEST-2 TEST-3"},
+		{name: "exclude", selection: Selection{Exclude: []string{"noisy"}}, want: "TEST-1 TEST-2"},
+		{name: "exclude first", selection: Selection{Include: []string{"network"}, Exclude: []string{"TEST-3"}}, want: "TEST-2"},
+		{name: "none", selection: Selection{Include: []string{"unknown"}}},
+		// tags are matched after being overridden
+		{
+			name:      "overridden tags",
+			selection: Selection{Include: []string{"network"}, Overrides: []Override{{ID: "TEST-1", Tags: []string{"network"}}, {ID: "TEST-3", Tags: []string{}}}},
+			want:      "TEST-1 TEST-2",
+		},
+		{
+			name:      "overridden severity",
+			selection: Selection{Exclude: []string{"TEST-2"}, Overrides: []Override{{ID: "TEST-3", Severity: &severity}}},
+			want:      "TEST-1 TEST-3",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selected, err := tt.selection.Apply(sigs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := ids(t, selected); got != tt.want {
+				t.Errorf("selected %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectionOverrides(t *testing.T) {
+	severity := 5
+	selection := Selection{Overrides: []Override{
+		{ID: "TEST-1", Severity: &severity},
+		{ID: "TEST-2", Tags: []string{"overridden"}},
+		{ID: "TEST-4", Severity: &severity},
+	}}
+	sig := fakeSignature("TEST-1", "one", "persistence")
+	sigs, err := selection.Apply([]detect.Signature{
+		sig,
+		fileSignature{FakeSignature: fakeSignature("TEST-2", "two", "network"), source: "two.rego"},
+		aggregatingSignature{FakeSignature: fakeSignature("TEST-AIO", "aio"), metadata: []detect.SignatureMetadata{{ID: "TEST-4"}, {ID: "TEST-5"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sigs) != 3 {
+		t.Fatalf("got %d signatures, want 3", len(sigs))
+	}
+
+	tests := []struct {
+		sig      detect.Signature
+		severity int
+		tags     []string
+		source   string
+	}{
+		{sig: sigs[0], severity: 5, tags: []string{"persistence"}},
+		{sig: sigs[1], severity: 1, tags: []string{"overridden"}, source: "two.rego"},
+	}
+	for _, tt := range tests {
+		metadata, err := tt.sig.GetMetadata()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if metadata.Properties["Severity"] != tt.severity || !slices.Equal(metadata.Tags, tt.tags) {
+			t.Errorf("%s metadata = %+v, want severity %d and tags %v", metadata.ID, metadata, tt.severity, tt.tags)
+		}
+		// findings report the metadata of their signature
+		var findings []detect.Finding
+		if err := tt.sig.Init(detect.SignatureContext{Callback: func(f detect.Finding) { findings = append(findings, f) }}); err != nil {
+			t.Fatal(err)
+		}
+		if err := tt.sig.OnSignal(detect.SignalShutdown{}); err != nil {
+			t.Fatal(err)
+		}
+		if len(findings) != 1 || findings[0].SigMetadata.Properties["Severity"] != tt.severity || !slices.Equal(findings[0].SigMetadata.Tags, tt.tags) {
+			t.Errorf("%s findings = %+v, want severity %d and tags %v", metadata.ID, findings, tt.severity, tt.tags)
+		}
+		s, ok := tt.sig.(sourced)
+		if !ok || s.Source() != tt.source {
+			t.Errorf("%s source = %v, want %q", metadata.ID, tt.sig, tt.source)
+		}
+	}
+	// the overrides don't leak into the signatures
+	if metadata, _ := sig.GetMetadata(); metadata.Properties["Severity"] != 1 {
+		t.Errorf("the override changed the signature metadata: %+v", metadata)
+	}
+
+	a, ok := sigs[2].(aggregating)
+	if !ok {
+		t.Fatalf("%T doesn't aggregate signatures anymore", sigs[2])
+	}
+	aggregated := a.Signatures()
+	if len(aggregated) != 2 || aggregated[0].Properties["Severity"] != 5 || aggregated[1].Properties != nil {
+		t.Errorf("aggregated signatures = %+v, want TEST-4 overridden", aggregated)
+	}
+}
@@ -0,0 +1,176 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package sigma
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// condition evaluates a condition given the results of the search identifiers
+type condition func(evaluate func(identifier string) bool) bool
+
+// conditionParser is a recursive descent parser of the condition grammar:
+//
+//	or       := and ("or" and)*
+//	and      := not ("and" not)*
+//	not      := "not" not | primary
+//	primary  := "(" or ")" | ("1" | "any" | "all") "of" (pattern | "them") | identifier
+type conditionParser struct {
+	tokens      []string
+	pos         int
+	identifiers []string
+}
+
+func parseCondition(expr string, identifiers []string) (condition, error) {
+	if strings.Contains(expr, "|") {
+		return nil, fmt.Errorf("aggregations are not supported")
+	}
+	expr = strings.NewReplacer("(", " ( ", ")", " ) ").Replace(expr)
+	p := conditionParser{tokens: strings.Fields(expr), identifiers: identifiers}
+	c, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if token, ok := p.peek(); ok {
+		return nil, fmt.Errorf("unexpected \"%s\"", token)
+	}
+	return c, nil
+}
+
+func (p *conditionParser) peek() (string, bool) {
+	if p.pos >= len(p.tokens) {
+		return "", false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *conditionParser) accept(keyword string) bool {
+	token, ok := p.peek()
+	if !ok || !strings.EqualFold(token, keyword) {
+		return false
+	}
+	p.pos++
+	return true
+}
+
+func (p *conditionParser) parseOr() (condition, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(evaluate func(string) bool) bool {
+			return l(evaluate) || right(evaluate)
+		}
+	}
+	return left, nil
+}
+
+func (p *conditionParser) parseAnd() (condition, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("and") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(evaluate func(string) bool) bool {
+			return l(evaluate) && right(evaluate)
+		}
+	}
+	return left, nil
+}
+
+func (p *conditionParser) parseNot() (condition, error) {
+	if p.accept("not") {
+		c, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return func(evaluate func(string) bool) bool {
+			return !c(evaluate)
+		}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *conditionParser) parsePrimary() (condition, error) {
+	token, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("unexpected end of condition")
+	}
+	p.pos++
+	switch strings.ToLower(token) {
+	case "(":
+		c, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		return c, nil
+	case ")", "and", "or", "of":
+		return nil, fmt.Errorf("unexpected \"%s\"", token)
+	case "1", "any", "all":
+		if p.accept("of") {
+			return p.parseOf(strings.ToLower(token) == "all")
+		}
+	}
+	for _, identifier := range p.identifiers {
+		if identifier == token {
+			return func(evaluate func(string) bool) bool {
+				return evaluate(token)
+			}, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown search identifier \"%s\"", token)
+}
+
+// parseOf parses the target of "1 of" and "all of", a search identifier pattern or "them"
+func (p *conditionParser) parseOf(all bool) (condition, error) {
+	pattern, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("unexpected end of condition")
+	}
+	p.pos++
+	var matched []string
+	for _, identifier := range p.identifiers {
+		if strings.EqualFold(pattern, "them") {
+			// identifiers starting with an underscore are left out of them
+			if !strings.HasPrefix(identifier, "_") {
+				matched = append(matched, identifier)
+			}
+			continue
+		}
+		if ok, err := path.Match(pattern, identifier); err != nil {
+			return nil, fmt.Errorf("invalid pattern \"%s\": %w", pattern, err)
+		} else if ok {
+			matched = append(matched, identifier)
+		}
+	}
+	if len(matched) == 0 {
+		return nil, fmt.Errorf("no search identifier matches \"%s\"", pattern)
+	}
+	return func(evaluate func(string) bool) bool {
+		for _, identifier := range matched {
+			if evaluate(identifier) != all {
+				return !all
+			}
+		}
+		return all
+	}, nil
+}
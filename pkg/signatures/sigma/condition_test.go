@@ -0,0 +1,77 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package sigma
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseCondition(t *testing.T) {
+	identifiers := []string{"selection", "filter_a", "filter_b", "keywords", "_helper"}
+	tests := []struct {
+		expr string
+		// matched are the search identifiers which match, separated by spaces
+		matched   string
+		want      bool
+		wantError bool
+	}{
+		{expr: "selection", matched: "selection", want: true},
+		{expr: "selection", matched: "", want: false},
+		{expr: "selection and not filter_a", matched: "selection", want: true},
+		{expr: "selection and not filter_a", matched: "selection filter_a", want: false},
+		{expr: "selection AND NOT filter_a", matched: "selection filter_a", want: false},
+		{expr: "not not selection", matched: "selection", want: true},
+		// and binds tighter than or
+		{expr: "selection or keywords and filter_a", matched: "selection", want: true},
+		{expr: "(selection or keywords) and filter_a", matched: "selection", want: false},
+		{expr: "selection and not (filter_a or filter_b)", matched: "selection filter_b", want: false},
+		{expr: "1 of filter_*", matched: "filter_b", want: true},
+		{expr: "any of filter_*", matched: "", want: false},
+		{expr: "all of filter_*", matched: "filter_a", want: false},
+		{expr: "all of filter_*", matched: "filter_a filter_b", want: true},
+		{expr: "selection and not 1 of filter_*", matched: "selection filter_a", want: false},
+		{expr: "1 of them", matched: "keywords", want: true},
+		{expr: "all of them", matched: "selection filter_a filter_b", want: false},
+		{expr: "all of them", matched: "selection filter_a filter_b keywords", want: true},
+		// identifiers starting with an underscore are left out of them, but not out of patterns
+		{expr: "1 of them", matched: "_helper", want: false},
+		{expr: "all of them", matched: "selection filter_a filter_b keywords _helper", want: true},
+		{expr: "1 of _*", matched: "_helper", want: true},
+		{expr: "selection and _helper", matched: "selection _helper", want: true},
+		{expr: "selection | count() > 5", wantError: true},
+		{expr: "unknown", wantError: true},
+		{expr: "1 of other_*", wantError: true},
+		{expr: "1 of [", wantError: true},
+		{expr: "all of", wantError: true},
+		{expr: "(selection", wantError: true},
+		{expr: "selection)", wantError: true},
+		{expr: "selection and", wantError: true},
+		{expr: "selection filter_a", wantError: true},
+		{expr: "or selection", wantError: true},
+		{expr: "", wantError: true},
+	}
+	for _, tt := range tests {
+		c, err := parseCondition(tt.expr, identifiers)
+		if tt.wantError {
+			if err == nil {
+				t.Errorf("parseCondition(%q) didn't fail", tt.expr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseCondition(%q): %v", tt.expr, err)
+			continue
+		}
+		matched := make(map[string]bool)
+		for _, identifier := range strings.Fields(tt.matched) {
+			matched[identifier] = true
+		}
+		if got := c(func(identifier string) bool { return matched[identifier] }); got != tt.want {
+			t.Errorf("%q with %q matching = %t, want %t", tt.expr, tt.matched, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package sigma
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fieldGetter returns the value of a Sigma field for the event being matched
+type fieldGetter func(field string) (string, bool)
+
+// selection is a compiled search identifier of the detection section
+type selection func(get fieldGetter) bool
+
+// compileDetection compiles the search identifiers and the condition of a detection section
+func compileDetection(detection *yaml.Node) (func(get fieldGetter) bool, error) {
+	selections := make(map[string]selection)
+	var identifiers []string
+	var conditions []string
+	for i := 0; i+1 < len(detection.Content); i += 2 {
+		key, value := detection.Content[i].Value, detection.Content[i+1]
+		switch key {
+		case "condition":
+			if err := value.Decode(&conditions); err != nil {
+				var condition string
+				if err := value.Decode(&condition); err != nil {
+					return nil, fmt.Errorf("invalid condition: %w", err)
+				}
+				conditions = []string{condition}
+			}
+		case "timeframe":
+			return nil, fmt.Errorf("timeframe is not supported")
+		default:
+			s, err := compileSelection(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			selections[key] = s
+			identifiers = append(identifiers, key)
+		}
+	}
+	if len(conditions) == 0 {
+		return nil, fmt.Errorf("missing condition")
+	}
+	var matchers []condition
+	for _, c := range conditions {
+		matcher, err := parseCondition(c, identifiers)
+		if err != nil {
+			return nil, fmt.Errorf("condition \"%s\": %w", c, err)
+		}
+		matchers = append(matchers, matcher)
+	}
+	match := func(get fieldGetter) bool {
+		// the results of the selections are cached as conditions may refer to them several times
+		results := make(map[string]bool, len(selections))
+		evaluate := func(identifier string) bool {
+			result, ok := results[identifier]
+			if !ok {
+				result = selections[identifier](get)
+				results[identifier] = result
+			}
+			return result
+		}
+		// a list of conditions is an alternative
+		for _, matcher := range matchers {
+			if matcher(evaluate) {
+				return true
+			}
+		}
+		return false
+	}
+	return match, nil
+}
+
+// compileSelection compiles a map of fields, all of which must match, or a list of such maps, one of which must match
+func compileSelection(node *yaml.Node) (selection, error) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return compileFields(node)
+	case yaml.SequenceNode:
+		var alternatives []selection
+		for _, item := range node.Content {
+			if item.Kind != yaml.MappingNode {
+				return nil, fmt.Errorf("keyword searches are not supported")
+			}
+			s, err := compileFields(item)
+			if err != nil {
+				return nil, err
+			}
+			alternatives = append(alternatives, s)
+		}
+		return func(get fieldGetter) bool {
+			for _, s := range alternatives {
+				if s(get) {
+					return true
+				}
+			}
+			return false
+		}, nil
+	default:
+		return nil, fmt.Errorf("keyword searches are not supported")
+	}
+}
+
+func compileFields(node *yaml.Node) (selection, error) {
+	var matchers []selection
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i].Value, node.Content[i+1]
+		parts := strings.Split(key, "|")
+		field := parts[0]
+		matcher, err := compileField(field, parts[1:], value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		matchers = append(matchers, matcher)
+	}
+	return func(get fieldGetter) bool {
+		for _, m := range matchers {
+			if !m(get) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// valueMatcher matches a field value against one of the values of a selection
+type valueMatcher func(value string) bool
+
+func compileField(field string, modifiers []string, node *yaml.Node) (selection, error) {
+	var values []*yaml.Node
+	switch node.Kind {
+	case yaml.ScalarNode:
+		values = []*yaml.Node{node}
+	case yaml.SequenceNode:
+		values = node.Content
+	default:
+		return nil, fmt.Errorf("invalid value")
+	}
+
+	all := false
+	anyPrefix, anySuffix := false, false
+	var compile func(value string) (valueMatcher, error)
+	for _, modifier := range modifiers {
+		switch modifier {
+		case "contains":
+			anyPrefix, anySuffix = true, true
+		case "startswith":
+			anySuffix = true
+		case "endswith":
+			anyPrefix = true
+		case "all":
+			all = true
+		case "re":
+			compile = compileRegexp
+		case "cidr":
+			compile = compileCIDR
+		default:
+			return nil, fmt.Errorf("unsupported modifier: %s", modifier)
+		}
+	}
+	if compile == nil {
+		compile = func(value string) (valueMatcher, error) {
+			return compileGlob(value, anyPrefix, anySuffix)
+		}
+	} else if anyPrefix || anySuffix {
+		return nil, fmt.Errorf("contains, startswith and endswith only apply to plain values")
+	}
+
+	var matchers []valueMatcher
+	expectEmpty := false
+	for _, v := range values {
+		if v.Kind != yaml.ScalarNode {
+			return nil, fmt.Errorf("invalid value")
+		}
+		if v.Tag == "!!null" {
+			expectEmpty = true
+			continue
+		}
+		m, err := compile(v.Value)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, m)
+	}
+
+	return func(get fieldGetter) bool {
+		value, ok := get(field)
+		if !ok || value == "" {
+			return expectEmpty
+		}
+		if len(matchers) == 0 {
+			return false
+		}
+		for _, m := range matchers {
+			matched := m(value)
+			if matched && !all {
+				return true
+			}
+			if !matched && all {
+				return false
+			}
+		}
+		return all
+	}, nil
+}
+
+// compileGlob compiles a value where * and ? are wildcards unless escaped by a backslash, the comparison is case insensitive.
+// anyPrefix and anySuffix allow any text before and after the value.
+func compileGlob(pattern string, anyPrefix bool, anySuffix bool) (valueMatcher, error) {
+	var expr strings.Builder
+	expr.WriteString("(?is)^")
+	if anyPrefix {
+		expr.WriteString(".*")
+	}
+	plain := !anyPrefix && !anySuffix
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case c == '\\' && i+1 < len(pattern) && strings.IndexByte(`*?\`, pattern[i+1]) >= 0:
+			i++
+			expr.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+			plain = false
+		case c == '*':
+			expr.WriteString(".*")
+			plain = false
+		case c == '?':
+			expr.WriteString(".")
+			plain = false
+		default:
+			expr.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	if anySuffix {
+		expr.WriteString(".*")
+	}
+	expr.WriteString("$")
+	if plain {
+		return func(value string) bool {
+			return strings.EqualFold(value, pattern)
+		}, nil
+	}
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return nil, err
+	}
+	return re.MatchString, nil
+}
+
+func compileRegexp(pattern string) (valueMatcher, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return re.MatchString, nil
+}
+
+func compileCIDR(pattern string) (valueMatcher, error) {
+	_, network, err := net.ParseCIDR(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return func(value string) bool {
+		ip := net.ParseIP(value)
+		return ip != nil && network.Contains(ip)
+	}, nil
+}
@@ -0,0 +1,258 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package sigma
+
+import (
+	"eolh/pkg/events"
+	"eolh/pkg/trace"
+	"fmt"
+	"strconv"
+)
+
+// logSource maps a Sigma log source category to the ETW events it covers and their fields.
+// Fields which aren't mapped are looked up in the event data of the ETW event.
+type logSource struct {
+	provider string
+	eventIDs []uint16
+	fields   map[string]func(e *trace.Event) (string, bool)
+}
+
+var logSources = map[string]logSource{
+	"process_creation": {
+		provider: "Microsoft-Windows-Kernel-Process",
+		// ProcessStart
+		eventIDs: []uint16{1},
+		fields: map[string]func(e *trace.Event) (string, bool){
+			"Image":             eventData("ImageName"),
+			"ProcessId":         eventData("ProcessID"),
+			"CommandLine":       commandLine,
+			"ParentProcessId":   eventData("ParentProcessID"),
+			"ParentImage":       parentImage,
+			"ParentCommandLine": parentCommandLine,
+			"Computer":          hostName,
+		},
+	},
+	"file_event": {
+		provider: "Microsoft-Windows-Kernel-File",
+		// CreateNewFile
+		eventIDs: []uint16{30},
+		fields: map[string]func(e *trace.Event) (string, bool){
+			"TargetFilename": eventData("FileName"),
+			"Image":          image,
+			"ProcessId":      processID,
+			"Computer":       hostName,
+		},
+	},
+	"network_connection": {
+		provider: "Microsoft-Windows-Kernel-Network",
+		// connection attempted and accepted, over IPv4 and IPv6
+		eventIDs: []uint16{12, 15, 28, 31},
+		fields: map[string]func(e *trace.Event) (string, bool){
+			"Image":           image,
+			"ProcessId":       eventData("PID"),
+			"Initiated":       initiated,
+			"SourceIp":        eventData("saddr"),
+			"SourcePort":      eventData("sport"),
+			"DestinationIp":   eventData("daddr"),
+			"DestinationPort": eventData("dport"),
+			"Computer":        hostName,
+		},
+	},
+	"dns_query": {
+		provider: "Microsoft-Windows-DNS-Client",
+		// query completed
+		eventIDs: []uint16{3008},
+		fields: map[string]func(e *trace.Event) (string, bool){
+			"Image":        image,
+			"ProcessId":    processID,
+			"QueryName":    eventData("QueryName"),
+			"QueryStatus":  eventData("QueryStatus"),
+			"QueryResults": eventData("QueryResults"),
+			"Computer":     hostName,
+		},
+	},
+	"ps_script": {
+		provider: "Microsoft-Windows-PowerShell",
+		// script block logging, reassembled by eolh
+		eventIDs: []uint16{4104},
+		fields: map[string]func(e *trace.Event) (string, bool){
+			"ScriptBlockText": arg("ScriptBlockText"),
+			"Path":            arg("Path"),
+			"Image":           image,
+			"ProcessId":       processID,
+			"Computer":        hostName,
+		},
+	},
+	"ps_module": {
+		provider: "Microsoft-Windows-PowerShell",
+		// module logging
+		eventIDs: []uint16{4103},
+		fields: map[string]func(e *trace.Event) (string, bool){
+			"ContextInfo": arg("ContextInfo"),
+			"Payload":     arg("Payload"),
+			"Image":       image,
+			"ProcessId":   processID,
+			"Computer":    hostName,
+		},
+	},
+	"registry_add":    registryLogSource(1),
+	"registry_delete": registryLogSource(3, 6),
+	"registry_set":    registryLogSource(5),
+	"registry_event":  registryLogSource(1, 3, 5, 6),
+}
+
+// registryLogSource covers Kernel-Registry events, whose paths are normalized by eolh, e.g. HKLM\SOFTWARE
+func registryLogSource(eventIDs ...uint16) logSource {
+	return logSource{
+		provider: "Microsoft-Windows-Kernel-Registry",
+		eventIDs: eventIDs,
+		fields: map[string]func(e *trace.Event) (string, bool){
+			"TargetObject": registryTarget,
+			"EventType":    registryEventType,
+			"Image":        image,
+			"ProcessId":    processID,
+			"Computer":     hostName,
+		},
+	}
+}
+
+// matches reports whether an event belongs to the log source
+func (ls logSource) matches(e *trace.Event) bool {
+	if e.RawEvent.System.Provider.Name != ls.provider {
+		return false
+	}
+	for _, id := range ls.eventIDs {
+		if e.RawEvent.System.EventID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// eventNames returns the names of the eolh events decoded from the ETW events of the log source
+func (ls logSource) eventNames() ([]string, error) {
+	names := make([]string, 0, len(ls.eventIDs))
+	for _, id := range ls.eventIDs {
+		def, ok := events.Lookup(ls.provider, id)
+		if !ok {
+			return nil, fmt.Errorf("no event decoded from %s event %d", ls.provider, id)
+		}
+		names = append(names, def.Name)
+	}
+	return names, nil
+}
+
+// getter returns the field getter of an event, values are cached as some of them are costly to get
+func (ls logSource) getter(e *trace.Event) fieldGetter {
+	type value struct {
+		v  string
+		ok bool
+	}
+	cache := make(map[string]value)
+	return func(field string) (string, bool) {
+		if cached, ok := cache[field]; ok {
+			return cached.v, cached.ok
+		}
+		get, ok := ls.fields[field]
+		if !ok {
+			get = eventData(field)
+		}
+		v, ok := get(e)
+		cache[field] = value{v, ok}
+		return v, ok
+	}
+}
+
+func eventData(key string) func(e *trace.Event) (string, bool) {
+	return func(e *trace.Event) (string, bool) {
+		v, ok := e.RawEvent.EventData[key]
+		if !ok || v == nil {
+			return "", false
+		}
+		if s, ok := v.(string); ok {
+			return s, true
+		}
+		return fmt.Sprint(v), true
+	}
+}
+
+func arg(name string) func(e *trace.Event) (string, bool) {
+	return func(e *trace.Event) (string, bool) {
+		a, ok := e.Arg(name)
+		if !ok || a.Value == nil {
+			return "", false
+		}
+		return fmt.Sprint(a.Value), true
+	}
+}
+
+// registryTarget is the path of the value of value events, and of the key otherwise
+func registryTarget(e *trace.Event) (string, bool) {
+	if target, ok := arg("target_object")(e); ok {
+		return target, true
+	}
+	return arg("key_path")(e)
+}
+
+var registryEventTypes = map[uint16]string{
+	1: "CreateKey",
+	3: "DeleteKey",
+	5: "SetValue",
+	6: "DeleteValue",
+}
+
+func registryEventType(e *trace.Event) (string, bool) {
+	eventType, ok := registryEventTypes[e.RawEvent.System.EventID]
+	return eventType, ok
+}
+
+// image is the path of the image of the process of the event, Sigma rules match it with e.g. endswith: '\cmd.exe'
+func image(e *trace.Event) (string, bool) {
+	if e.ProcessImage != "" {
+		return e.ProcessImage, true
+	}
+	return e.ProcessName, e.ProcessName != ""
+}
+
+func processID(e *trace.Event) (string, bool) {
+	return strconv.Itoa(e.ProcessID), true
+}
+
+func commandLine(e *trace.Event) (string, bool) {
+	return e.Cmdline, e.Cmdline != ""
+}
+
+func hostName(e *trace.Event) (string, bool) {
+	return e.HostName, e.HostName != ""
+}
+
+// parentImage is the path of the image of the parent, the process of process creation events being the created one
+func parentImage(e *trace.Event) (string, bool) {
+	if len(e.Ancestors) == 0 {
+		return "", false
+	}
+	parent := e.Ancestors[0]
+	if parent.ProcessImage != "" {
+		return parent.ProcessImage, true
+	}
+	return parent.ProcessName, parent.ProcessName != ""
+}
+
+func parentCommandLine(e *trace.Event) (string, bool) {
+	if len(e.Ancestors) == 0 {
+		return "", false
+	}
+	return e.Ancestors[0].Cmdline, e.Ancestors[0].Cmdline != ""
+}
+
+func initiated(e *trace.Event) (string, bool) {
+	switch e.RawEvent.System.EventID {
+	case 12, 28:
+		return "true", true
+	default:
+		return "false", true
+	}
+}
@@ -0,0 +1,57 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package sigma
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Rule is a Sigma rule, see https://github.com/SigmaHQ/sigma-specification
+type Rule struct {
+	Title          string    `yaml:"title"`
+	ID             string    `yaml:"id"`
+	Status         string    `yaml:"status"`
+	Description    string    `yaml:"description"`
+	Author         string    `yaml:"author"`
+	References     []string  `yaml:"references"`
+	Tags           []string  `yaml:"tags"`
+	Level          string    `yaml:"level"`
+	FalsePositives []string  `yaml:"falsepositives"`
+	LogSource      LogSource `yaml:"logsource"`
+	Detection      yaml.Node `yaml:"detection"`
+}
+
+type LogSource struct {
+	Category string `yaml:"category"`
+	Product  string `yaml:"product"`
+	Service  string `yaml:"service"`
+}
+
+// ParseRule parses a Sigma rule written in YAML
+func ParseRule(data []byte) (*Rule, error) {
+	var rule Rule
+	if err := yaml.Unmarshal(data, &rule); err != nil {
+		return nil, err
+	}
+	if rule.Title == "" {
+		return nil, fmt.Errorf("missing title")
+	}
+	if rule.Detection.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("missing detection")
+	}
+	return &rule, nil
+}
+
+// severity maps the Sigma levels to the severities of the Go and Rego signatures
+var severity = map[string]int{
+	"informational": 0,
+	"low":           1,
+	"medium":        2,
+	"high":          3,
+	"critical":      4,
+}
@@ -0,0 +1,133 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package sigma
+
+import (
+	"eolh/pkg/detect"
+	"eolh/pkg/protocol"
+	"eolh/pkg/trace"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// SigmaSignature is a detect.Signature compiled from a Sigma rule.
+//
+// Only the windows process_creation, file_event and network_connection log sources are supported,
+// along with the contains, startswith, endswith, all, re and cidr modifiers. Rules using anything
+// else, e.g. keyword searches or aggregations, are rejected when loaded.
+type SigmaSignature struct {
+	cb             detect.SignatureHandler
+	rule           *Rule
+	source         string
+	logSource      logSource
+	match          func(get fieldGetter) bool
+	metadata       detect.SignatureMetadata
+	selectedEvents []detect.SignatureEventSelector
+}
+
+var nonAlphanumericRegex = regexp.MustCompile(`[^a-z0-9]+`)
+
+// NewSigmaSignature compiles a Sigma rule read from source, which is only used to locate the rule
+func NewSigmaSignature(source string, data []byte) (*SigmaSignature, error) {
+	rule, err := ParseRule(data)
+	if err != nil {
+		return nil, err
+	}
+	if rule.ID == "" {
+		return nil, fmt.Errorf("missing id")
+	}
+	if rule.LogSource.Product != "" && rule.LogSource.Product != "windows" {
+		return nil, fmt.Errorf("unsupported product: %s", rule.LogSource.Product)
+	}
+	if rule.LogSource.Service != "" {
+		return nil, fmt.Errorf("unsupported service: %s", rule.LogSource.Service)
+	}
+	ls, ok := logSources[rule.LogSource.Category]
+	if !ok {
+		return nil, fmt.Errorf("unsupported category: %s", rule.LogSource.Category)
+	}
+	names, err := ls.eventNames()
+	if err != nil {
+		return nil, fmt.Errorf("category %s: %w", rule.LogSource.Category, err)
+	}
+	// only the events of the log source are dispatched to the rule
+	selectedEvents := make([]detect.SignatureEventSelector, 0, len(names))
+	for _, name := range names {
+		selectedEvents = append(selectedEvents, detect.SignatureEventSelector{Source: "eolh", Name: name, Origin: "*"})
+	}
+	match, err := compileDetection(&rule.Detection)
+	if err != nil {
+		return nil, fmt.Errorf("detection: %w", err)
+	}
+	level, ok := severity[rule.Level]
+	if !ok && rule.Level != "" {
+		return nil, fmt.Errorf("invalid level: %s", rule.Level)
+	}
+	return &SigmaSignature{
+		rule:           rule,
+		source:         source,
+		logSource:      ls,
+		match:          match,
+		selectedEvents: selectedEvents,
+		metadata: detect.SignatureMetadata{
+			ID:          rule.ID,
+			Version:     "1",
+			Name:        rule.Title,
+			EventName:   "sigma_" + strings.Trim(nonAlphanumericRegex.ReplaceAllString(strings.ToLower(rule.Title), "_"), "_"),
+			Description: rule.Description,
+			Tags:        rule.Tags,
+			Properties: map[string]interface{}{
+				"Severity": level,
+				"Category": rule.LogSource.Category,
+			},
+		},
+	}, nil
+}
+
+func (sig *SigmaSignature) GetMetadata() (detect.SignatureMetadata, error) {
+	return sig.metadata, nil
+}
+
+// Source returns the file the rule was loaded from
+func (sig *SigmaSignature) Source() string {
+	return sig.source
+}
+
+func (sig *SigmaSignature) GetSelectedEvents() ([]detect.SignatureEventSelector, error) {
+	return sig.selectedEvents, nil
+}
+
+func (sig *SigmaSignature) Init(ctx detect.SignatureContext) error {
+	sig.cb = ctx.Callback
+	return nil
+}
+
+func (sig *SigmaSignature) OnEvent(event protocol.Event) error {
+	ee, ok := event.Payload.(trace.Event)
+	if !ok {
+		return fmt.Errorf("failed to cast event's payload")
+	}
+	if !sig.logSource.matches(&ee) {
+		return nil
+	}
+	if !sig.match(sig.logSource.getter(&ee)) {
+		return nil
+	}
+	sig.cb(detect.Finding{
+		SigMetadata: sig.metadata,
+		Event:       event,
+		Data:        nil,
+		Msg:         fmt.Sprintf("Sigma rule matched: %s", sig.rule.Title),
+	})
+	return nil
+}
+
+func (sig *SigmaSignature) OnSignal(signal detect.Signal) error {
+	return nil
+}
+
+func (sig *SigmaSignature) Close() {}
@@ -0,0 +1,66 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package sigma
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSelectedEvents(t *testing.T) {
+	tests := []struct {
+		category string
+		want     []string
+	}{
+		{category: "process_creation", want: []string{"process_start"}},
+		{category: "file_event", want: []string{"file_create_new"}},
+		{category: "network_connection", want: []string{"tcp_connect", "tcp_accept", "tcp_connect_ipv6", "tcp_accept_ipv6"}},
+		{category: "dns_query", want: []string{"dns_response"}},
+		{category: "ps_script", want: []string{"powershell_script"}},
+		{category: "ps_module", want: []string{"powershell_module"}},
+		{category: "registry_set", want: []string{"registry_set_value"}},
+		{category: "registry_event", want: []string{"registry_create_key", "registry_delete_key", "registry_set_value", "registry_delete_value"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.category, func(t *testing.T) {
+			rule := fmt.Sprintf(`title: Test
+id: 00000000-0000-0000-0000-000000000000
+logsource:
+  product: windows
+  category: %s
+detection:
+  selection:
+    Image|endswith: '\cmd.exe'
+  condition: selection
+`, tt.category)
+			sig, err := NewSigmaSignature("test.yml", []byte(rule))
+			if err != nil {
+				t.Fatal(err)
+			}
+			selected, err := sig.GetSelectedEvents()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(selected) != len(tt.want) {
+				t.Fatalf("selected events = %+v, want %v", selected, tt.want)
+			}
+			for i, name := range tt.want {
+				if selected[i].Source != "eolh" || selected[i].Name != name {
+					t.Errorf("selected event %d = %+v, want eolh %s", i, selected[i], name)
+				}
+			}
+		})
+	}
+}
+
+// every log source must be mapped to the events it covers
+func TestLogSourcesEventNames(t *testing.T) {
+	for category, ls := range logSources {
+		if _, err := ls.eventNames(); err != nil {
+			t.Errorf("%s: %v", category, err)
+		}
+	}
+}
@@ -9,15 +9,22 @@ Licensed under Apache License 2.0, see LICENCE.
 package signatures
 
 import (
-	"bytes"
+	"embed"
 	"eolh/pkg/detect"
 	"eolh/pkg/logger"
+	"eolh/pkg/signatures/bundle"
 	"eolh/pkg/signatures/regosig"
+	"eolh/pkg/signatures/sigma"
+	"errors"
+	"fmt"
 	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
+	"sort"
 
-	"github.com/open-policy-agent/opa/compile"
+	"github.com/open-policy-agent/opa/ast"
 )
 
 func findGoSigs() []detect.Signature {
@@ -26,59 +33,276 @@ func findGoSigs() []detect.Signature {
 	sigs = append(sigs, &PidSpoofing{})
 	sigs = append(sigs, &CryptoMiner{})
 	sigs = append(sigs, &Tor{})
+	sigs = append(sigs, &SpoofedDrop{})
 	// Add your signatures below
 	// sig = append(sig, &YOUR_SIGNATURE{})
 	return sigs
 }
 
-func Find() ([]detect.Signature, error) {
+// Config tells where to find the signatures and how to load them
+type Config struct {
+	// Dirs are searched for Rego and Sigma signatures, besides the embedded ones.
+	// Rego packages found in Dirs replace the embedded packages of the same name.
+	Dirs []string
+	// Bundles are verified signature bundles, their Rego packages replace the embedded ones. Dirs modules declaring the
+	// package of a bundle are rejected, unsigned modules never replace signed ones.
+	Bundles []*bundle.Bundle
+	// Strict fails on the first directory, file or signature which can't be loaded, instead of logging and skipping it
+	Strict bool
+	Rego   regosig.Options
+}
+
+//go:embed rules
+var embeddedRules embed.FS
+
+// signatureDir is a tree of signature files, or the files of a bundle.
+// name locates the files in logs and signature sources, signed tells the files come from a verified bundle.
+type signatureDir struct {
+	fsys   fs.FS
+	files  map[string][]byte
+	name   string
+	signed bool
+}
+
+func embeddedDir() signatureDir {
+	rules, err := fs.Sub(embeddedRules, "rules")
+	if err != nil {
+		panic(err)
+	}
+	return signatureDir{fsys: rules, name: "builtin"}
+}
+
+// DefaultDirs returns the signatures directory next to the executable, if there is one
+func DefaultDirs() []string {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil
+	}
+	dir := filepath.Join(filepath.Dir(exe), "signatures")
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return nil
+	}
+	return []string{dir}
+}
+
+// Find returns the Go signatures along with the embedded Rego signatures, and the Rego and Sigma signatures
+// of the configured bundles and directories
+func Find(config Config) ([]detect.Signature, error) {
+	dirs := make([]signatureDir, 0, len(config.Bundles)+len(config.Dirs))
+	for _, b := range config.Bundles {
+		dirs = append(dirs, signatureDir{files: b.Files, name: b.String(), signed: true})
+	}
+	for _, dir := range config.Dirs {
+		dirs = append(dirs, signatureDir{fsys: os.DirFS(dir), name: dir})
+	}
+	return find(embeddedDir(), dirs, config)
+}
+
+// FindIn returns the Go signatures along with the Rego and Sigma signatures found in dir
+func FindIn(dir string, regoConfig regosig.Options) ([]detect.Signature, error) {
+	return find(signatureDir{}, []signatureDir{{fsys: os.DirFS(dir), name: dir}}, Config{Rego: regoConfig})
+}
+
+func find(builtin signatureDir, dirs []signatureDir, config Config) ([]detect.Signature, error) {
 	var sigs []detect.Signature
 	gosigs := findGoSigs()
 	sigs = append(sigs, gosigs...)
-	opasigs, err := findRegoSigs(compile.TargetRego, "signatures")
+
+	modules := make(map[string]string)
+	if builtin.name != "" {
+		builtinModules, err := readRegoModules(builtin, config.Strict)
+		if err != nil {
+			return nil, err
+		}
+		modules = builtinModules
+	}
+	// signed are the packages of the bundles
+	signed := make(map[string]string)
+	for _, dir := range dirs {
+		dirModules, err := readRegoModules(dir, config.Strict)
+		if err != nil {
+			return nil, err
+		}
+		if !dir.signed {
+			if err := rejectSigned(dirModules, signed, config.Strict); err != nil {
+				return nil, err
+			}
+		}
+		overrideModules(modules, dirModules)
+		if dir.signed {
+			for name, code := range dirModules {
+				if pkg := packageOf(name, code); pkg != "" {
+					signed[pkg] = dir.name
+				}
+			}
+		}
+	}
+	opasigs, err := loadRegoSigs(config.Rego, modules, config.Strict)
 	if err != nil {
 		return nil, err
 	}
 	sigs = append(sigs, opasigs...)
+
+	for _, dir := range dirs {
+		sigmasigs, err := findSigmaSigs(dir, config.Strict)
+		if err != nil {
+			return nil, err
+		}
+		sigs = append(sigs, sigmasigs...)
+	}
 	return sigs, nil
 }
 
-func findRegoSigs(target string, dir string) ([]detect.Signature, error) {
-	modules := make(map[string]string)
-	var res []detect.Signature
-
-	errWD := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+// readFiles reads the files of dir with one of the given extensions, keyed by their path prefixed with the dir name
+func readFiles(dir signatureDir, strict bool, exts ...string) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	if dir.files != nil {
+		for p, content := range dir.files {
+			if slices.Contains(exts, path.Ext(p)) {
+				files[filepath.Join(dir.name, filepath.FromSlash(p))] = content
+			}
+		}
+		return files, nil
+	}
+	errWD := fs.WalkDir(dir.fsys, ".", func(p string, d fs.DirEntry, err error) error {
 		if err != nil {
-			logger.Errorw("Finding rego sigs", err)
 			return err
 		}
-		if d.IsDir() {
+		if d.IsDir() || !slices.Contains(exts, path.Ext(p)) {
 			return nil
 		}
-		regoCode, err := os.ReadFile(path)
-		if err != nil {
-			logger.Errorw("Readling file " + path + ": " + err.Error())
-		}
-		modules[path] = string(regoCode)
-		sig, err := regosig.NewRegoSignature(target, string(regoCode))
+		name := filepath.Join(dir.name, filepath.FromSlash(p))
+		content, err := fs.ReadFile(dir.fsys, p)
 		if err != nil {
-			newlineOffset := bytes.Index(regoCode, []byte("\n"))
-			if newlineOffset == -1 {
-				codeLength := len(regoCode)
-				if codeLength < 22 {
-					newlineOffset = codeLength
-				} else {
-					newlineOffset = 22
-				}
+			if strict {
+				return fmt.Errorf("reading file %s: %w", name, err)
 			}
-			logger.Errorw("Creating rego signature with: " + string(regoCode[0:newlineOffset]) + ": " + err.Error())
+			logger.Errorw("Reading file " + name + ": " + err.Error())
 			return nil
 		}
-		res = append(res, sig)
+		files[name] = content
 		return nil
 	})
 	if errWD != nil {
-		logger.Errorw("Walking dir", "error", errWD)
+		if strict {
+			return nil, fmt.Errorf("walking signatures dir %s: %w", dir.name, errWD)
+		}
+		logger.Errorw("Walking dir", "dir", dir.name, "error", errWD)
+	}
+	return files, nil
+}
+
+func readRegoModules(dir signatureDir, strict bool) (map[string]string, error) {
+	files, err := readFiles(dir, strict, ".rego")
+	if err != nil {
+		return nil, err
+	}
+	modules := make(map[string]string, len(files))
+	for name, content := range files {
+		modules[name] = string(content)
+	}
+	return modules, nil
+}
+
+// overrideModules adds the overriding modules, replacing the modules which declare the same packages
+func overrideModules(modules map[string]string, overriding map[string]string) {
+	packages := make(map[string]bool)
+	for name, code := range overriding {
+		if pkg := packageOf(name, code); pkg != "" {
+			packages[pkg] = true
+		}
+	}
+	for name, code := range modules {
+		if packages[packageOf(name, code)] {
+			logger.Debugw("Rego module overridden", "module", name)
+			delete(modules, name)
+		}
+	}
+	for name, code := range overriding {
+		modules[name] = code
+	}
+}
+
+// rejectSigned removes the unsigned modules declaring the package of a bundle
+func rejectSigned(modules map[string]string, signed map[string]string, strict bool) error {
+	for name, code := range modules {
+		pkg := packageOf(name, code)
+		b, ok := signed[pkg]
+		if !ok {
+			continue
+		}
+		if strict {
+			return fmt.Errorf("unsigned module %s declares %s of signed bundle %s", name, pkg, b)
+		}
+		logger.Errorw("Ignoring unsigned module declaring the package of a signed bundle", "module", name, "package", pkg, "bundle", b)
+		delete(modules, name)
+	}
+	return nil
+}
+
+// packageOf returns the package declared by a module, or an empty string when it can't be parsed
+func packageOf(name string, code string) string {
+	module, err := ast.ParseModule(name, code)
+	if err != nil || module == nil {
+		return ""
+	}
+	return module.Package.Path.String()
+}
+
+func findSigmaSigs(dir signatureDir, strict bool) ([]detect.Signature, error) {
+	files, err := readFiles(dir, strict, ".yml", ".yaml")
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var sigs []detect.Signature
+	for _, name := range names {
+		sig, err := sigma.NewSigmaSignature(name, files[name])
+		if err != nil {
+			if strict {
+				return nil, fmt.Errorf("creating sigma signature %s: %w", name, err)
+			}
+			logger.Errorw("Creating sigma signature " + name + ": " + err.Error())
+			continue
+		}
+		sigs = append(sigs, sig)
+	}
+	return sigs, nil
+}
+
+// loadRegoSigs compiles all the modules together, so that signatures can import shared libraries.
+// Files failing to compile are reported and left out, along with the files depending on them, unless strict is set.
+func loadRegoSigs(regoConfig regosig.Options, modules map[string]string, strict bool) ([]detect.Signature, error) {
+	for len(modules) > 0 {
+		sigs, err := regosig.NewRegoSignatures(regoConfig, modules)
+		if err != nil && strict {
+			return nil, fmt.Errorf("creating rego signatures: %w", err)
+		}
+		var astErrors ast.Errors
+		if sigs == nil && errors.As(err, &astErrors) {
+			faulty := make(map[string]bool)
+			for _, e := range astErrors {
+				logger.Errorw("Compiling rego signatures: " + e.Error())
+				if e.Location != nil && e.Location.File != "" {
+					faulty[e.Location.File] = true
+				}
+			}
+			if len(faulty) == 0 {
+				return nil, nil
+			}
+			for path := range faulty {
+				delete(modules, path)
+			}
+			continue
+		}
+		if err != nil {
+			logger.Errorw("Creating rego signatures: " + err.Error())
+		}
+		return sigs, nil
 	}
-	return res, nil
+	return nil, nil
 }
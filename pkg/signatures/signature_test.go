@@ -0,0 +1,79 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package signatures
+
+import (
+	"eolh/pkg/detect"
+	"eolh/pkg/signatures/sigtest"
+	"fmt"
+	"testing"
+	"testing/fstest"
+)
+
+// tempExec is a version of the embedded EOLH-REGO-2 signature
+func tempExec(version string) string {
+	return fmt.Sprintf(`package eolh.EOLH_REGO_2
+
+__rego_metadoc__ := {"id": "EOLH-REGO-2", "version": %q, "name": "temp", "eventName": "temp_dir_execution"}
+
+eolh_selected_events[{"source": "eolh", "name": "process_start"}]
+
+eolh_match {
+	input.eventName == "process_start"
+}
+`, version)
+}
+
+func versions(sigs []detect.Signature) map[string]string {
+	res := make(map[string]string)
+	for _, sig := range sigs {
+		metadata, _ := sig.GetMetadata()
+		res[metadata.ID] = metadata.Version
+	}
+	return res
+}
+
+func TestFindOverrides(t *testing.T) {
+	signed := signatureDir{files: map[string][]byte{"temp.rego": []byte(tempExec("2"))}, name: "test@1", signed: true}
+	unsigned := signatureDir{fsys: fstest.MapFS{"temp.rego": {Data: []byte(tempExec("3"))}}, name: "dir"}
+
+	tests := []struct {
+		name      string
+		dirs      []signatureDir
+		strict    bool
+		want      string
+		wantError bool
+	}{
+		{name: "embedded", want: "1"},
+		{name: "bundle replaces embedded", dirs: []signatureDir{signed}, want: "2"},
+		{name: "dir replaces embedded", dirs: []signatureDir{unsigned}, want: "3"},
+		{name: "dir doesn't replace bundle", dirs: []signatureDir{signed, unsigned}, want: "2"},
+		{name: "dir replacing bundle fails strict", dirs: []signatureDir{signed, unsigned}, strict: true, wantError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sigs, err := find(embeddedDir(), tt.dirs, Config{Strict: tt.strict})
+			if tt.wantError {
+				if err == nil {
+					t.Error("find didn't fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := versions(sigs)["EOLH-REGO-2"]; got != tt.want {
+				t.Errorf("EOLH-REGO-2 version = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignatures(t *testing.T) {
+	sigtest.Test(t, func() ([]detect.Signature, error) {
+		return Find(Config{Strict: true})
+	}, "testdata")
+}
@@ -0,0 +1,123 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package sigtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"eolh/pkg/trace"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// FixtureSuffix is the suffix of the fixture files, which usually sit next to the signature they test
+const FixtureSuffix = ".fixture.json"
+
+// Fixture is a test case: the events fed to the signatures, and the findings they must produce
+type Fixture struct {
+	Path        string `json:"-"`
+	Description string `json:"description,omitempty"`
+	// Signatures are the IDs of the signatures to run, all of them when empty.
+	// Signatures consuming findings need the signatures producing them.
+	Signatures []string        `json:"signatures,omitempty"`
+	Events     []trace.Event   `json:"events"`
+	Findings   []FindingResult `json:"findings"`
+}
+
+// FindingResult describes a finding, expected ones only need the fields to check
+type FindingResult struct {
+	SignatureID string `json:"signatureId"`
+	// Event is the index of the fixture event which caused the finding, directly or through other findings.
+	// It is nil for the findings reported on shutdown, and unchecked when nil in expected findings.
+	Event *int `json:"event,omitempty"`
+	// Data must be a subset of the finding data
+	Data map[string]interface{} `json:"data,omitempty"`
+	Msg  string                 `json:"msg,omitempty"`
+}
+
+func (f FindingResult) String() string {
+	s := f.SignatureID
+	if f.Event != nil {
+		s += fmt.Sprintf(" on event %d", *f.Event)
+	} else {
+		s += " on shutdown"
+	}
+	if f.Msg != "" {
+		s += fmt.Sprintf(" msg=%q", f.Msg)
+	}
+	if len(f.Data) > 0 {
+		data, _ := json.Marshal(f.Data)
+		s += " data=" + string(data)
+	}
+	return s
+}
+
+// matches reports whether an actual finding satisfies an expected one
+func (f FindingResult) matches(actual FindingResult) bool {
+	if f.SignatureID != actual.SignatureID {
+		return false
+	}
+	if f.Event != nil && (actual.Event == nil || *f.Event != *actual.Event) {
+		return false
+	}
+	if f.Msg != "" && f.Msg != actual.Msg {
+		return false
+	}
+	for k, v := range f.Data {
+		if !reflect.DeepEqual(v, actual.Data[k]) {
+			return false
+		}
+	}
+	return true
+}
+
+// LoadFixture reads a fixture file
+func LoadFixture(path string) (Fixture, error) {
+	var fixture Fixture
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fixture, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&fixture); err != nil {
+		return fixture, fmt.Errorf("%s: %w", path, err)
+	}
+	fixture.Path = path
+	return fixture, nil
+}
+
+// LoadFixtures reads the fixture files found in dir, sorted by path
+func LoadFixtures(dir string) ([]Fixture, error) {
+	var paths []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.HasSuffix(path, FixtureSuffix) {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	fixtures := make([]Fixture, 0, len(paths))
+	for _, path := range paths {
+		fixture, err := LoadFixture(path)
+		if err != nil {
+			return nil, err
+		}
+		fixtures = append(fixtures, fixture)
+	}
+	return fixtures, nil
+}
@@ -0,0 +1,266 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+// Package sigtest runs signatures against fixtures of events and checks the findings they produce.
+package sigtest
+
+import (
+	"context"
+	"encoding/json"
+	"eolh/pkg/detect"
+	"eolh/pkg/engine"
+	"eolh/pkg/protocol"
+	"eolh/pkg/trace"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Loader creates the signatures under test, fresh instances are needed for every fixture
+type Loader func() ([]detect.Signature, error)
+
+// Result is the outcome of a fixture
+type Result struct {
+	Fixture    Fixture
+	Err        error
+	Findings   []FindingResult
+	Missing    []FindingResult
+	Unexpected []FindingResult
+}
+
+func (r Result) Passed() bool {
+	return r.Err == nil && len(r.Missing) == 0 && len(r.Unexpected) == 0
+}
+
+// Diff describes how the findings differ from the expected ones
+func (r Result) Diff() string {
+	var b strings.Builder
+	if r.Err != nil {
+		fmt.Fprintf(&b, "error: %s\n", r.Err)
+	}
+	for _, f := range r.Missing {
+		fmt.Fprintf(&b, "- %s\n", f)
+	}
+	for _, f := range r.Unexpected {
+		fmt.Fprintf(&b, "+ %s\n", f)
+	}
+	return b.String()
+}
+
+// barrier is a signal queued after the events of a round, signatures are done with the round once it is handled
+type barrier struct {
+	wg *sync.WaitGroup
+}
+
+// recorder wraps a signature under test, recording its findings and handling barriers
+type recorder struct {
+	detect.Signature
+	record func(detect.Finding)
+	loaded bool
+}
+
+// Init is the last step of loading a signature in the engine
+func (r *recorder) Init(ctx detect.SignatureContext) error {
+	cb := ctx.Callback
+	ctx.Callback = func(f detect.Finding) {
+		r.record(f)
+		cb(f)
+	}
+	if err := r.Signature.Init(ctx); err != nil {
+		return err
+	}
+	r.loaded = true
+	return nil
+}
+
+func (r *recorder) OnSignal(signal detect.Signal) error {
+	if b, ok := signal.(barrier); ok {
+		b.wg.Done()
+		return nil
+	}
+	return r.Signature.OnSignal(signal)
+}
+
+// Run feeds the fixture events, one at a time, to the signatures through an engine.
+// Findings are fed back to the engine until the signatures are done with an event, so that
+// the findings of signatures consuming other findings are attributed to the original event.
+func Run(load Loader, fixture Fixture) Result {
+	result := Result{Fixture: fixture}
+	sigs, err := selectSignatures(load, fixture.Signatures)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	var mutex sync.Mutex
+	// produced tells whether findings were recorded since the last barrier
+	var produced bool
+	current := -1
+	record := func(f detect.Finding) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		produced = true
+		finding := FindingResult{
+			SignatureID: f.SigMetadata.ID,
+			Data:        normalize(f.Data),
+			Msg:         f.Msg,
+		}
+		if current >= 0 {
+			event := current
+			finding.Event = &event
+		}
+		result.Findings = append(result.Findings, finding)
+	}
+	recorders := make([]*recorder, 0, len(sigs))
+	wrapped := make([]detect.Signature, 0, len(sigs))
+	for _, sig := range sigs {
+		r := &recorder{Signature: sig, record: record}
+		recorders = append(recorders, r)
+		wrapped = append(wrapped, r)
+	}
+
+	sources := engine.EventSources{
+		Eolh:    make(chan protocol.Event),
+		Signals: make(chan detect.Signal),
+	}
+	output := make(chan detect.Finding)
+	sigEngine, err := engine.NewEngine(engine.Config{
+		Enabled:             true,
+		SignatureBufferSize: 1000,
+		Signatures:          wrapped,
+		Feedback: func(f detect.Finding) (protocol.Event, error) {
+			event, err := trace.FromFinding(f)
+			if err != nil {
+				return protocol.Event{}, err
+			}
+			return event.ToFindingProtocol(), nil
+		},
+	}, sources, output)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	for _, r := range recorders {
+		if !r.loaded {
+			metadata, _ := r.GetMetadata()
+			result.Err = fmt.Errorf("signature %s failed to load", metadata.ID)
+			return result
+		}
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sigEngine.Start(context.Background())
+	}()
+	go func() {
+		// findings are recorded by the signatures callback, the engine output is discarded
+		for range output {
+		}
+	}()
+
+	// settle waits for the signatures to handle the events sent so far, and tells whether they produced findings. The
+	// engine dispatches the findings fed back before the barrier signal, which is then handled after them.
+	settle := func() bool {
+		var wg sync.WaitGroup
+		wg.Add(len(wrapped))
+		sources.Signals <- barrier{wg: &wg}
+		wg.Wait()
+		mutex.Lock()
+		defer mutex.Unlock()
+		found := produced
+		produced = false
+		return found
+	}
+	for i, event := range fixture.Events {
+		mutex.Lock()
+		current = i
+		mutex.Unlock()
+		sources.Eolh <- event.ToProtocol()
+		for settle() {
+		}
+	}
+	mutex.Lock()
+	current = -1
+	mutex.Unlock()
+	close(sources.Eolh)
+	<-done
+	close(output)
+
+	result.Missing, result.Unexpected = compare(fixture.Findings, result.Findings)
+	return result
+}
+
+// selectSignatures loads the signatures and keeps the ones with the given IDs
+func selectSignatures(load Loader, ids []string) ([]detect.Signature, error) {
+	sigs, err := load()
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return sigs, nil
+	}
+	found := make(map[string]bool, len(ids))
+	var selected []detect.Signature
+	for _, sig := range sigs {
+		metadata, err := sig.GetMetadata()
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			if metadata.ID == id {
+				selected = append(selected, sig)
+				found[id] = true
+			}
+		}
+	}
+	for _, id := range ids {
+		if !found[id] {
+			return nil, fmt.Errorf("signature %s not found", id)
+		}
+	}
+	return selected, nil
+}
+
+// normalize converts finding data to its JSON representation, as fixtures are compared to it
+func normalize(data map[string]interface{}) map[string]interface{} {
+	if len(data) == 0 {
+		return nil
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return data
+	}
+	var res map[string]interface{}
+	if err := json.Unmarshal(b, &res); err != nil {
+		return data
+	}
+	return res
+}
+
+// compare matches every expected finding with a distinct actual one
+func compare(expected []FindingResult, actual []FindingResult) ([]FindingResult, []FindingResult) {
+	var missing []FindingResult
+	matched := make([]bool, len(actual))
+	for _, e := range expected {
+		found := false
+		for i, a := range actual {
+			if !matched[i] && e.matches(a) {
+				matched[i] = true
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, e)
+		}
+	}
+	var unexpected []FindingResult
+	for i, a := range actual {
+		if !matched[i] {
+			unexpected = append(unexpected, a)
+		}
+	}
+	return missing, unexpected
+}
@@ -0,0 +1,47 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package sigtest
+
+// TestingT is the subset of *testing.T used by Test
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// RunDir runs the fixtures found in dir
+func RunDir(load Loader, dir string) ([]Result, error) {
+	fixtures, err := LoadFixtures(dir)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]Result, 0, len(fixtures))
+	for _, fixture := range fixtures {
+		results = append(results, Run(load, fixture))
+	}
+	return results, nil
+}
+
+// Test runs the fixtures found in dir and reports the failing ones, e.g. from a go test:
+//
+//	func TestSignatures(t *testing.T) {
+//		sigtest.Test(t, loader, "testdata")
+//	}
+func Test(t TestingT, load Loader, dir string) {
+	t.Helper()
+	results, err := RunDir(load, dir)
+	if err != nil {
+		t.Errorf("loading fixtures: %s", err)
+		return
+	}
+	if len(results) == 0 {
+		t.Errorf("no fixture found in %s", dir)
+	}
+	for _, result := range results {
+		if !result.Passed() {
+			t.Errorf("%s:\n%s", result.Fixture.Path, result.Diff())
+		}
+	}
+}
@@ -0,0 +1,117 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package signatures
+
+import (
+	"eolh/pkg/detect"
+	"eolh/pkg/protocol"
+	"eolh/pkg/trace"
+	"fmt"
+	"time"
+)
+
+const spoofedDropWindow = 5 * time.Minute
+
+// SpoofedDrop is a meta signature built on top of the findings of PidSpoofing and Drop.
+type SpoofedDrop struct {
+	cb       detect.SignatureHandler
+	spoofing map[string]time.Time
+	drops    map[string]time.Time
+}
+
+func (sig *SpoofedDrop) GetMetadata() (detect.SignatureMetadata, error) {
+	return detect.SignatureMetadata{
+		ID:          "EOLH-5",
+		Version:     "1",
+		Name:        "PPID Spoofing and Executable Drop",
+		EventName:   "ppid_spoofing_dropped_exe",
+		Description: "PPID spoofing and a new executable dropped in the same container within 5 minutes.",
+		Properties: map[string]interface{}{
+			"Severity": 4,
+		},
+	}, nil
+}
+
+func (sig *SpoofedDrop) GetSelectedEvents() ([]detect.SignatureEventSelector, error) {
+	return []detect.SignatureEventSelector{
+		{Source: protocol.FindingsSource, Name: "ppid_spoofing", Origin: "*"},
+		{Source: protocol.FindingsSource, Name: "dropped_exe_container", Origin: "*"},
+	}, nil
+}
+
+func (sig *SpoofedDrop) Init(ctx detect.SignatureContext) error {
+	sig.cb = ctx.Callback
+	sig.spoofing = make(map[string]time.Time)
+	sig.drops = make(map[string]time.Time)
+	return nil
+}
+
+func (sig *SpoofedDrop) OnEvent(event protocol.Event) error {
+	ee, ok := event.Payload.(trace.Event)
+	if !ok {
+		return fmt.Errorf("failed to cast event's payload")
+	}
+	id := ee.ContainerID
+	if id == "" {
+		return nil
+	}
+	sig.expire(ee.Timestamp)
+	var other time.Time
+	switch ee.EventName {
+	case "ppid_spoofing":
+		sig.spoofing[id] = ee.Timestamp
+		other, ok = sig.drops[id]
+	case "dropped_exe_container":
+		sig.drops[id] = ee.Timestamp
+		other, ok = sig.spoofing[id]
+	default:
+		return nil
+	}
+	if !ok {
+		return nil
+	}
+	delta := ee.Timestamp.Sub(other)
+	if delta < 0 {
+		delta = -delta
+	}
+	if delta > spoofedDropWindow {
+		return nil
+	}
+	delete(sig.spoofing, id)
+	delete(sig.drops, id)
+	metadata, err := sig.GetMetadata()
+	if err != nil {
+		return err
+	}
+	message := fmt.Sprintf("PPID Spoofing and New Executable Dropped within %s in container: %s", delta.Round(time.Second), id)
+	sig.cb(detect.Finding{
+		SigMetadata: metadata,
+		Event:       event,
+		Data:        nil,
+		Msg:         message,
+	})
+	return nil
+}
+
+// expire forgets the findings too old to be paired with a finding at now
+func (sig *SpoofedDrop) expire(now time.Time) {
+	for id, t := range sig.spoofing {
+		if now.Sub(t) > spoofedDropWindow {
+			delete(sig.spoofing, id)
+		}
+	}
+	for id, t := range sig.drops {
+		if now.Sub(t) > spoofedDropWindow {
+			delete(sig.drops, id)
+		}
+	}
+}
+
+func (sig *SpoofedDrop) OnSignal(signal detect.Signal) error {
+	return nil
+}
+
+func (sig *SpoofedDrop) Close() {}
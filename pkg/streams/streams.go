@@ -0,0 +1,192 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+// Package streams fans the events and findings of the pipeline out to subscribers.
+package streams
+
+import (
+	"eolh/pkg/metrics"
+	"eolh/pkg/trace"
+	"strings"
+	"sync"
+)
+
+// Kind selects events, findings, or both when empty
+type Kind string
+
+const (
+	KindEvents   Kind = "events"
+	KindFindings Kind = "findings"
+)
+
+// Filter selects the events of a stream. Empty fields match everything.
+type Filter struct {
+	Kind         Kind     `json:"kind,omitempty"`
+	EventNames   []string `json:"eventNames,omitempty"`
+	ProcessNames []string `json:"processNames,omitempty"` // matched case-insensitively
+	ProcessIDs   []int    `json:"processIds,omitempty"`
+	ContainerIDs []string `json:"containerIds,omitempty"`
+	// SignatureIDs and MinSeverity only match findings
+	SignatureIDs []string `json:"signatureIds,omitempty"`
+	MinSeverity  int      `json:"minSeverity,omitempty"`
+}
+
+// IsFinding reports whether an event was reported for a finding
+func IsFinding(event *trace.Event) bool {
+	return event.Metadata != nil
+}
+
+func contains[T comparable](values []T, v T) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Match reports whether an event passes the filter
+func (f Filter) Match(event *trace.Event) bool {
+	finding := IsFinding(event)
+	switch f.Kind {
+	case KindEvents:
+		if finding {
+			return false
+		}
+	case KindFindings:
+		if !finding {
+			return false
+		}
+	}
+	if len(f.EventNames) > 0 && !contains(f.EventNames, event.EventName) {
+		return false
+	}
+	if len(f.ProcessIDs) > 0 && !contains(f.ProcessIDs, event.ProcessID) {
+		return false
+	}
+	if len(f.ContainerIDs) > 0 && !contains(f.ContainerIDs, event.ContainerID) {
+		return false
+	}
+	if len(f.ProcessNames) > 0 {
+		found := false
+		for _, name := range f.ProcessNames {
+			if strings.EqualFold(name, event.ProcessName) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(f.SignatureIDs) == 0 && f.MinSeverity == 0 {
+		return true
+	}
+	if !finding {
+		return false
+	}
+	if len(f.SignatureIDs) > 0 {
+		id, _ := event.Metadata.Properties["signatureID"].(string)
+		if !contains(f.SignatureIDs, id) {
+			return false
+		}
+	}
+	return severity(event.Metadata.Properties["Severity"]) >= f.MinSeverity
+}
+
+// severity reads the Severity property, which is an int for Go signatures and a number for the decoded ones
+func severity(v interface{}) int {
+	switch s := v.(type) {
+	case int:
+		return s
+	case float64:
+		return int(s)
+	case interface{ Int64() (int64, error) }:
+		n, _ := s.Int64()
+		return int(n)
+	}
+	return 0
+}
+
+// Stream receives the events matching its filter
+type Stream struct {
+	filter Filter
+	events chan trace.Event
+}
+
+// Events returns the channel of the stream, closed when it is unsubscribed
+func (s *Stream) Events() <-chan trace.Event {
+	return s.events
+}
+
+// Manager publishes the events to the streams
+type Manager struct {
+	mutex   sync.RWMutex
+	streams map[*Stream]struct{}
+	stats   *metrics.Stats
+}
+
+func NewManager(stats *metrics.Stats) *Manager {
+	return &Manager{
+		streams: make(map[*Stream]struct{}),
+		stats:   stats,
+	}
+}
+
+// Subscribe creates a stream buffering up to size events, events are dropped when it is full
+func (m *Manager) Subscribe(filter Filter, size int) *Stream {
+	s := &Stream{
+		filter: filter,
+		events: make(chan trace.Event, size),
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.streams[s] = struct{}{}
+	return s
+}
+
+func (m *Manager) Unsubscribe(s *Stream) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, ok := m.streams[s]; ok {
+		delete(m.streams, s)
+		close(s.events)
+	}
+}
+
+// Publish sends an event to the matching streams without blocking
+func (m *Manager) Publish(event *trace.Event) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	for s := range m.streams {
+		if !s.filter.Match(event) {
+			continue
+		}
+		select {
+		case s.events <- *event:
+		default:
+			if m.stats != nil {
+				m.stats.StreamDroppedCount.Add(1)
+			}
+		}
+	}
+}
+
+// Subscribers returns the number of streams
+func (m *Manager) Subscribers() int {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return len(m.streams)
+}
+
+// Close unsubscribes every stream
+func (m *Manager) Close() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for s := range m.streams {
+		delete(m.streams, s)
+		close(s.events)
+	}
+}
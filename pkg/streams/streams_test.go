@@ -0,0 +1,72 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package streams
+
+import (
+	"encoding/json"
+	"eolh/pkg/trace"
+	"testing"
+)
+
+func TestFilterMatch(t *testing.T) {
+	event := &trace.Event{EventName: "process_start", ProcessID: 100, ProcessName: "cmd.exe", ContainerID: "abc"}
+	finding := &trace.Event{
+		EventName:   "tor_executable",
+		ProcessID:   200,
+		ProcessName: "tor.exe",
+		Metadata: &trace.Metadata{Properties: map[string]interface{}{
+			"signatureID": "EOLH-4",
+			"Severity":    4,
+		}},
+	}
+	// findings decoded from JSON, e.g. by the printers, have float severities
+	decoded := &trace.Event{EventName: "office_spawned_shell", Metadata: &trace.Metadata{Properties: map[string]interface{}{
+		"signatureID": "EOLH-REGO-1",
+		"Severity":    float64(3),
+	}}}
+	// and json.Number ones when decoded with UseNumber
+	numbered := &trace.Event{EventName: "mining_pool_dns", Metadata: &trace.Metadata{Properties: map[string]interface{}{
+		"signatureID": "EOLH-REGO-3",
+		"Severity":    json.Number("3"),
+	}}}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		event  *trace.Event
+		want   bool
+	}{
+		{name: "empty filter event", filter: Filter{}, event: event, want: true},
+		{name: "empty filter finding", filter: Filter{}, event: finding, want: true},
+		{name: "events kind", filter: Filter{Kind: KindEvents}, event: event, want: true},
+		{name: "events kind finding", filter: Filter{Kind: KindEvents}, event: finding, want: false},
+		{name: "findings kind", filter: Filter{Kind: KindFindings}, event: finding, want: true},
+		{name: "findings kind event", filter: Filter{Kind: KindFindings}, event: event, want: false},
+		{name: "event name", filter: Filter{EventNames: []string{"file_close", "process_start"}}, event: event, want: true},
+		{name: "other event name", filter: Filter{EventNames: []string{"file_close"}}, event: event, want: false},
+		{name: "process name case insensitive", filter: Filter{ProcessNames: []string{"CMD.EXE"}}, event: event, want: true},
+		{name: "other process name", filter: Filter{ProcessNames: []string{"powershell.exe"}}, event: event, want: false},
+		{name: "process ID", filter: Filter{ProcessIDs: []int{100}}, event: event, want: true},
+		{name: "other process ID", filter: Filter{ProcessIDs: []int{101}}, event: event, want: false},
+		{name: "container ID", filter: Filter{ContainerIDs: []string{"abc"}}, event: event, want: true},
+		{name: "host event", filter: Filter{ContainerIDs: []string{"abc"}}, event: finding, want: false},
+		{name: "signature ID", filter: Filter{SignatureIDs: []string{"EOLH-4"}}, event: finding, want: true},
+		{name: "other signature ID", filter: Filter{SignatureIDs: []string{"EOLH-1"}}, event: finding, want: false},
+		{name: "signature ID event", filter: Filter{SignatureIDs: []string{"EOLH-4"}}, event: event, want: false},
+		{name: "min severity", filter: Filter{MinSeverity: 4}, event: finding, want: true},
+		{name: "min severity event", filter: Filter{MinSeverity: 1}, event: event, want: false},
+		{name: "min severity decoded", filter: Filter{MinSeverity: 3}, event: decoded, want: true},
+		{name: "min severity decoded too low", filter: Filter{MinSeverity: 4}, event: decoded, want: false},
+		{name: "min severity number", filter: Filter{MinSeverity: 3}, event: numbered, want: true},
+		{name: "all criteria", filter: Filter{Kind: KindFindings, ProcessNames: []string{"tor.exe"}, SignatureIDs: []string{"EOLH-4"}, MinSeverity: 2}, event: finding, want: true},
+		{name: "one criterion failing", filter: Filter{Kind: KindFindings, ProcessNames: []string{"tor.exe"}, SignatureIDs: []string{"EOLH-4"}, MinSeverity: 5}, event: finding, want: false},
+	}
+	for _, tt := range tests {
+		if got := tt.filter.Match(tt.event); got != tt.want {
+			t.Errorf("%s: Match() = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
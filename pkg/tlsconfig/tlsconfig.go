@@ -0,0 +1,100 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+// Package tlsconfig loads the TLS configurations of the gRPC endpoints of eolh from PEM files.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+)
+
+// Files are the PEM files of a TLS configuration
+type Files struct {
+	// Cert and Key are the certificate presented to the peer and its key
+	Cert string
+	Key  string
+	// CA is the bundle of the certificate authorities verifying the peer. Servers require the certificate of their
+	// clients when it is set, clients verify their server against the system roots when it is empty.
+	CA string
+}
+
+// Empty tells whether no file is set, TLS being disabled
+func (f Files) Empty() bool {
+	return f.Cert == "" && f.Key == "" && f.CA == ""
+}
+
+// Loopback tells whether a host is only reachable from the local machine, which doesn't need TLS. The empty host
+// listens on all the interfaces.
+func Loopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Server returns the configuration of a server, which needs a certificate
+func Server(f Files) (*tls.Config, error) {
+	if f.Cert == "" || f.Key == "" {
+		return nil, errors.New("a TLS server needs both a certificate and a key")
+	}
+	cert, err := tls.LoadX509KeyPair(f.Cert, f.Key)
+	if err != nil {
+		return nil, fmt.Errorf("loading the TLS certificate: %w", err)
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if f.CA != "" {
+		pool, err := loadPool(f.CA)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// Client returns the configuration of a client, which presents a certificate when one is set
+func Client(f Files) (*tls.Config, error) {
+	if (f.Cert == "") != (f.Key == "") {
+		return nil, errors.New("a TLS client certificate needs both a certificate and a key")
+	}
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if f.Cert != "" {
+		cert, err := tls.LoadX509KeyPair(f.Cert, f.Key)
+		if err != nil {
+			return nil, fmt.Errorf("loading the TLS certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if f.CA != "" {
+		pool, err := loadPool(f.CA)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+	return config, nil
+}
+
+func loadPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading the TLS certificate authorities: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificate found in %s", path)
+	}
+	return pool, nil
+}
@@ -0,0 +1,225 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// pki writes a certificate authority, and the certificates it signs for the server and a client
+type pki struct {
+	dir    string
+	ca     *x509.Certificate
+	caKey  *ecdsa.PrivateKey
+	serial int64
+}
+
+func newPKI(t *testing.T) *pki {
+	t.Helper()
+	p := &pki{dir: t.TempDir()}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "eolh test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.ca, _ = x509.ParseCertificate(der)
+	p.caKey = key
+	p.serial = 1
+	p.write(t, "ca.pem", "CERTIFICATE", der)
+	return p
+}
+
+func (p *pki) write(t *testing.T, name, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(p.dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// issue writes a certificate and its key, returning their paths
+func (p *pki) issue(t *testing.T, name string, usage x509.ExtKeyUsage) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.serial++
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(p.serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, p.ca, &key.PublicKey, p.caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p.write(t, name+".pem", "CERTIFICATE", der), p.write(t, name+"-key.pem", "EC PRIVATE KEY", keyDER)
+}
+
+// handshake connects a client to a server over loopback, returning the errors of both sides
+func handshake(t *testing.T, server, client *tls.Config) (error, error) {
+	t.Helper()
+	lis, err := tls.Listen("tcp", "127.0.0.1:0", server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	errc := make(chan error, 1)
+	go func() {
+		conn, err := lis.Accept()
+		if err != nil {
+			errc <- err
+			return
+		}
+		defer conn.Close()
+		err = conn.(*tls.Conn).Handshake()
+		if err == nil {
+			// the client only learns the server rejected its certificate once it reads
+			_, err = conn.Write([]byte{0})
+		}
+		errc <- err
+	}()
+	client = client.Clone()
+	client.ServerName = "127.0.0.1"
+	conn, err := tls.Dial("tcp", lis.Addr().String(), client)
+	if err == nil {
+		_, err = conn.Read(make([]byte, 1))
+		conn.Close()
+	}
+	return <-errc, err
+}
+
+func TestMutualTLS(t *testing.T) {
+	p := newPKI(t)
+	ca := filepath.Join(p.dir, "ca.pem")
+	serverCert, serverKey := p.issue(t, "server", x509.ExtKeyUsageServerAuth)
+	clientCert, clientKey := p.issue(t, "client", x509.ExtKeyUsageClientAuth)
+	otherCA := filepath.Join(newPKI(t).dir, "ca.pem")
+
+	tests := []struct {
+		name      string
+		server    Files
+		client    Files
+		wantError bool
+	}{
+		{
+			name:   "server authentication",
+			server: Files{Cert: serverCert, Key: serverKey},
+			client: Files{CA: ca},
+		},
+		{
+			name:   "mutual authentication",
+			server: Files{Cert: serverCert, Key: serverKey, CA: ca},
+			client: Files{Cert: clientCert, Key: clientKey, CA: ca},
+		},
+		{
+			name:      "client without certificate",
+			server:    Files{Cert: serverCert, Key: serverKey, CA: ca},
+			client:    Files{CA: ca},
+			wantError: true,
+		},
+		{
+			name:      "server unknown to the client",
+			server:    Files{Cert: serverCert, Key: serverKey},
+			client:    Files{CA: otherCA},
+			wantError: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, err := Server(tt.server)
+			if err != nil {
+				t.Fatal(err)
+			}
+			client, err := Client(tt.client)
+			if err != nil {
+				t.Fatal(err)
+			}
+			serverErr, clientErr := handshake(t, server, client)
+			if failed := serverErr != nil || clientErr != nil; failed != tt.wantError {
+				t.Errorf("handshake errors: server %v, client %v, want error %t", serverErr, clientErr, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestInvalidFiles(t *testing.T) {
+	p := newPKI(t)
+	cert, key := p.issue(t, "server", x509.ExtKeyUsageServerAuth)
+	if _, err := Server(Files{CA: filepath.Join(p.dir, "ca.pem")}); err == nil {
+		t.Error("Server accepted a configuration without certificate")
+	}
+	if _, err := Server(Files{Cert: cert, Key: cert}); err == nil {
+		t.Error("Server accepted a certificate as key")
+	}
+	if _, err := Client(Files{Cert: cert}); err == nil {
+		t.Error("Client accepted a certificate without key")
+	}
+	if _, err := Client(Files{CA: key}); err == nil {
+		t.Error("Client accepted a bundle without certificate")
+	}
+	if _, err := Client(Files{CA: filepath.Join(p.dir, "missing.pem")}); err == nil {
+		t.Error("Client accepted a missing bundle")
+	}
+	if !(Files{}).Empty() || (Files{CA: "ca.pem"}).Empty() {
+		t.Error("Empty is wrong")
+	}
+}
+
+func TestLoopback(t *testing.T) {
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{host: "localhost", want: true},
+		{host: "127.0.0.1", want: true},
+		{host: "127.1.2.3", want: true},
+		{host: "::1", want: true},
+		{host: "", want: false},
+		{host: "0.0.0.0", want: false},
+		{host: "10.0.0.1", want: false},
+		{host: "plugin.example.com", want: false},
+	}
+	for _, tt := range tests {
+		if got := Loopback(tt.host); got != tt.want {
+			t.Errorf("Loopback(%q) = %t, want %t", tt.host, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+/*
+Copyright (c) Aqua Security Software Ltd.
+Licensed under Apache License 2.0, see LICENCE.tracee and NOTICE.
+
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package trace
+
+import (
+	"eolh/pkg/detect"
+	"fmt"
+)
+
+// FromFinding converts a finding into the event reported for it
+func FromFinding(f detect.Finding) (*Event, error) {
+	s, ok := f.Event.Payload.(Event)
+	if !ok {
+		return nil, fmt.Errorf("error converting finding to event: %s", f.SigMetadata.ID)
+	}
+	// findings have no event definition
+	return newEvent(-1, f, s), nil
+}
+
+func getMetadataFromSignatureMetadata(sigMetadata detect.SignatureMetadata) *Metadata {
+	metadata := &Metadata{}
+
+	metadata.Version = sigMetadata.Version
+	metadata.Description = sigMetadata.Description
+	metadata.Tags = sigMetadata.Tags
+
+	// the properties of the signature are shared by its findings, which may be converted concurrently
+	properties := make(map[string]interface{}, len(sigMetadata.Properties)+2)
+	for k, v := range sigMetadata.Properties {
+		properties[k] = v
+	}
+
+	metadata.Properties = properties
+	metadata.Properties["signatureID"] = sigMetadata.ID
+	metadata.Properties["signatureName"] = sigMetadata.Name
+
+	return metadata
+}
+
+func newEvent(id int, f detect.Finding, s Event) *Event {
+	metadata := getMetadataFromSignatureMetadata(f.SigMetadata)
+
+	return &Event{
+		EventID:         id,
+		EventName:       f.SigMetadata.EventName,
+		Timestamp:       s.Timestamp,
+		ProcessID:       s.ProcessID,
+		ThreadID:        s.ThreadID,
+		ParentProcessID: s.ParentProcessID,
+		ProcessName:     s.ProcessName,
+		ProcessImage:    s.ProcessImage,
+		HostName:        s.HostName,
+		ContainerID:     s.ContainerID,
+		Cmdline:         s.Cmdline,
+		Ancestors:       s.Ancestors,
+		Container:       s.Container,
+		Kubernetes:      s.Kubernetes,
+		ContextFlags:    s.ContextFlags,
+		Metadata:        metadata,
+		Message:         f.Msg,
+	}
+}
@@ -0,0 +1,44 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package trace
+
+import (
+	"eolh/pkg/detect"
+	"sync"
+	"testing"
+)
+
+// the engine feeds a finding back while the pipeline reports it, both convert it, run with -race
+func TestFromFindingConcurrently(t *testing.T) {
+	f := detect.Finding{
+		SigMetadata: detect.SignatureMetadata{
+			ID:         "EOLH-1",
+			Name:       "Test",
+			EventName:  "test",
+			Properties: map[string]interface{}{"Severity": 2},
+		},
+	}
+	f.Event.Payload = Event{ProcessID: 100}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			event, err := FromFinding(f)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if event.Metadata.Properties["signatureID"] != "EOLH-1" || event.Metadata.Properties["Severity"] != 2 {
+				t.Errorf("properties = %v", event.Metadata.Properties)
+			}
+		}()
+	}
+	wg.Wait()
+	if len(f.SigMetadata.Properties) != 1 {
+		t.Errorf("the signature properties were modified: %v", f.SigMetadata.Properties)
+	}
+}
@@ -11,8 +11,6 @@ package trace
 import (
 	"eolh/pkg/protocol"
 	"time"
-
-	"local.packages/golang-etw/etw"
 )
 
 type Container struct {
@@ -52,25 +50,46 @@ type ArgMeta struct {
 	Type string `json:"type"`
 }
 
+// Ancestor is a process in the ancestry of the process of an event
+type Ancestor struct {
+	ProcessID    int    `json:"processId"`
+	ProcessName  string `json:"processName"`
+	ProcessImage string `json:"processImage,omitempty"`
+	Cmdline      string `json:"cmdLine"`
+}
+
 type Event struct {
-	Timestamp       time.Time    `json:"timestamp"`
-	ProcessID       int          `json:"processId"`
-	ThreadID        int          `json:"threadId"`
-	ParentProcessID int          `json:"parentProcessId"`
-	IsHost          bool         `json:"isHost"`
-	ProcessName     string       `json:"processName"`
-	Cmdline         string       `json:"cmdLine"`
-	HostName        string       `json:"computerName"`
-	ContainerID     string       `json:"containerId"`
-	Container       Container    `json:"container,omitempty"`
-	Kubernetes      Kubernetes   `json:"kubernetes,omitempty"`
-	EventID         int          `json:"eventId,string"`
-	EventName       string       `json:"eventName"`
-	ContextFlags    ContextFlags `json:"contextFlags"`
-	Args            []Argument   `json:"args"` // Arguments are ordered according their appearance in the original event
-	Metadata        *Metadata    `json:"metadata,omitempty"`
-	RawEvent        etw.Event    `json:"raw,omitempty"`
-	Message         string       `json:"message"`
+	Timestamp       time.Time `json:"timestamp"`
+	ProcessID       int       `json:"processId"`
+	ThreadID        int       `json:"threadId"`
+	ParentProcessID int       `json:"parentProcessId"`
+	IsHost          bool      `json:"isHost"`
+	ProcessName     string    `json:"processName"`
+	ProcessImage    string    `json:"processImage,omitempty"` // path of the image of the process, from the process tree
+	Cmdline         string    `json:"cmdLine"`
+	// Ancestors are the parent of the process, its grandparent and so on, up to the container entrypoint or the host root
+	Ancestors    []Ancestor   `json:"ancestors,omitempty"`
+	HostName     string       `json:"computerName"`
+	ContainerID  string       `json:"containerId"`
+	Container    Container    `json:"container,omitempty"`
+	Kubernetes   Kubernetes   `json:"kubernetes,omitempty"`
+	EventID      int          `json:"eventId,string"`
+	EventName    string       `json:"eventName"`
+	ContextFlags ContextFlags `json:"contextFlags"`
+	Args         []Argument   `json:"args"` // Arguments are ordered according their appearance in the original event
+	Metadata     *Metadata    `json:"metadata,omitempty"`
+	RawEvent     RawEvent     `json:"raw,omitempty"`
+	Message      string       `json:"message"`
+}
+
+// Arg returns the argument of the given name
+func (e Event) Arg(name string) (Argument, bool) {
+	for _, arg := range e.Args {
+		if arg.Name == name {
+			return arg, true
+		}
+	}
+	return Argument{}, false
 }
 
 // Converts a trace.Event into a protocol.Event that the rules engine can consume
@@ -87,6 +106,20 @@ func (e Event) ToProtocol() protocol.Event {
 	}
 }
 
+// Converts a trace.Event created from a finding into a protocol.Event that other signatures can subscribe to
+func (e Event) ToFindingProtocol() protocol.Event {
+	return protocol.Event{
+		Headers: protocol.EventHeaders{
+			Selector: protocol.Selector{
+				Name:   e.EventName,
+				Origin: string(e.Origin()),
+				Source: protocol.FindingsSource,
+			},
+		},
+		Payload: e,
+	}
+}
+
 // EventOrigin is where a trace.Event occured, it can either be from the host machine or from a container
 type EventOrigin string
 
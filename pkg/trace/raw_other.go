@@ -0,0 +1,66 @@
+//go:build !windows
+
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package trace
+
+import "time"
+
+// RawEvent mirrors the ETW event of golang-etw, which only builds on Windows,
+// so that signatures and their fixtures can be run on other platforms.
+type RawEvent struct {
+	Flags struct {
+		Skippable bool
+	}
+	EventData map[string]interface{} `json:",omitempty"`
+	UserData  map[string]interface{} `json:",omitempty"`
+	System    struct {
+		Channel     string
+		Computer    string
+		EventID     uint16
+		EventType   string `json:",omitempty"`
+		EventGuid   GUID   `json:",omitempty"`
+		Correlation struct {
+			ActivityID        string
+			RelatedActivityID string
+		}
+		Execution struct {
+			ProcessID uint32
+			ThreadID  uint32
+		}
+		Keywords struct {
+			Value uint64
+			Name  string
+		}
+		Level struct {
+			Value uint8
+			Name  string
+		}
+		Opcode struct {
+			Value uint8
+			Name  string
+		}
+		Task struct {
+			Value uint8
+			Name  string
+		}
+		Provider struct {
+			Guid GUID
+			Name string
+		}
+		TimeCreated struct {
+			SystemTime time.Time
+		}
+	}
+	ExtendedData []string `json:",omitempty"`
+}
+
+type GUID struct {
+	Data1 uint32
+	Data2 uint16
+	Data3 uint16
+	Data4 [8]byte
+}
@@ -0,0 +1,11 @@
+/*
+Copyright (c) FFRI Security, Inc., 2024 / Author: FFRI Security, Inc.
+Licensed under Apache License 2.0, see LICENCE.
+*/
+
+package trace
+
+import "local.packages/golang-etw/etw"
+
+// RawEvent is the ETW event a trace.Event was decoded from
+type RawEvent = etw.Event